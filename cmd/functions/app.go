@@ -4,10 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/ATenderholt/rainbow-functions/internal/async"
 	"github.com/ATenderholt/rainbow-functions/internal/dev"
 	"github.com/ATenderholt/rainbow-functions/internal/docker"
 	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	handler "github.com/ATenderholt/rainbow-functions/internal/http"
+	"github.com/ATenderholt/rainbow-functions/internal/kafka"
 	"github.com/ATenderholt/rainbow-functions/internal/sqs"
+	"github.com/ATenderholt/rainbow-functions/internal/stream"
 	"github.com/ATenderholt/rainbow-functions/settings"
 	"net/http"
 	"os"
@@ -19,8 +23,12 @@ type App struct {
 	cfg          *settings.Config
 	srv          *http.Server
 	functionRepo domain.FunctionRepository
+	functions    handler.FunctionHandler
 	docker       *docker.Manager
 	sqs          *sqs.Manager
+	streams      *stream.Manager
+	kafka        *kafka.Manager
+	async        *async.Manager
 	devService   *dev.Service
 }
 
@@ -42,6 +50,20 @@ func (app App) Start() (err error) {
 		}
 		function.Environment = environment
 
+		layers, e := app.functionRepo.GetLayersForFunction(ctx, function)
+		if e != nil {
+			logger.Errorf("Unable to get Layers for Function %s: %v", function.FunctionName, e)
+			err = e
+			return
+		}
+		function.Layers = layers
+
+		err = function.MoveLegacyPaths(app.cfg)
+		if err != nil {
+			logger.Errorf("Unable to move files of Function %s: %v", function.FunctionName, err)
+			return
+		}
+
 		err = app.docker.StartFunction(ctx, &function)
 		if err != nil {
 			logger.Errorf("Unable to start Function %s: %v", function.FunctionName, err)
@@ -60,6 +82,21 @@ func (app App) Start() (err error) {
 		return
 	}
 
+	err = app.streams.StartAllEventSources(ctx)
+	if err != nil {
+		logger.Errorf("Unable to start stream Event sources: %v", err)
+		return
+	}
+
+	err = app.kafka.StartAllEventSources(ctx)
+	if err != nil {
+		logger.Errorf("Unable to start Kafka Event sources: %v", err)
+		return
+	}
+
+	// events that were queued before a restart are dispatched once their Functions are running
+	app.async.Start(ctx)
+
 	go func() {
 		e := app.srv.ListenAndServe()
 		if e != nil && e != http.ErrServerClosed {
@@ -130,7 +167,34 @@ func (app App) Shutdown() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
-	err := app.docker.ShutdownAll(ctx)
+	// let in-flight batches finish before their Functions are stopped
+	err := app.sqs.ShutdownAll(ctx)
+	if err != nil {
+		logger.Error("Unable to shutdown Event Sources: %v", err)
+	}
+
+	err = app.streams.ShutdownAll(ctx)
+	if err != nil {
+		logger.Error("Unable to shutdown stream Event Sources: %v", err)
+	}
+
+	err = app.kafka.ShutdownAll(ctx)
+	if err != nil {
+		logger.Error("Unable to shutdown Kafka Event Sources: %v", err)
+	}
+
+	err = app.async.ShutdownAll(ctx)
+	if err != nil {
+		logger.Error("Unable to shutdown asynchronous invocations: %v", err)
+	}
+
+	// let restarts of updated Functions finish before their containers are stopped
+	err = app.functions.ShutdownAll(ctx)
+	if err != nil {
+		logger.Error("Unable to finish restarting Functions: %v", err)
+	}
+
+	err = app.docker.ShutdownAll(ctx)
 	if err != nil {
 		logger.Error("Unable to shutdown Docker containers: %v", err)
 	}
@@ -6,12 +6,15 @@ package main
 import (
 	"fmt"
 	"github.com/ATenderholt/dockerlib"
+	"github.com/ATenderholt/rainbow-functions/internal/async"
 	"github.com/ATenderholt/rainbow-functions/internal/dev"
 	"github.com/ATenderholt/rainbow-functions/internal/docker"
 	"github.com/ATenderholt/rainbow-functions/internal/domain"
 	handler "github.com/ATenderholt/rainbow-functions/internal/http"
+	"github.com/ATenderholt/rainbow-functions/internal/kafka"
 	"github.com/ATenderholt/rainbow-functions/internal/repo"
 	"github.com/ATenderholt/rainbow-functions/internal/sqs"
+	"github.com/ATenderholt/rainbow-functions/internal/stream"
 	"github.com/ATenderholt/rainbow-functions/pkg/database"
 	"github.com/ATenderholt/rainbow-functions/settings"
 	"github.com/go-chi/chi/v5"
@@ -19,8 +22,9 @@ import (
 	"net/http"
 )
 
-func NewApp(cfg *settings.Config, mux *chi.Mux, docker *docker.Manager, sqs *sqs.Manager,
-	functionRepo domain.FunctionRepository, devService *dev.Service) App {
+func NewApp(cfg *settings.Config, mux *chi.Mux, docker *docker.Manager, sqs *sqs.Manager, streams *stream.Manager,
+	kafka *kafka.Manager, async *async.Manager, functionRepo domain.FunctionRepository, functions handler.FunctionHandler,
+	devService *dev.Service) App {
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.BasePort),
@@ -32,7 +36,11 @@ func NewApp(cfg *settings.Config, mux *chi.Mux, docker *docker.Manager, sqs *sqs
 		srv:          srv,
 		docker:       docker,
 		sqs:          sqs,
+		streams:      streams,
+		kafka:        kafka,
+		async:        async,
 		functionRepo: functionRepo,
+		functions:    functions,
 		devService:   devService,
 	}
 }
@@ -49,17 +57,25 @@ var db = wire.NewSet(
 	repo.NewLayerRepository,
 	repo.NewRuntimeRepository,
 	repo.NewEventSourceRepository,
+	repo.NewAliasRepository,
+	repo.NewAsyncInvocationRepository,
+	repo.NewEventInvokeConfigRepository,
 	// have to tell wire how to map interface to concrete type
 	wire.Bind(new(domain.FunctionRepository), new(*repo.FunctionRepository)),
 	wire.Bind(new(domain.LayerRepository), new(*repo.LayerRepository)),
 	wire.Bind(new(domain.RuntimeRepository), new(*repo.RuntimeRepository)),
 	wire.Bind(new(domain.EventSourceRepository), new(*repo.EventSourceRepository)),
+	wire.Bind(new(domain.AliasRepository), new(*repo.AliasRepository)),
+	wire.Bind(new(domain.AsyncInvocationRepository), new(*repo.AsyncInvocationRepository)),
+	wire.Bind(new(domain.EventInvokeConfigRepository), new(*repo.EventInvokeConfigRepository)),
 )
 
 var api = wire.NewSet(
 	handler.NewFunctionHandler,
 	handler.NewLayerHandler,
+	handler.NewAliasHandler,
 	handler.NewEventSourceHandler,
+	handler.NewEventInvokeConfigHandler,
 	handler.NewChiMux,
 )
 
@@ -70,6 +86,9 @@ func InjectApp(cfg *settings.Config) (App, error) {
 		api,
 		docker.NewManager,
 		sqs.NewManager,
+		stream.NewManager,
+		kafka.NewManager,
+		async.NewManager,
 		dev.NewService,
 		dockerlib.NewDockerController,
 	)
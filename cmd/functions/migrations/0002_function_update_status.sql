@@ -0,0 +1,3 @@
+-- +goose Up
+ALTER TABLE lambda_function ADD COLUMN last_update_status text NOT NULL DEFAULT 'Successful';
+ALTER TABLE lambda_function ADD COLUMN last_update_status_reason text;
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS lambda_function_alias (
+    id                  integer PRIMARY KEY AUTOINCREMENT,
+    function_name       text    NOT NULL,
+    name                text    NOT NULL,
+    function_version    text    NOT NULL,
+    description         text,
+    revision_id         text    NOT NULL
+);
+
+CREATE UNIQUE INDEX uk_alias ON lambda_function_alias(function_name, name);
+
+CREATE TABLE IF NOT EXISTS lambda_function_alias_weight (
+    id                  integer PRIMARY KEY AUTOINCREMENT,
+    alias_id            integer NOT NULL,
+    function_version    text    NOT NULL,
+    weight              real    NOT NULL,
+    FOREIGN KEY(alias_id) REFERENCES lambda_function_alias(id)
+);
@@ -0,0 +1,2 @@
+-- +goose Up
+ALTER TABLE lambda_event_source ADD COLUMN function_response_types text NOT NULL DEFAULT '';
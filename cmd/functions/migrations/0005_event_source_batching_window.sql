@@ -0,0 +1,2 @@
+-- +goose Up
+ALTER TABLE lambda_event_source ADD COLUMN maximum_batching_window integer NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- +goose Up
+ALTER TABLE lambda_event_source ADD COLUMN filter_criteria text NOT NULL DEFAULT '';
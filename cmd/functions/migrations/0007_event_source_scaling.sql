@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE lambda_event_source ADD COLUMN maximum_concurrency integer NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS lambda_function_concurrency (
+    function_name           text    PRIMARY KEY,
+    reserved_concurrency    integer NOT NULL
+);
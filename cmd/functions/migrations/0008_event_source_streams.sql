@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE lambda_event_source ADD COLUMN starting_position text NOT NULL DEFAULT '';
+ALTER TABLE lambda_event_source ADD COLUMN starting_position_timestamp integer NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS lambda_event_source_checkpoint (
+    event_source_uuid   text    NOT NULL,
+    shard_id            text    NOT NULL,
+    sequence_number     text    NOT NULL,
+    closed              integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (event_source_uuid, shard_id)
+);
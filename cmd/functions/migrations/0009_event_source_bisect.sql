@@ -0,0 +1,2 @@
+-- +goose Up
+ALTER TABLE lambda_event_source ADD COLUMN bisect_batch_on_function_error integer NOT NULL DEFAULT 0;
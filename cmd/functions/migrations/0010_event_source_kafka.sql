@@ -0,0 +1,6 @@
+-- +goose Up
+ALTER TABLE lambda_event_source ADD COLUMN bootstrap_servers text NOT NULL DEFAULT '';
+ALTER TABLE lambda_event_source ADD COLUMN topics text NOT NULL DEFAULT '';
+
+DROP INDEX uk_lambda_event_source;
+CREATE UNIQUE INDEX uk_lambda_event_source on lambda_event_source(arn, bootstrap_servers, topics, function_id);
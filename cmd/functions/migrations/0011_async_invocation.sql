@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS lambda_async_invocation (
+    id                  integer PRIMARY KEY AUTOINCREMENT,
+    request_id          text    NOT NULL,
+    function_name       text    NOT NULL,
+    qualifier           text    NOT NULL,
+    payload             blob    NOT NULL,
+    attempts            integer NOT NULL DEFAULT 0,
+    created             integer NOT NULL,
+    next_attempt        integer NOT NULL,
+    error_code          integer NOT NULL DEFAULT 0,
+    error_message       text    NOT NULL DEFAULT ''
+);
+
+CREATE UNIQUE INDEX uk_async_invocation ON lambda_async_invocation(request_id);
+CREATE INDEX ix_async_invocation_next_attempt ON lambda_async_invocation(next_attempt);
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS lambda_function_event_invoke_config (
+    function_name               text    NOT NULL,
+    qualifier                   text    NOT NULL,
+    maximum_retry_attempts      integer,
+    maximum_event_age           integer,
+    on_success                  text    NOT NULL DEFAULT '',
+    on_failure                  text    NOT NULL DEFAULT '',
+    last_modified_on            integer NOT NULL,
+    PRIMARY KEY (function_name, qualifier)
+);
@@ -0,0 +1,4 @@
+-- +goose Up
+ALTER TABLE lambda_event_source ADD COLUMN maximum_retry_attempts integer NOT NULL DEFAULT -1;
+ALTER TABLE lambda_event_source ADD COLUMN maximum_record_age integer NOT NULL DEFAULT -1;
+ALTER TABLE lambda_event_source ADD COLUMN on_failure text NOT NULL DEFAULT '';
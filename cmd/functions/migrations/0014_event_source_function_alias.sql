@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE lambda_event_source ADD COLUMN function_alias text NOT NULL DEFAULT '';
+
+DROP INDEX uk_lambda_event_source;
+CREATE UNIQUE INDEX uk_lambda_event_source on lambda_event_source(arn, bootstrap_servers, topics, function_id, function_alias);
@@ -9,12 +9,15 @@ package main
 import (
 	"fmt"
 	"github.com/ATenderholt/dockerlib"
+	"github.com/ATenderholt/rainbow-functions/internal/async"
 	"github.com/ATenderholt/rainbow-functions/internal/dev"
 	"github.com/ATenderholt/rainbow-functions/internal/docker"
 	"github.com/ATenderholt/rainbow-functions/internal/domain"
 	"github.com/ATenderholt/rainbow-functions/internal/http"
+	"github.com/ATenderholt/rainbow-functions/internal/kafka"
 	"github.com/ATenderholt/rainbow-functions/internal/repo"
 	"github.com/ATenderholt/rainbow-functions/internal/sqs"
+	"github.com/ATenderholt/rainbow-functions/internal/stream"
 	"github.com/ATenderholt/rainbow-functions/pkg/database"
 	"github.com/ATenderholt/rainbow-functions/settings"
 	"github.com/go-chi/chi/v5"
@@ -34,28 +37,37 @@ func InjectApp(cfg *settings.Config) (App, error) {
 	runtimeRepository := repo.NewRuntimeRepository(database)
 	layerHandler := http.NewLayerHandler(cfg, layerRepository, runtimeRepository)
 	functionRepository := repo.NewFunctionRepository(database)
-	manager, err := docker.NewManager(cfg)
+	aliasRepository := repo.NewAliasRepository(database)
+	eventSourceRepository := repo.NewEventSourceRepository(database)
+	sqsManager := sqs.NewManager(cfg, eventSourceRepository)
+	asyncInvocationRepository := repo.NewAsyncInvocationRepository(database)
+	eventInvokeConfigRepository := repo.NewEventInvokeConfigRepository(database)
+	asyncManager := async.NewManager(cfg, functionRepository, aliasRepository, asyncInvocationRepository, eventInvokeConfigRepository, sqsManager)
+	manager, err := docker.NewManager(cfg, functionRepository, aliasRepository, asyncManager)
 	if err != nil {
 		return App{}, err
 	}
-	functionHandler := http.NewFunctionHandler(cfg, functionRepository, layerRepository, runtimeRepository, manager)
-	eventSourceRepository := repo.NewEventSourceRepository(database)
-	eventSourceHandler := http.NewEventSourceHandler(cfg, eventSourceRepository, functionRepository)
-	mux := http.NewChiMux(layerHandler, functionHandler, eventSourceHandler, manager)
-	sqsManager := sqs.NewManager(cfg, eventSourceRepository)
+	streamManager := stream.NewManager(cfg, eventSourceRepository, sqsManager)
+	kafkaManager := kafka.NewManager(cfg, eventSourceRepository)
+	functionHandler := http.NewFunctionHandler(cfg, functionRepository, aliasRepository, layerRepository, runtimeRepository, manager, sqsManager, streamManager, kafkaManager)
+	aliasHandler := http.NewAliasHandler(cfg, aliasRepository, functionRepository)
+	eventSourceHandler := http.NewEventSourceHandler(cfg, eventSourceRepository, functionRepository, aliasRepository, sqsManager, streamManager, kafkaManager)
+	eventInvokeConfigHandler := http.NewEventInvokeConfigHandler(cfg, eventInvokeConfigRepository, functionRepository, aliasRepository)
+	mux := http.NewChiMux(layerHandler, functionHandler, aliasHandler, eventSourceHandler, eventInvokeConfigHandler, manager)
 	dockerController, err := dockerlib.NewDockerController()
 	if err != nil {
 		return App{}, err
 	}
 	service := dev.NewService(cfg, dockerController)
-	app := NewApp(cfg, mux, manager, sqsManager, functionRepository, service)
+	app := NewApp(cfg, mux, manager, sqsManager, streamManager, kafkaManager, asyncManager, functionRepository, functionHandler, service)
 	return app, nil
 }
 
 // inject.go:
 
-func NewApp(cfg *settings.Config, mux *chi.Mux, docker2 *docker.Manager, sqs2 *sqs.Manager,
-	functionRepo domain.FunctionRepository, devService *dev.Service) App {
+func NewApp(cfg *settings.Config, mux *chi.Mux, docker2 *docker.Manager, sqs2 *sqs.Manager, streams *stream.Manager,
+	kafka *kafka.Manager, async *async.Manager, functionRepo domain.FunctionRepository, functions http.FunctionHandler,
+	devService *dev.Service) App {
 
 	srv := &http2.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.BasePort),
@@ -67,7 +79,11 @@ func NewApp(cfg *settings.Config, mux *chi.Mux, docker2 *docker.Manager, sqs2 *s
 		srv:          srv,
 		docker:       docker2,
 		sqs:          sqs2,
+		streams:      streams,
+		kafka:        kafka,
+		async:        async,
 		functionRepo: functionRepo,
+		functions:    functions,
 		devService:   devService,
 	}
 }
@@ -79,7 +95,7 @@ func RealDatabase(cfg *settings.Config) database.Database {
 }
 
 var db = wire.NewSet(
-	RealDatabase, repo.NewFunctionRepository, repo.NewLayerRepository, repo.NewRuntimeRepository, repo.NewEventSourceRepository, wire.Bind(new(domain.FunctionRepository), new(*repo.FunctionRepository)), wire.Bind(new(domain.LayerRepository), new(*repo.LayerRepository)), wire.Bind(new(domain.RuntimeRepository), new(*repo.RuntimeRepository)), wire.Bind(new(domain.EventSourceRepository), new(*repo.EventSourceRepository)),
+	RealDatabase, repo.NewFunctionRepository, repo.NewLayerRepository, repo.NewRuntimeRepository, repo.NewEventSourceRepository, repo.NewAliasRepository, repo.NewAsyncInvocationRepository, repo.NewEventInvokeConfigRepository, wire.Bind(new(domain.FunctionRepository), new(*repo.FunctionRepository)), wire.Bind(new(domain.LayerRepository), new(*repo.LayerRepository)), wire.Bind(new(domain.RuntimeRepository), new(*repo.RuntimeRepository)), wire.Bind(new(domain.EventSourceRepository), new(*repo.EventSourceRepository)), wire.Bind(new(domain.AliasRepository), new(*repo.AliasRepository)), wire.Bind(new(domain.AsyncInvocationRepository), new(*repo.AsyncInvocationRepository)), wire.Bind(new(domain.EventInvokeConfigRepository), new(*repo.EventInvokeConfigRepository)),
 )
 
-var api = wire.NewSet(http.NewFunctionHandler, http.NewLayerHandler, http.NewEventSourceHandler, http.NewChiMux)
+var api = wire.NewSet(http.NewFunctionHandler, http.NewLayerHandler, http.NewAliasHandler, http.NewEventSourceHandler, http.NewEventInvokeConfigHandler, http.NewChiMux)
@@ -5,6 +5,9 @@ go 1.17
 require (
 	github.com/ATenderholt/dockerlib v1.3.0
 	github.com/aws/aws-sdk-go-v2 v1.15.0
+	github.com/aws/aws-sdk-go-v2/service/dynamodbstreams v1.13.0
+	github.com/aws/aws-sdk-go-v2/service/eventbridge v1.14.0
+	github.com/aws/aws-sdk-go-v2/service/kinesis v1.15.0
 	github.com/aws/aws-sdk-go-v2/service/lambda v1.20.0
 	github.com/aws/aws-sdk-go-v2/service/sqs v1.18.0
 	github.com/aws/smithy-go v1.11.1
@@ -14,6 +17,7 @@ require (
 	github.com/google/wire v0.5.0
 	github.com/mattn/go-sqlite3 v1.14.12
 	github.com/pressly/goose/v3 v3.5.3
+	github.com/segmentio/kafka-go v0.4.31
 	github.com/stretchr/testify v1.7.1
 	go.uber.org/zap v1.21.0
 	gopkg.in/yaml.v2 v2.4.0
@@ -21,6 +25,7 @@ require (
 
 require (
 	github.com/Microsoft/go-winio v0.5.2 // indirect
+	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.4.0 // indirect
 	github.com/aws/aws-sdk-go-v2/internal/configsources v1.1.6 // indirect
 	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.4.0 // indirect
 	github.com/containerd/containerd v1.6.2 // indirect
@@ -32,11 +37,13 @@ require (
 	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/gorilla/mux v1.8.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/klauspost/compress v1.14.2 // indirect
 	github.com/kr/text v0.2.0 // indirect
 	github.com/moby/term v0.0.0-20210610120745-9d4ed1856297 // indirect
 	github.com/morikuni/aec v1.0.0 // indirect
 	github.com/opencontainers/go-digest v1.0.0 // indirect
 	github.com/opencontainers/image-spec v1.0.2 // indirect
+	github.com/pierrec/lz4/v4 v4.1.14 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/sirupsen/logrus v1.8.1 // indirect
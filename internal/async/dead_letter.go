@@ -0,0 +1,72 @@
+package async
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"net/http"
+	"strings"
+)
+
+// Failure returns the status code & error message of a failed invocation. Like AWS, Function errors have a status
+// code of 200 and the errorMessage that the Function responded with.
+func Failure(err error) (int, string) {
+	var functionError poller.FunctionError
+	if errors.As(err, &functionError) {
+		var payload struct {
+			ErrorMessage string `json:"errorMessage"`
+		}
+		if json.Unmarshal(functionError.Payload, &payload) == nil && payload.ErrorMessage != "" {
+			return http.StatusOK, payload.ErrorMessage
+		}
+
+		return http.StatusOK, string(functionError.Payload)
+	}
+
+	var responseError *awshttp.ResponseError
+	if errors.As(err, &responseError) {
+		return responseError.HTTPStatusCode(), err.Error()
+	}
+
+	return http.StatusInternalServerError, err.Error()
+}
+
+// deadLetter sends the event of a dropped invocation to the Function's dead-letter queue, if it has one.
+func (m *Manager) deadLetter(invocation *domain.AsyncInvocation) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	function, err := m.loadFunction(ctx, invocation.FunctionName, invocation.Qualifier)
+	if err != nil {
+		logger.Errorf("Unable to load Function %s to send dropped request %s to its dead-letter queue: %v",
+			invocation.Target(), invocation.RequestId, err)
+		return
+	}
+
+	arn := function.DeadLetterArn
+	switch {
+	case arn == "":
+		logger.Infof("Function %s has no dead-letter queue for dropped request %s", invocation.Target(),
+			invocation.RequestId)
+		return
+	case !strings.HasPrefix(arn, "arn:aws:sqs:"):
+		logger.Errorf("Dead-letter target %s of Function %s is not an SQS queue, so discarding request %s",
+			arn, invocation.Target(), invocation.RequestId)
+		return
+	}
+
+	errorMessage := invocation.ErrorMessage
+	if invocation.Attempts == 0 {
+		errorMessage = "Event age exceeded before the Function was invoked"
+	}
+
+	err = m.sqs.SendDeadLetter(ctx, arn, invocation.RequestId, invocation.Payload, invocation.ErrorCode,
+		errorMessage)
+	if err != nil {
+		logger.Errorf("Unable to send dropped request %s to dead-letter queue of Function %s: %v",
+			invocation.RequestId, invocation.Target(), err)
+	}
+}
@@ -0,0 +1,110 @@
+package async
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"strings"
+	"time"
+)
+
+// sendRecord sends the Record of the invocation to the destination, if there is one. Functions are invoked
+// asynchronously with the Record, so that they are retried like any other event.
+func (m *Manager) sendRecord(invocation *domain.AsyncInvocation, destination string, condition string,
+	response *Response) {
+
+	if destination == "" {
+		return
+	}
+
+	record := NewRecord(m.cfg, *invocation, condition, response, time.Now())
+	payload, err := json.Marshal(record)
+	if err != nil {
+		logger.Errorf("Unable to marshal record of request %s: %v", invocation.RequestId, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	switch domain.DestinationService(destination) {
+	case "lambda":
+		name, qualifier := domain.ParseFunctionName(destination)
+		_, err = m.Enqueue(ctx, name, qualifier, payload)
+	case "sqs":
+		err = m.sqs.SendMessage(ctx, destination, payload, nil)
+	case "events":
+		err = m.putEvent(ctx, destination, record, payload)
+	default:
+		err = fmt.Errorf("unsupported destination")
+	}
+
+	if err != nil {
+		logger.Errorf("Unable to send record of request %s to destination %s: %v", invocation.RequestId,
+			destination, err)
+		return
+	}
+
+	logger.Infof("Sent %s record of request %s to destination %s", condition, invocation.RequestId, destination)
+}
+
+// putEvent sends the Record to the event bus with the ARN, with the same source & detail type as Lambda uses.
+func (m *Manager) putEvent(ctx context.Context, arn string, record Record, payload []byte) error {
+	detailType := "Lambda Function Invocation Result - Failure"
+	if record.RequestContext.Condition == ConditionSuccess {
+		detailType = "Lambda Function Invocation Result - Success"
+	}
+
+	output, err := m.eventsClient(arn).PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []types.PutEventsRequestEntry{
+			{
+				Detail:       aws.String(string(payload)),
+				DetailType:   &detailType,
+				EventBusName: &arn,
+				Resources:    []string{record.RequestContext.FunctionArn},
+				Source:       aws.String("lambda"),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if output.FailedEntryCount > 0 && len(output.Entries) > 0 {
+		return fmt.Errorf("event was rejected with %s", aws.ToString(output.Entries[0].ErrorMessage))
+	}
+
+	return nil
+}
+
+// eventsClient returns the client for the region of the event bus, sharing clients between buses in the same region.
+func (m *Manager) eventsClient(arn string) *eventbridge.Client {
+	region := m.cfg.Region
+	if parts := strings.Split(arn, ":"); len(parts) > 3 && parts[3] != "" {
+		region = parts[3]
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	client, ok := m.eventsClients[region]
+	if !ok {
+		logger.Infof("Using EventBridge endpoint %s for region %s", m.cfg.EventsEndpoint, region)
+		client = eventbridge.NewFromConfig(aws.Config{
+			Region:                      region,
+			Credentials:                 poller.Credentials,
+			EndpointResolverWithOptions: poller.EndpointResolver(m.cfg.EventsEndpoint),
+			ClientLogMode:               0,
+			DefaultsMode:                "",
+			RuntimeEnvironment:          aws.RuntimeEnvironment{},
+		})
+		m.eventsClients[region] = client
+	}
+
+	return client
+}
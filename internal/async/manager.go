@@ -0,0 +1,323 @@
+package async
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/ATenderholt/rainbow-functions/internal/sqs"
+	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/google/uuid"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// delay before the first retry, which doubles with each one after it
+	retryDelay = time.Minute
+
+	// how often the queue is checked for events that are due, in addition to when events are queued
+	pollInterval = time.Second
+
+	// most events attempted at once, which also limits the events that are read from the queue at a time
+	dispatchLimit = 100
+
+	// how long to spend updating the queue after an attempt, which happens even if the Manager is shutting down
+	storeTimeout = 30 * time.Second
+)
+
+// Manager invokes Functions with the events of asynchronous invocations, which are queued in the database so that
+// they survive restarts. Failed events are retried with backoff, and dropped to the Function's dead-letter queue once
+// they run out of retries or are too old. Records of each invocation are sent to the destinations in its config.
+type Manager struct {
+	cfg            *settings.Config
+	functionRepo   domain.FunctionRepository
+	aliasRepo      domain.AliasRepository
+	invocationRepo domain.AsyncInvocationRepository
+	configRepo     domain.EventInvokeConfigRepository
+	lambda         *poller.Lambda
+	sqs            *sqs.Manager
+
+	// signals the dispatcher that an event has been queued
+	queued chan struct{}
+
+	cancel context.CancelFunc
+
+	// dispatcher & in-flight attempts, so that shutdown can wait for them
+	wg sync.WaitGroup
+
+	// ids of events being attempted, which are still due until the attempt finishes, and the clients for event bus
+	// destinations in each region
+	lock          sync.Mutex
+	inFlight      map[int64]bool
+	eventsClients map[string]*eventbridge.Client
+}
+
+func NewManager(cfg *settings.Config, functionRepo domain.FunctionRepository, aliasRepo domain.AliasRepository,
+	invocationRepo domain.AsyncInvocationRepository, configRepo domain.EventInvokeConfigRepository,
+	sqs *sqs.Manager) *Manager {
+
+	return &Manager{
+		cfg:            cfg,
+		functionRepo:   functionRepo,
+		aliasRepo:      aliasRepo,
+		invocationRepo: invocationRepo,
+		configRepo:     configRepo,
+		lambda:         poller.NewLambda(cfg),
+		sqs:            sqs,
+		queued:         make(chan struct{}, 1),
+		inFlight:       make(map[int64]bool),
+		eventsClients:  make(map[string]*eventbridge.Client),
+	}
+}
+
+// Start dispatches queued events until ShutdownAll is called, including those that were queued before a restart.
+func (m *Manager) Start(ctx context.Context) {
+	ctx, m.cancel = context.WithCancel(ctx)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.dispatch(ctx)
+	}()
+}
+
+// Enqueue queues the event for the Function & returns the id of the request, or sql.ErrNoRows if the Function
+// doesn't exist. The qualifier may be an Alias, which is resolved each time the event is attempted.
+func (m *Manager) Enqueue(ctx context.Context, name string, qualifier string, payload []byte) (string, error) {
+	_, err := m.loadFunction(ctx, name, qualifier)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UnixMilli()
+	invocation := domain.AsyncInvocation{
+		RequestId:    uuid.NewString(),
+		FunctionName: name,
+		Qualifier:    qualifier,
+		Payload:      payload,
+		Created:      now,
+		NextAttempt:  now,
+	}
+
+	err = m.invocationRepo.InsertAsyncInvocation(ctx, &invocation)
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case m.queued <- struct{}{}:
+	default:
+	}
+
+	return invocation.RequestId, nil
+}
+
+func (m *Manager) dispatch(ctx context.Context) {
+	timer := time.NewTimer(pollInterval)
+	defer timer.Stop()
+
+	for {
+		m.dispatchDue(ctx)
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(pollInterval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.queued:
+		case <-timer.C:
+		}
+	}
+}
+
+// dispatchDue starts an attempt for each event that is due & isn't already being attempted.
+func (m *Manager) dispatchDue(ctx context.Context) {
+	invocations, err := m.invocationRepo.GetDueAsyncInvocations(ctx, time.Now().UnixMilli(), dispatchLimit)
+	if err != nil {
+		logger.Errorf("Unable to get queued events: %v", err)
+		return
+	}
+
+	for i := range invocations {
+		invocation := invocations[i]
+
+		m.lock.Lock()
+		if m.inFlight[invocation.ID] {
+			m.lock.Unlock()
+			continue
+		}
+		m.inFlight[invocation.ID] = true
+		m.wg.Add(1)
+		m.lock.Unlock()
+
+		go func() {
+			defer m.done(invocation.ID)
+			m.attempt(&invocation)
+		}()
+	}
+}
+
+func (m *Manager) done(id int64) {
+	m.lock.Lock()
+	delete(m.inFlight, id)
+	m.lock.Unlock()
+
+	m.wg.Done()
+}
+
+// attempt invokes the Function with the event, and then either removes it from the queue or schedules its retry.
+func (m *Manager) attempt(invocation *domain.AsyncInvocation) {
+	config := m.loadConfig(invocation)
+
+	if Expired(*invocation, config.MaximumEventAge(), time.Now()) {
+		logger.Warnf("Dropping request %s for Function %s since it is older than %v", invocation.RequestId,
+			invocation.Target(), config.MaximumEventAge())
+		m.drop(invocation, config, ConditionEventAgeExceeded, nil)
+		return
+	}
+
+	logger.Infof("Invoking Function %s for request %s (attempt %d)", invocation.Target(), invocation.RequestId,
+		invocation.Attempts+1)
+
+	target := invocation.Target()
+	output, err := m.lambda.InvokeOutput(&target, invocation.Payload)
+	invocation.Attempts++
+
+	if err == nil {
+		m.sendRecord(invocation, config.Destination(true), ConditionSuccess, NewResponse(output, err))
+		m.remove(invocation)
+		return
+	}
+
+	invocation.ErrorCode, invocation.ErrorMessage = Failure(err)
+
+	if invocation.Attempts > config.RetryAttempts() {
+		logger.Warnf("Dropping request %s for Function %s after %d attempts", invocation.RequestId,
+			invocation.Target(), invocation.Attempts)
+		m.drop(invocation, config, ConditionRetriesExhausted, NewResponse(output, err))
+		return
+	}
+
+	delay := RetryDelay(invocation.Attempts)
+	invocation.NextAttempt = time.Now().Add(delay).UnixMilli()
+
+	logger.Infof("Retrying request %s for Function %s in %v", invocation.RequestId, invocation.Target(), delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	err = m.invocationRepo.UpdateAsyncInvocation(ctx, invocation)
+	if err != nil {
+		logger.Errorf("Unable to schedule retry of request %s, so it will be retried immediately: %v",
+			invocation.RequestId, err)
+	}
+}
+
+// loadConfig returns the invoke config for the qualifier that the event was queued for, or nil if there isn't one
+// and the defaults apply.
+func (m *Manager) loadConfig(invocation *domain.AsyncInvocation) *domain.EventInvokeConfig {
+	qualifier := invocation.Qualifier
+	if qualifier == "" {
+		qualifier = domain.LatestVersion
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	config, err := m.configRepo.GetEventInvokeConfig(ctx, invocation.FunctionName, qualifier)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil
+	case err != nil:
+		logger.Errorf("Unable to load invoke config for request %s, so using the defaults: %v",
+			invocation.RequestId, err)
+		return nil
+	}
+
+	return config
+}
+
+// drop sends the event to the Function's dead-letter queue & its destination for failures, and then removes it from
+// the queue. The response is nil if the Function wasn't invoked.
+func (m *Manager) drop(invocation *domain.AsyncInvocation, config *domain.EventInvokeConfig, condition string,
+	response *Response) {
+
+	m.deadLetter(invocation)
+	m.sendRecord(invocation, config.Destination(false), condition, response)
+	m.remove(invocation)
+}
+
+func (m *Manager) remove(invocation *domain.AsyncInvocation) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	err := m.invocationRepo.DeleteAsyncInvocation(ctx, invocation.ID)
+	if err != nil {
+		logger.Errorf("Unable to remove request %s from the queue, so it may be invoked again: %v",
+			invocation.RequestId, err)
+	}
+}
+
+// loadFunction returns the configuration of $LATEST, a published version or the version an Alias points to.
+func (m *Manager) loadFunction(ctx context.Context, name string, qualifier string) (*domain.Function, error) {
+	if qualifier == "" || qualifier == domain.LatestVersion {
+		return m.functionRepo.GetLatestFunctionByName(ctx, name)
+	}
+
+	version, err := strconv.Atoi(qualifier)
+	if err != nil {
+		alias, err := m.aliasRepo.GetAlias(ctx, name, qualifier)
+		if err != nil {
+			return nil, err
+		}
+
+		return m.loadFunction(ctx, name, alias.FunctionVersion)
+	}
+
+	return m.functionRepo.GetFunctionVersion(ctx, name, version)
+}
+
+// ShutdownAll stops dispatching events, and waits for in-flight attempts to finish until the context is done. Events
+// that are still queued are dispatched when the Manager is next started.
+func (m *Manager) ShutdownAll(ctx context.Context) error {
+	if m.cancel != nil {
+		m.cancel()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for asynchronous invocations to finish: %v", ctx.Err())
+	}
+}
+
+// RetryDelay returns the delay before retrying an event that has failed the specified number of times.
+func RetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		return retryDelay
+	}
+
+	return retryDelay << (attempts - 1)
+}
+
+// Expired is true when the event is older than the maximum age, so should be dropped rather than attempted.
+func Expired(invocation domain.AsyncInvocation, maximumAge time.Duration, now time.Time) bool {
+	return now.Sub(time.UnixMilli(invocation.Created)) > maximumAge
+}
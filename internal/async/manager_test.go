@@ -0,0 +1,74 @@
+package async_test
+
+import (
+	"errors"
+	"github.com/ATenderholt/rainbow-functions/internal/async"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Minute, async.RetryDelay(1))
+	assert.Equal(t, 2*time.Minute, async.RetryDelay(2))
+	assert.Equal(t, 4*time.Minute, async.RetryDelay(3))
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Now()
+	invocation := domain.AsyncInvocation{Created: now.Add(-time.Hour).UnixMilli()}
+
+	assert.False(t, async.Expired(invocation, 2*time.Hour, now))
+	assert.True(t, async.Expired(invocation, 30*time.Minute, now))
+}
+
+func TestFailureFunctionError(t *testing.T) {
+	err := poller.FunctionError{
+		Function: "fn",
+		Type:     "Unhandled",
+		Payload:  []byte(`{"errorMessage": "something broke", "errorType": "Exception"}`),
+	}
+
+	code, msg := async.Failure(err)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "something broke", msg)
+}
+
+func TestFailureFunctionErrorWithoutMessage(t *testing.T) {
+	code, msg := async.Failure(poller.FunctionError{Function: "fn", Type: "Unhandled", Payload: []byte("crashed")})
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "crashed", msg)
+}
+
+func TestFailureResponseError(t *testing.T) {
+	responseError := &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusNotFound}},
+			Err:      errors.New("not found"),
+		},
+	}
+
+	code, _ := async.Failure(poller.InvokeError{Function: "fn", Base: responseError})
+
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestFailureOtherError(t *testing.T) {
+	code, msg := async.Failure(errors.New("connection refused"))
+
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Equal(t, "connection refused", msg)
+}
+
+func TestTarget(t *testing.T) {
+	assert.Equal(t, "fn", domain.AsyncInvocation{FunctionName: "fn"}.Target())
+	assert.Equal(t, "fn", domain.AsyncInvocation{FunctionName: "fn", Qualifier: domain.LatestVersion}.Target())
+	assert.Equal(t, "fn:3", domain.AsyncInvocation{FunctionName: "fn", Qualifier: "3"}.Target())
+}
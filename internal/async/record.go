@@ -0,0 +1,113 @@
+package async
+
+import (
+	"encoding/json"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"time"
+)
+
+// conditions under which records are sent to destinations
+const (
+	ConditionSuccess          = "Success"
+	ConditionRetriesExhausted = "RetriesExhausted"
+	ConditionEventAgeExceeded = "EventAgeExceeded"
+)
+
+// Record is what Lambda sends to a destination about an asynchronous invocation
+type Record struct {
+	Version         string           `json:"version"`
+	Timestamp       string           `json:"timestamp"`
+	RequestContext  RequestContext   `json:"requestContext"`
+	RequestPayload  json.RawMessage  `json:"requestPayload"`
+	ResponseContext *ResponseContext `json:"responseContext,omitempty"`
+	ResponsePayload json.RawMessage  `json:"responsePayload,omitempty"`
+}
+
+type RequestContext struct {
+	RequestId              string `json:"requestId"`
+	FunctionArn            string `json:"functionArn"`
+	Condition              string `json:"condition"`
+	ApproximateInvokeCount int    `json:"approximateInvokeCount"`
+}
+
+type ResponseContext struct {
+	StatusCode      int    `json:"statusCode"`
+	ExecutedVersion string `json:"executedVersion,omitempty"`
+	FunctionError   string `json:"functionError,omitempty"`
+}
+
+// Response is the result of the last attempt to invoke the Function with an event.
+type Response struct {
+	StatusCode      int
+	ExecutedVersion string
+	FunctionError   string
+	Payload         []byte
+}
+
+// NewResponse creates the Response from the output & error of an invocation. Errors calling the Function are reported
+// with their error message, since there isn't any output.
+func NewResponse(output *lambda.InvokeOutput, err error) *Response {
+	if output == nil {
+		code, msg := Failure(err)
+		payload, _ := json.Marshal(map[string]string{"errorMessage": msg})
+		return &Response{StatusCode: code, Payload: payload}
+	}
+
+	return &Response{
+		StatusCode:      int(output.StatusCode),
+		ExecutedVersion: aws.ToString(output.ExecutedVersion),
+		FunctionError:   aws.ToString(output.FunctionError),
+		Payload:         output.Payload,
+	}
+}
+
+// NewRecord creates the Record of the invocation for a destination, where response is nil if the Function wasn't
+// invoked.
+func NewRecord(cfg *settings.Config, invocation domain.AsyncInvocation, condition string, response *Response,
+	now time.Time) Record {
+
+	qualifier := invocation.Qualifier
+	if qualifier == "" {
+		qualifier = domain.LatestVersion
+	}
+
+	record := Record{
+		Version:   "1.0",
+		Timestamp: now.UTC().Format("2006-01-02T15:04:05.000Z"),
+		RequestContext: RequestContext{
+			RequestId:              invocation.RequestId,
+			FunctionArn:            "arn:aws:lambda:" + cfg.ArnFragment() + ":function:" + invocation.FunctionName + ":" + qualifier,
+			Condition:              condition,
+			ApproximateInvokeCount: invocation.Attempts,
+		},
+		RequestPayload: rawJson(invocation.Payload),
+	}
+
+	if response != nil {
+		record.ResponseContext = &ResponseContext{
+			StatusCode:      response.StatusCode,
+			ExecutedVersion: response.ExecutedVersion,
+			FunctionError:   response.FunctionError,
+		}
+		record.ResponsePayload = rawJson(response.Payload)
+	}
+
+	return record
+}
+
+// rawJson returns the payload as is when it is valid JSON, and as a JSON string otherwise.
+func rawJson(payload []byte) json.RawMessage {
+	if len(payload) == 0 {
+		return json.RawMessage("null")
+	}
+
+	if json.Valid(payload) {
+		return payload
+	}
+
+	value, _ := json.Marshal(string(payload))
+	return value
+}
@@ -0,0 +1,102 @@
+package async_test
+
+import (
+	"encoding/json"
+	"github.com/ATenderholt/rainbow-functions/internal/async"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var cfg = &settings.Config{Region: "us-west-2", AccountNumber: "271828182845"}
+
+func invocation() domain.AsyncInvocation {
+	return domain.AsyncInvocation{
+		RequestId:    "request-1",
+		FunctionName: "fn",
+		Payload:      []byte(`{"order": 1}`),
+		Attempts:     1,
+	}
+}
+
+func TestNewRecordSuccess(t *testing.T) {
+	output := &lambda.InvokeOutput{
+		ExecutedVersion: aws.String("$LATEST"),
+		Payload:         []byte(`{"status": "ok"}`),
+		StatusCode:      200,
+	}
+	now := time.Date(2022, 3, 4, 5, 6, 7, 8000000, time.UTC)
+
+	record := async.NewRecord(cfg, invocation(), async.ConditionSuccess, async.NewResponse(output, nil), now)
+
+	payload, err := json.Marshal(record)
+	assert.NoError(t, err)
+
+	expected := `{
+		"version": "1.0",
+		"timestamp": "2022-03-04T05:06:07.008Z",
+		"requestContext": {
+			"requestId": "request-1",
+			"functionArn": "arn:aws:lambda:us-west-2:271828182845:function:fn:$LATEST",
+			"condition": "Success",
+			"approximateInvokeCount": 1
+		},
+		"requestPayload": {"order": 1},
+		"responseContext": {"statusCode": 200, "executedVersion": "$LATEST"},
+		"responsePayload": {"status": "ok"}
+	}`
+	assert.JSONEq(t, expected, string(payload))
+}
+
+func TestNewRecordFunctionError(t *testing.T) {
+	output := &lambda.InvokeOutput{
+		ExecutedVersion: aws.String("3"),
+		FunctionError:   aws.String("Unhandled"),
+		Payload:         []byte(`{"errorMessage": "something broke"}`),
+		StatusCode:      200,
+	}
+	err := poller.FunctionError{Function: "fn:live", Type: "Unhandled", Payload: output.Payload}
+
+	i := invocation()
+	i.Qualifier = "live"
+	i.Attempts = 3
+
+	record := async.NewRecord(cfg, i, async.ConditionRetriesExhausted, async.NewResponse(output, err), time.Now())
+
+	assert.Equal(t, "arn:aws:lambda:us-west-2:271828182845:function:fn:live", record.RequestContext.FunctionArn)
+	assert.Equal(t, 3, record.RequestContext.ApproximateInvokeCount)
+	assert.Equal(t, "Unhandled", record.ResponseContext.FunctionError)
+	assert.Equal(t, "3", record.ResponseContext.ExecutedVersion)
+	assert.JSONEq(t, `{"errorMessage": "something broke"}`, string(record.ResponsePayload))
+}
+
+func TestNewRecordInvokeError(t *testing.T) {
+	response := async.NewResponse(nil, poller.InvokeError{Function: "fn", Base: assert.AnError})
+
+	record := async.NewRecord(cfg, invocation(), async.ConditionRetriesExhausted, response, time.Now())
+
+	assert.Equal(t, 500, record.ResponseContext.StatusCode)
+	assert.Contains(t, string(record.ResponsePayload), "errorMessage")
+}
+
+func TestNewRecordEventAgeExceeded(t *testing.T) {
+	i := invocation()
+	i.Attempts = 0
+	i.Payload = []byte("not json")
+
+	record := async.NewRecord(cfg, i, async.ConditionEventAgeExceeded, nil, time.Now())
+
+	payload, err := json.Marshal(record)
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(payload, &decoded))
+	assert.Equal(t, "not json", decoded["requestPayload"])
+	assert.NotContains(t, decoded, "responseContext")
+	assert.NotContains(t, decoded, "responsePayload")
+}
@@ -2,17 +2,37 @@ package docker
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/ATenderholt/dockerlib"
+	"github.com/ATenderholt/rainbow-functions/internal/async"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
 	"github.com/ATenderholt/rainbow-functions/settings"
 	aws "github.com/aws/aws-sdk-go-v2/service/lambda/types"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// how long to wait for a replacement container to respond before giving up on it
+	readyTimeout = 30 * time.Second
+
+	// how long to wait for in-flight invocations to finish before stopping a container anyway
+	drainTimeout = time.Minute
+
+	// invocations with this type are queued & the Function is invoked with them in the background
+	invocationTypeEvent = "Event"
 )
 
 var imageMap = map[aws.Runtime]string{
@@ -27,11 +47,14 @@ type Docker interface {
 	EnsureImage(context.Context, string) error
 	GetContainerHostPath(context.Context, string, string) (string, error)
 	Start(context.Context, *dockerlib.Container, string) (chan bool, error)
+	Shutdown(context.Context, dockerlib.Container) error
+	Remove(context.Context, dockerlib.Container) error
 	ShutdownAll(ctx context.Context) error
 }
 
 type Function interface {
 	Name() string
+	Qualifier() string
 	EnvVars() []string
 	HandlerCmd() []string
 	AwsRuntime() aws.Runtime
@@ -46,34 +69,182 @@ type Manager struct {
 	// pool of ports available for use
 	ports IntPool
 
-	// map of running lambdas (name) and their hostname:port
-	running map[string]string
+	// map of running lambdas (name or name:version) and their container, port & hostname:port
+	running map[string]runningFunction
+
+	// guards running since functions are started, stopped & invoked concurrently
+	lock sync.RWMutex
+
+	// mutex for each key in running, which serializes starting & replacing its container so that a Function can't
+	// be started or swapped twice, without holding up other Functions
+	replacing sync.Map
+
+	// number of containers that each directory is mounted into, guarded by lock
+	mounts map[string]int
 
-	docker Docker
+	docker       Docker
+	functionRepo domain.FunctionRepository
+	aliasRepo    domain.AliasRepository
+
+	// queues the events of asynchronous invocations
+	async *async.Manager
 }
 
-func NewManager(cfg *settings.Config) (*Manager, error) {
+type runningFunction struct {
+	container  dockerlib.Container
+	port       int
+	uri        string
+	generation int
+
+	// directories of the Function's code & Layers that are mounted into the container
+	mounts []string
+
+	// invocations currently being proxied to the container
+	inFlight *sync.WaitGroup
+}
+
+func NewManager(cfg *settings.Config, functionRepo domain.FunctionRepository,
+	aliasRepo domain.AliasRepository, async *async.Manager) (*Manager, error) {
+
 	ports := NewIntPool(cfg.BasePort+1, cfg.BasePort+51)
-	running := make(map[string]string)
+	running := make(map[string]runningFunction)
 	docker, err := dockerlib.NewDockerController()
 	if err != nil {
 		return nil, err
 	}
 
 	return &Manager{
-		cfg:     cfg,
-		docker:  docker,
-		ports:   ports,
-		running: running,
+		cfg:          cfg,
+		docker:       docker,
+		functionRepo: functionRepo,
+		aliasRepo:    aliasRepo,
+		async:        async,
+		ports:        ports,
+		running:      running,
+		mounts:       make(map[string]int),
 	}, nil
 }
 
-func (m Manager) StartFunction(ctx context.Context, function Function) error {
+// replaceLock returns the mutex that serializes starting & replacing the container for the key in running.
+func (m *Manager) replaceLock(key string) *sync.Mutex {
+	lock, _ := m.replacing.LoadOrStore(key, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// runningKey is the key in running for the specified Function name & qualifier ($LATEST or a published version).
+func runningKey(name string, qualifier string) string {
+	if qualifier == "" || qualifier == domain.LatestVersion {
+		return name
+	}
+
+	return name + ":" + qualifier
+}
+
+// containerName is the base name of the container for the Function, which can't contain a colon.
+func containerName(function Function) string {
+	if function.Qualifier() == domain.LatestVersion {
+		return function.Name()
+	}
+
+	return function.Name() + "-v" + function.Qualifier()
+}
+
+func (m *Manager) StartFunction(ctx context.Context, function Function) error {
+	running, err := m.startContainer(ctx, function, containerName(function))
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	m.running[runningKey(function.Name(), function.Qualifier())] = running
+	m.lock.Unlock()
+
+	return nil
+}
+
+// ReplaceFunction starts a new container for the Function and only swaps it in once it is ready to be invoked. The
+// previous container is stopped in the background after its in-flight invocations have finished, and then the
+// retired directories (of code or Layers that the Function no longer uses) are removed.
+func (m *Manager) ReplaceFunction(ctx context.Context, function Function, retired ...string) error {
+	key := runningKey(function.Name(), function.Qualifier())
+
+	lock := m.replaceLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	m.lock.RLock()
+	previous, ok := m.running[key]
+	m.lock.RUnlock()
+
+	if !ok {
+		logger.Infof("Function %s is not running, so starting it instead of replacing", key)
+		err := m.StartFunction(ctx, function)
+		if err != nil {
+			return err
+		}
+
+		m.removeUnmounted(retired)
+		return nil
+	}
+
+	generation := previous.generation + 1
+	name := fmt.Sprintf("%s-%d", containerName(function), generation)
+	running, err := m.startContainer(ctx, function, name)
+	if err != nil {
+		return err
+	}
+	running.generation = generation
+
+	err = m.waitUntilReady(ctx, running)
+	if err != nil {
+		msg := fmt.Sprintf("Replacement for Function %s never became ready: %v", function.Name(), err)
+		logger.Error(msg)
+		m.stopContainer(ctx, function.Name(), running)
+		return errors.New(msg)
+	}
+
+	logger.Infof("Swapping container for Function %s from %s to %s", function.Name(), previous.container.Name,
+		running.container.Name)
+
+	m.lock.Lock()
+	m.running[key] = running
+	m.lock.Unlock()
+
+	go func() {
+		m.stopContainer(context.Background(), key, previous)
+		m.removeUnmounted(retired)
+	}()
+
+	return nil
+}
+
+// removeUnmounted removes the directories that aren't mounted into any container, since the same revision of a
+// Function's code may have been deployed again before the container using it was stopped.
+func (m *Manager) removeUnmounted(dirs []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, dir := range dirs {
+		if m.mounts[dir] > 0 {
+			logger.Infof("Not removing %s since it is still mounted", dir)
+			continue
+		}
+
+		logger.Infof("Removing %s since it is no longer used", dir)
+		err := os.RemoveAll(dir)
+		if err != nil {
+			logger.Errorf("Unable to remove %s: %v", dir, err)
+		}
+	}
+}
+
+func (m *Manager) startContainer(ctx context.Context, function Function, containerName string) (runningFunction, error) {
+	var running runningFunction
 	port, err := m.ports.Get(ctx)
 	if err != nil {
 		msg := fmt.Sprintf("Unable to start Function %s: %v", function.Name(), err)
 		logger.Error(msg)
-		return errors.New(msg)
+		return running, errors.New(msg)
 	}
 
 	logger.Infof("Ensuring image exists for Function %s", function.Name())
@@ -81,7 +252,8 @@ func (m Manager) StartFunction(ctx context.Context, function Function) error {
 	if err != nil {
 		msg := fmt.Sprintf("Unable to Ensure that Image exists for Function %s: %v", function.Name(), err)
 		logger.Error(msg)
-		return err
+		m.ports.Put(port)
+		return running, err
 	}
 
 	logger.Infof("Starting Function %s on port %d using handler %v", function.Name(), port, function.HandlerCmd())
@@ -100,7 +272,8 @@ func (m Manager) StartFunction(ctx context.Context, function Function) error {
 		if err != nil {
 			e := fmt.Errorf("unable to get host path for %s: %v", m.cfg.DataPath(), err)
 			logger.Error(e)
-			return e
+			m.ports.Put(port)
+			return running, e
 		}
 
 		destPath = strings.Replace(destPath, basePath, hostPath, 1)
@@ -108,7 +281,7 @@ func (m Manager) StartFunction(ctx context.Context, function Function) error {
 	}
 
 	container := dockerlib.Container{
-		Name:    function.Name(),
+		Name:    containerName,
 		Image:   imageMap[function.AwsRuntime()],
 		Command: function.HandlerCmd(),
 		Mounts: []mount.Mount{
@@ -138,45 +311,229 @@ func (m Manager) StartFunction(ctx context.Context, function Function) error {
 	if err != nil {
 		msg := fmt.Sprintf("Unable to start Function %s: %v", function.Name(), err)
 		logger.Error(msg)
-		return errors.New(msg)
+		m.ports.Put(port)
+		return running, errors.New(msg)
 	}
 
 	var uri string
 	if m.cfg.IsLocal {
 		uri = fmt.Sprintf("http://localhost:%d", port)
 	} else {
-		uri = fmt.Sprintf("http://%s:9001", function.Name())
+		uri = fmt.Sprintf("http://%s:9001", containerName)
 	}
 
-	m.running[function.Name()] = uri
+	running = runningFunction{
+		container: container,
+		port:      port,
+		uri:       uri,
+		mounts:    []string{function.GetDestPath(m.cfg), function.GetLayerDestPath(m.cfg)},
+		inFlight:  &sync.WaitGroup{},
+	}
 
-	return nil
+	m.lock.Lock()
+	for _, dir := range running.mounts {
+		m.mounts[dir]++
+	}
+	m.lock.Unlock()
+
+	return running, nil
 }
 
-func (m Manager) Invoke(writer http.ResponseWriter, request *http.Request) {
-	name := chi.URLParam(request, "name")
-	logger.Infof("Invoking Function %s", name)
+// waitUntilReady polls the container until its Lambda API responds to any HTTP request.
+func (m *Manager) waitUntilReady(ctx context.Context, running runningFunction) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	for {
+		request, err := http.NewRequestWithContext(timeoutCtx, http.MethodGet, running.uri, nil)
+		if err != nil {
+			return err
+		}
+
+		response, err := http.DefaultClient.Do(request)
+		if err == nil {
+			response.Body.Close()
+			return nil
+		}
+
+		logger.Debugf("Container %s not ready yet: %v", running.container.Name, err)
+
+		select {
+		case <-timeoutCtx.Done():
+			return timeoutCtx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+// StopFunction shuts down & removes the containers for $LATEST and all published versions of the named Function,
+// and returns their ports to the pool.
+func (m *Manager) StopFunction(ctx context.Context, name string) error {
+	m.lock.Lock()
+	stopping := make(map[string]runningFunction)
+	for key, running := range m.running {
+		if key == name || strings.HasPrefix(key, name+":") {
+			stopping[key] = running
+			delete(m.running, key)
+		}
+	}
+	m.lock.Unlock()
+
+	if len(stopping) == 0 {
+		logger.Infof("Function %s is not running, so not stopping it", name)
+		return nil
+	}
+
+	var err error
+	for key, running := range stopping {
+		e := m.stopContainer(ctx, key, running)
+		if e != nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// StopFunctionVersion shuts down & removes the container for a published version of the named Function.
+func (m *Manager) StopFunctionVersion(ctx context.Context, name string, version string) error {
+	key := runningKey(name, version)
+
+	m.lock.Lock()
+	running, ok := m.running[key]
+	delete(m.running, key)
+	m.lock.Unlock()
 
-	host, ok := m.running[name]
 	if !ok {
-		msg := fmt.Sprintf("Function %s is not running", name)
+		logger.Infof("Function %s is not running, so not stopping it", key)
+		return nil
+	}
+
+	return m.stopContainer(ctx, key, running)
+}
+
+// stopContainer waits for in-flight invocations to finish before shutting down & removing the container, and then
+// returns its port to the pool & releases its directories.
+func (m *Manager) stopContainer(ctx context.Context, name string, running runningFunction) error {
+	drained := make(chan struct{})
+	go func() {
+		running.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(drainTimeout):
+		logger.Warnf("Timed out waiting for invocations of Function %s to finish on %s", name,
+			running.container.Name)
+	}
+
+	logger.Infof("Stopping container %s for Function %s", running.container.Name, name)
+
+	err := m.docker.Shutdown(ctx, running.container)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to stop Function %s: %v", name, err)
+		logger.Error(msg)
+		return errors.New(msg)
+	}
+
+	err = m.docker.Remove(ctx, running.container)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to remove container for Function %s: %v", name, err)
+		logger.Error(msg)
+		return errors.New(msg)
+	}
+
+	m.ports.Put(running.port)
+
+	m.lock.Lock()
+	for _, dir := range running.mounts {
+		m.mounts[dir]--
+		if m.mounts[dir] <= 0 {
+			delete(m.mounts, dir)
+		}
+	}
+	m.lock.Unlock()
+
+	return nil
+}
+
+func (m *Manager) Invoke(writer http.ResponseWriter, request *http.Request) {
+	// the router matches the escaped path, so SDKs' escaped ARNs & qualifiers need to be unescaped
+	value, err := url.PathUnescape(chi.URLParam(request, "name"))
+	if err != nil {
+		msg := fmt.Sprintf("Invalid Function name %s: %v", chi.URLParam(request, "name"), err)
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusBadRequest)
+		return
+	}
+
+	name, qualifier := domain.ParseFunctionName(value)
+	if value := request.URL.Query().Get("Qualifier"); value != "" {
+		qualifier = value
+	}
+
+	// Aliases are resolved when the event is attempted, so that the Alias' invoke config applies
+	if request.Header.Get("X-Amz-Invocation-Type") == invocationTypeEvent {
+		m.invokeAsync(writer, request, name, qualifier)
+		return
+	}
+
+	ctx := request.Context()
+
+	qualifier, err = m.resolveAlias(ctx, name, qualifier)
+	switch {
+	case err == sql.ErrNoRows:
+		msg := fmt.Sprintf("Function %s not found", runningKey(name, qualifier))
 		logger.Errorf(msg)
 		http.Error(writer, msg, http.StatusNotFound)
 		return
+	case err != nil:
+		msg := fmt.Sprintf("Unable to resolve Alias %s of Function %s: %v", qualifier, name, err)
+		logger.Errorf(msg)
+		http.Error(writer, msg, http.StatusInternalServerError)
+		return
 	}
 
-	proxyReq, _ := http.NewRequest(request.Method, host+request.URL.Path, request.Body)
+	key := runningKey(name, qualifier)
+	logger.Infof("Invoking Function %s", key)
+
+	running, err := m.acquire(ctx, name, qualifier)
+	switch {
+	case err == sql.ErrNoRows:
+		msg := fmt.Sprintf("Function %s not found", key)
+		logger.Errorf(msg)
+		http.Error(writer, msg, http.StatusNotFound)
+		return
+	case err != nil:
+		msg := fmt.Sprintf("Unable to start Function %s: %v", key, err)
+		logger.Errorf(msg)
+		http.Error(writer, msg, http.StatusInternalServerError)
+		return
+	case running == nil:
+		msg := fmt.Sprintf("Function %s is not running", key)
+		logger.Errorf(msg)
+		http.Error(writer, msg, http.StatusNotFound)
+		return
+	}
+	defer running.inFlight.Done()
+
+	requestId := uuid.New().String()
+	writer.Header().Set("X-Amzn-Requestid", requestId)
+
+	proxyReq, _ := http.NewRequest(request.Method, running.uri+request.URL.Path, request.Body)
 
 	client := &http.Client{}
 	resp, err := client.Do(proxyReq)
 	if err != nil {
-		msg := fmt.Sprintf("Unable to invoke Function %s: %v", name, err)
+		msg := fmt.Sprintf("Unable to invoke Function %s: %v", key, err)
 		logger.Error(msg)
 		http.Error(writer, msg, http.StatusInternalServerError)
 		return
 	}
+	defer resp.Body.Close()
 
-	logger.Debugf("Got following response when invoking Function %s: %+v", name, resp)
+	logger.Debugf("Got following response when invoking Function %s: %+v", key, resp)
 
 	for key, value := range resp.Header {
 		for _, v := range value {
@@ -185,10 +542,164 @@ func (m Manager) Invoke(writer http.ResponseWriter, request *http.Request) {
 
 	}
 
+	if qualifier == "" {
+		qualifier = domain.LatestVersion
+	}
+	writer.Header().Set("X-Amz-Executed-Version", qualifier)
+	writer.Header().Set("X-Amzn-Requestid", requestId)
 	writer.WriteHeader(resp.StatusCode)
 
 	io.Copy(writer, resp.Body)
-	resp.Body.Close()
+}
+
+// invokeAsync queues the event for the Function & responds straight away, leaving the async Manager to invoke it.
+func (m *Manager) invokeAsync(writer http.ResponseWriter, request *http.Request, name string, qualifier string) {
+	key := runningKey(name, qualifier)
+
+	event, err := io.ReadAll(request.Body)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to read event for Function %s: %v", key, err)
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusBadRequest)
+		return
+	}
+
+	requestId, err := m.async.Enqueue(request.Context(), name, qualifier, event)
+	switch {
+	case err == sql.ErrNoRows:
+		msg := fmt.Sprintf("Function %s not found", key)
+		logger.Errorf(msg)
+		http.Error(writer, msg, http.StatusNotFound)
+		return
+	case err != nil:
+		msg := fmt.Sprintf("Unable to queue event for Function %s: %v", key, err)
+		logger.Errorf(msg)
+		http.Error(writer, msg, http.StatusInternalServerError)
+		return
+	}
+
+	logger.Infof("Queued request %s for Function %s", requestId, key)
+
+	writer.Header().Set("X-Amzn-Requestid", requestId)
+	writer.WriteHeader(http.StatusAccepted)
+}
+
+// resolveAlias returns the version to invoke when the qualifier is an Alias, picking between its versions by weight.
+// Other qualifiers are returned unchanged.
+func (m *Manager) resolveAlias(ctx context.Context, name string, qualifier string) (string, error) {
+	if qualifier == "" || qualifier == domain.LatestVersion {
+		return qualifier, nil
+	}
+
+	if _, err := strconv.Atoi(qualifier); err == nil {
+		return qualifier, nil
+	}
+
+	alias, err := m.aliasRepo.GetAlias(ctx, name, qualifier)
+	if err != nil {
+		return qualifier, err
+	}
+
+	version := alias.PickVersion(rand.Float64())
+	logger.Infof("Alias %s of Function %s routed to version %s", alias.Name, name, version)
+
+	return version, nil
+}
+
+// acquire returns the running container for the Function & qualifier, and marks an invocation as in-flight. Published
+// versions are started on demand, while $LATEST must already be running (nil is returned otherwise).
+func (m *Manager) acquire(ctx context.Context, name string, qualifier string) (*runningFunction, error) {
+	key := runningKey(name, qualifier)
+
+	m.lock.RLock()
+	running, ok := m.running[key]
+	if ok {
+		running.inFlight.Add(1)
+	}
+	m.lock.RUnlock()
+
+	if ok {
+		return &running, nil
+	}
+
+	if key == name {
+		return nil, nil
+	}
+
+	version, err := strconv.Atoi(qualifier)
+	if err != nil {
+		logger.Infof("Qualifier %s for Function %s is not a version", qualifier, name)
+		return nil, sql.ErrNoRows
+	}
+
+	err = m.startVersion(ctx, name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.acquire(ctx, name, qualifier)
+}
+
+// startVersion starts a container for the published version of the Function (if not already running) and waits
+// until it is ready to be invoked.
+func (m *Manager) startVersion(ctx context.Context, name string, version int) error {
+	key := runningKey(name, strconv.Itoa(version))
+
+	lock := m.replaceLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	m.lock.RLock()
+	_, ok := m.running[key]
+	m.lock.RUnlock()
+
+	if ok {
+		return nil
+	}
+
+	function, err := m.functionRepo.GetFunctionVersion(ctx, name, version)
+	if err != nil {
+		return err
+	}
+
+	// the highest version is $LATEST and isn't a published version
+	if function.Latest {
+		logger.Infof("Version %d of Function %s is $LATEST, so not a published version", version, name)
+		return sql.ErrNoRows
+	}
+
+	layers, err := m.functionRepo.GetLayersForFunction(ctx, *function)
+	if err != nil {
+		return err
+	}
+	function.Layers = layers
+
+	err = function.MoveLegacyPaths(m.cfg)
+	if err != nil {
+		logger.Errorf("Unable to move files of version %d of Function %s: %v", version, name, err)
+		return err
+	}
+
+	logger.Infof("Starting published version %d of Function %s on demand", version, name)
+
+	running, err := m.startContainer(ctx, function, containerName(function))
+	if err != nil {
+		return err
+	}
+
+	err = m.waitUntilReady(ctx, running)
+	if err != nil {
+		msg := fmt.Sprintf("Function %s never became ready: %v", key, err)
+		logger.Error(msg)
+		m.stopContainer(ctx, key, running)
+		return errors.New(msg)
+	}
+
+	m.lock.Lock()
+	m.running[key] = running
+	m.lock.Unlock()
+
+	return nil
 }
 
 func (m *Manager) EnsureRuntime(ctx context.Context, name aws.Runtime) error {
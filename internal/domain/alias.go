@@ -0,0 +1,145 @@
+package domain
+
+import (
+	"context"
+	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	aws "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/uuid"
+	"sort"
+)
+
+// Alias is a named pointer to a version of a Function, optionally routing a share of invocations to a second version.
+type Alias struct {
+	ID              int64
+	FunctionName    string
+	Name            string
+	FunctionVersion string
+	Description     string
+	RevisionId      string
+
+	// additional version and the fraction (0.0 - 1.0) of invocations routed to it
+	AdditionalVersionWeights map[string]float64
+}
+
+type AliasRepository interface {
+	InsertAlias(ctx context.Context, alias *Alias) error
+	GetAlias(ctx context.Context, functionName string, name string) (*Alias, error)
+	GetAliasesForFunction(ctx context.Context, functionName string) ([]Alias, error)
+	UpdateAlias(ctx context.Context, alias *Alias) error
+	DeleteAlias(ctx context.Context, functionName string, name string) error
+}
+
+func CreateAlias(functionName string, input *lambda.CreateAliasInput) *Alias {
+	alias := Alias{
+		FunctionName:    functionName,
+		Name:            stringOrEmpty(input.Name),
+		FunctionVersion: stringOrEmpty(input.FunctionVersion),
+		Description:     stringOrEmpty(input.Description),
+		RevisionId:      uuid.NewString(),
+	}
+
+	if input.RoutingConfig != nil {
+		alias.AdditionalVersionWeights = input.RoutingConfig.AdditionalVersionWeights
+	}
+
+	return &alias
+}
+
+// ApplyUpdate changes the Alias for every field set in the input, and assigns a new RevisionId.
+func (a *Alias) ApplyUpdate(input *lambda.UpdateAliasInput) {
+	if input.FunctionVersion != nil {
+		a.FunctionVersion = *input.FunctionVersion
+	}
+
+	if input.Description != nil {
+		a.Description = *input.Description
+	}
+
+	if input.RoutingConfig != nil {
+		a.AdditionalVersionWeights = input.RoutingConfig.AdditionalVersionWeights
+	}
+
+	a.RevisionId = uuid.NewString()
+}
+
+// PickVersion chooses the version to invoke given a uniformly distributed number in [0.0, 1.0), so that each
+// additional version receives its weight of invocations and FunctionVersion receives the remainder.
+func (a Alias) PickVersion(random float64) string {
+	versions := make([]string, 0, len(a.AdditionalVersionWeights))
+	for version := range a.AdditionalVersionWeights {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	total := 0.0
+	for _, version := range versions {
+		total += a.AdditionalVersionWeights[version]
+		if random < total {
+			return version
+		}
+	}
+
+	return a.FunctionVersion
+}
+
+func (a Alias) GetArn(cfg *settings.Config) *string {
+	result := "arn:aws:lambda:" + cfg.Region + ":" + cfg.AccountNumber + ":function:" + a.FunctionName + ":" + a.Name
+	return &result
+}
+
+func (a Alias) routingConfig() *aws.AliasRoutingConfiguration {
+	if len(a.AdditionalVersionWeights) == 0 {
+		return nil
+	}
+
+	return &aws.AliasRoutingConfiguration{AdditionalVersionWeights: a.AdditionalVersionWeights}
+}
+
+func (a Alias) ToAliasConfiguration(cfg *settings.Config) aws.AliasConfiguration {
+	return aws.AliasConfiguration{
+		AliasArn:        a.GetArn(cfg),
+		Description:     &a.Description,
+		FunctionVersion: &a.FunctionVersion,
+		Name:            &a.Name,
+		RevisionId:      &a.RevisionId,
+		RoutingConfig:   a.routingConfig(),
+	}
+}
+
+func (a Alias) ToCreateAliasOutput(cfg *settings.Config) *lambda.CreateAliasOutput {
+	return &lambda.CreateAliasOutput{
+		AliasArn:        a.GetArn(cfg),
+		Description:     &a.Description,
+		FunctionVersion: &a.FunctionVersion,
+		Name:            &a.Name,
+		RevisionId:      &a.RevisionId,
+		RoutingConfig:   a.routingConfig(),
+		ResultMetadata:  middleware.Metadata{},
+	}
+}
+
+func (a Alias) ToGetAliasOutput(cfg *settings.Config) *lambda.GetAliasOutput {
+	return &lambda.GetAliasOutput{
+		AliasArn:        a.GetArn(cfg),
+		Description:     &a.Description,
+		FunctionVersion: &a.FunctionVersion,
+		Name:            &a.Name,
+		RevisionId:      &a.RevisionId,
+		RoutingConfig:   a.routingConfig(),
+		ResultMetadata:  middleware.Metadata{},
+	}
+}
+
+func (a Alias) ToUpdateAliasOutput(cfg *settings.Config) *lambda.UpdateAliasOutput {
+	return &lambda.UpdateAliasOutput{
+		AliasArn:        a.GetArn(cfg),
+		Description:     &a.Description,
+		FunctionVersion: &a.FunctionVersion,
+		Name:            &a.Name,
+		RevisionId:      &a.RevisionId,
+		RoutingConfig:   a.routingConfig(),
+		ResultMetadata:  middleware.Metadata{},
+	}
+}
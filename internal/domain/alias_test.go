@@ -0,0 +1,26 @@
+package domain_test
+
+import (
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPickVersionWithoutRouting(t *testing.T) {
+	alias := domain.Alias{FunctionVersion: "1"}
+
+	assert.Equal(t, "1", alias.PickVersion(0.0))
+	assert.Equal(t, "1", alias.PickVersion(0.99))
+}
+
+func TestPickVersionWithWeights(t *testing.T) {
+	alias := domain.Alias{
+		FunctionVersion:          "1",
+		AdditionalVersionWeights: map[string]float64{"2": 0.25},
+	}
+
+	assert.Equal(t, "2", alias.PickVersion(0.0))
+	assert.Equal(t, "2", alias.PickVersion(0.24))
+	assert.Equal(t, "1", alias.PickVersion(0.25))
+	assert.Equal(t, "1", alias.PickVersion(0.99))
+}
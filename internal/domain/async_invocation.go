@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"context"
+)
+
+// AsyncInvocation is the event of an asynchronous invocation, which is queued until the Function processes it or it
+// is dropped after its retries.
+type AsyncInvocation struct {
+	ID           int64
+	RequestId    string
+	FunctionName string
+	Qualifier    string
+	Payload      []byte
+	Attempts     int
+
+	// millis since the epoch when the event was queued & when it should next be attempted
+	Created     int64
+	NextAttempt int64
+
+	// status code & message of the last failed attempt
+	ErrorCode    int
+	ErrorMessage string
+}
+
+type AsyncInvocationRepository interface {
+	InsertAsyncInvocation(ctx context.Context, invocation *AsyncInvocation) error
+	GetDueAsyncInvocations(ctx context.Context, now int64, limit int) ([]AsyncInvocation, error)
+	UpdateAsyncInvocation(ctx context.Context, invocation *AsyncInvocation) error
+	DeleteAsyncInvocation(ctx context.Context, id int64) error
+}
+
+// Target is the name of the Function with its qualifier, if it has one, for invoking it through the API.
+func (invocation AsyncInvocation) Target() string {
+	if invocation.Qualifier == "" || invocation.Qualifier == LatestVersion {
+		return invocation.FunctionName
+	}
+
+	return invocation.FunctionName + ":" + invocation.Qualifier
+}
@@ -21,6 +21,10 @@ func (d DevFunction) Name() string {
 	return d.name
 }
 
+func (d DevFunction) Qualifier() string {
+	return LatestVersion
+}
+
 func (d *DevFunction) SetName(name string) {
 	d.name = name
 }
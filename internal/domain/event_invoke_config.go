@@ -0,0 +1,182 @@
+package domain
+
+import (
+	"context"
+	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"strings"
+	"time"
+)
+
+const (
+	// like AWS, asynchronous invocations are retried twice & dropped after six hours by default
+	DefaultMaximumRetryAttempts     = 2
+	DefaultMaximumEventAgeInSeconds = 21600
+)
+
+// EventInvokeConfig configures the retries & destinations of asynchronous invocations for a Function, or for a
+// version or Alias of it.
+type EventInvokeConfig struct {
+	FunctionName string
+	Qualifier    string
+
+	// nil when not configured, in which case the defaults apply
+	MaximumRetryAttempts     *int32
+	MaximumEventAgeInSeconds *int32
+
+	// ARNs of the destinations for successful & failed invocations, or empty if there isn't one
+	OnSuccess string
+	OnFailure string
+
+	// millis since the epoch
+	LastModified int64
+}
+
+type EventInvokeConfigRepository interface {
+	PutEventInvokeConfig(ctx context.Context, config *EventInvokeConfig) error
+	GetEventInvokeConfig(ctx context.Context, name string, qualifier string) (*EventInvokeConfig, error)
+	GetEventInvokeConfigs(ctx context.Context, name string) ([]EventInvokeConfig, error)
+	DeleteEventInvokeConfig(ctx context.Context, name string, qualifier string) error
+}
+
+// FunctionEventInvokeConfig is the response for an EventInvokeConfig, whose LastModified is sent as seconds since the
+// epoch rather than the SDK's time.
+type FunctionEventInvokeConfig struct {
+	types.FunctionEventInvokeConfig
+	LastModified float64
+}
+
+type ListFunctionEventInvokeConfigsOutput struct {
+	FunctionEventInvokeConfigs []FunctionEventInvokeConfig
+	NextMarker                 *string
+}
+
+// PutEventInvokeConfig creates the config for the Function & qualifier from a Put request, which replaces any
+// existing config.
+func PutEventInvokeConfig(name string, qualifier string,
+	input *lambda.PutFunctionEventInvokeConfigInput) *EventInvokeConfig {
+
+	config := EventInvokeConfig{
+		FunctionName:             name,
+		Qualifier:                qualifier,
+		MaximumRetryAttempts:     input.MaximumRetryAttempts,
+		MaximumEventAgeInSeconds: input.MaximumEventAgeInSeconds,
+		LastModified:             time.Now().UnixMilli(),
+	}
+
+	config.updateDestinations(input.DestinationConfig)
+
+	return &config
+}
+
+// Update applies an Update request, which only changes the settings that it includes.
+func (c *EventInvokeConfig) Update(input *lambda.UpdateFunctionEventInvokeConfigInput) {
+	if input.MaximumRetryAttempts != nil {
+		c.MaximumRetryAttempts = input.MaximumRetryAttempts
+	}
+
+	if input.MaximumEventAgeInSeconds != nil {
+		c.MaximumEventAgeInSeconds = input.MaximumEventAgeInSeconds
+	}
+
+	c.updateDestinations(input.DestinationConfig)
+	c.LastModified = time.Now().UnixMilli()
+}
+
+// updateDestinations sets the destinations that are included, where an empty Destination removes one.
+func (c *EventInvokeConfig) updateDestinations(destinations *types.DestinationConfig) {
+	if destinations == nil {
+		return
+	}
+
+	if destinations.OnSuccess != nil {
+		c.OnSuccess = stringOrEmpty(destinations.OnSuccess.Destination)
+	}
+
+	if destinations.OnFailure != nil {
+		c.OnFailure = stringOrEmpty(destinations.OnFailure.Destination)
+	}
+}
+
+// RetryAttempts returns the number of times to retry a failed invocation.
+func (c *EventInvokeConfig) RetryAttempts() int {
+	if c == nil {
+		return DefaultMaximumRetryAttempts
+	}
+
+	return int(int32OrDefault(c.MaximumRetryAttempts, DefaultMaximumRetryAttempts))
+}
+
+// MaximumEventAge returns how long an event is kept for before it is dropped.
+func (c *EventInvokeConfig) MaximumEventAge() time.Duration {
+	if c == nil {
+		return DefaultMaximumEventAgeInSeconds * time.Second
+	}
+
+	return time.Duration(int32OrDefault(c.MaximumEventAgeInSeconds, DefaultMaximumEventAgeInSeconds)) * time.Second
+}
+
+// Destination returns the ARN of the destination for successful or failed invocations, or empty if there isn't one.
+// A nil config has no destinations.
+func (c *EventInvokeConfig) Destination(success bool) string {
+	switch {
+	case c == nil:
+		return ""
+	case success:
+		return c.OnSuccess
+	default:
+		return c.OnFailure
+	}
+}
+
+// DestinationService returns the service of a destination ARN that invocation records can be sent to, which is a
+// Function (lambda), queue (sqs) or event bus (events). Empty is returned for any other ARN.
+func DestinationService(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+
+	switch parts[2] {
+	case "lambda", "sqs", "events":
+		return parts[2]
+	default:
+		return ""
+	}
+}
+
+func (c EventInvokeConfig) GetArn(cfg *settings.Config) *string {
+	result := "arn:aws:lambda:" + cfg.Region + ":" + cfg.AccountNumber + ":function:" + c.FunctionName + ":" +
+		c.Qualifier
+	return &result
+}
+
+func (c EventInvokeConfig) destinationConfig() *types.DestinationConfig {
+	config := types.DestinationConfig{
+		OnFailure: &types.OnFailure{},
+		OnSuccess: &types.OnSuccess{},
+	}
+
+	if c.OnFailure != "" {
+		config.OnFailure.Destination = &c.OnFailure
+	}
+
+	if c.OnSuccess != "" {
+		config.OnSuccess.Destination = &c.OnSuccess
+	}
+
+	return &config
+}
+
+func (c EventInvokeConfig) ToFunctionEventInvokeConfig(cfg *settings.Config) FunctionEventInvokeConfig {
+	return FunctionEventInvokeConfig{
+		FunctionEventInvokeConfig: types.FunctionEventInvokeConfig{
+			DestinationConfig:        c.destinationConfig(),
+			FunctionArn:              c.GetArn(cfg),
+			MaximumEventAgeInSeconds: c.MaximumEventAgeInSeconds,
+			MaximumRetryAttempts:     c.MaximumRetryAttempts,
+		},
+		LastModified: float64(c.LastModified) / 1000,
+	}
+}
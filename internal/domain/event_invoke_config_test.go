@@ -0,0 +1,99 @@
+package domain_test
+
+import (
+	"encoding/json"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const queueArn = "arn:aws:sqs:us-west-2:271828182845:failures"
+
+func TestPutEventInvokeConfig(t *testing.T) {
+	input := lambda.PutFunctionEventInvokeConfigInput{
+		MaximumRetryAttempts: aws.Int32(1),
+		DestinationConfig: &types.DestinationConfig{
+			OnFailure: &types.OnFailure{Destination: aws.String(queueArn)},
+		},
+	}
+
+	config := domain.PutEventInvokeConfig("fn", "live", &input)
+
+	assert.Equal(t, "fn", config.FunctionName)
+	assert.Equal(t, "live", config.Qualifier)
+	assert.Equal(t, 1, config.RetryAttempts())
+	assert.Equal(t, 6*time.Hour, config.MaximumEventAge())
+	assert.Equal(t, queueArn, config.Destination(false))
+	assert.Equal(t, "", config.Destination(true))
+}
+
+func TestUpdateEventInvokeConfig(t *testing.T) {
+	config := domain.PutEventInvokeConfig("fn", "$LATEST", &lambda.PutFunctionEventInvokeConfigInput{
+		MaximumRetryAttempts: aws.Int32(1),
+		DestinationConfig: &types.DestinationConfig{
+			OnFailure: &types.OnFailure{Destination: aws.String(queueArn)},
+		},
+	})
+
+	config.Update(&lambda.UpdateFunctionEventInvokeConfigInput{
+		MaximumEventAgeInSeconds: aws.Int32(60),
+		DestinationConfig: &types.DestinationConfig{
+			OnSuccess: &types.OnSuccess{Destination: aws.String("arn:aws:lambda:us-west-2:271828182845:function:next")},
+		},
+	})
+
+	assert.Equal(t, 1, config.RetryAttempts())
+	assert.Equal(t, time.Minute, config.MaximumEventAge())
+	assert.Equal(t, queueArn, config.Destination(false))
+	assert.Equal(t, "arn:aws:lambda:us-west-2:271828182845:function:next", config.Destination(true))
+
+	// an empty destination removes it
+	config.Update(&lambda.UpdateFunctionEventInvokeConfigInput{
+		DestinationConfig: &types.DestinationConfig{OnFailure: &types.OnFailure{}},
+	})
+
+	assert.Equal(t, "", config.Destination(false))
+}
+
+func TestEventInvokeConfigDefaults(t *testing.T) {
+	var config *domain.EventInvokeConfig
+
+	assert.Equal(t, domain.DefaultMaximumRetryAttempts, config.RetryAttempts())
+	assert.Equal(t, 6*time.Hour, config.MaximumEventAge())
+	assert.Equal(t, "", config.Destination(true))
+	assert.Equal(t, "", config.Destination(false))
+}
+
+func TestDestinationService(t *testing.T) {
+	assert.Equal(t, "lambda", domain.DestinationService("arn:aws:lambda:us-west-2:271828182845:function:next"))
+	assert.Equal(t, "sqs", domain.DestinationService(queueArn))
+	assert.Equal(t, "events", domain.DestinationService("arn:aws:events:us-west-2:271828182845:event-bus/default"))
+	assert.Equal(t, "", domain.DestinationService("arn:aws:sns:us-west-2:271828182845:topic"))
+	assert.Equal(t, "", domain.DestinationService("failures"))
+}
+
+func TestFunctionEventInvokeConfigJson(t *testing.T) {
+	config := domain.EventInvokeConfig{
+		FunctionName:         "fn",
+		Qualifier:            "$LATEST",
+		MaximumRetryAttempts: aws.Int32(0),
+		OnFailure:            queueArn,
+		LastModified:         1646370367500,
+	}
+	cfg := &settings.Config{Region: "us-west-2", AccountNumber: "271828182845"}
+
+	payload, err := json.Marshal(config.ToFunctionEventInvokeConfig(cfg))
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(payload, &decoded))
+	assert.Equal(t, 1646370367.5, decoded["LastModified"])
+	assert.Equal(t, "arn:aws:lambda:us-west-2:271828182845:function:fn:$LATEST", decoded["FunctionArn"])
+	assert.Equal(t, float64(0), decoded["MaximumRetryAttempts"])
+	assert.Equal(t, queueArn, decoded["DestinationConfig"].(map[string]interface{})["OnFailure"].(map[string]interface{})["Destination"])
+}
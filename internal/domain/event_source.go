@@ -4,7 +4,9 @@ import (
 	"context"
 	"github.com/ATenderholt/rainbow-functions/settings"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
 	"github.com/google/uuid"
+	"strings"
 	"time"
 )
 
@@ -16,74 +18,515 @@ type EventSource struct {
 	Function     *Function
 	BatchSize    int32
 	LastModified int64
+
+	// the Alias of the Function that is invoked, if the Event Source is bound to one, in which case Function is $LATEST
+	FunctionAlias string
+
+	// ReportBatchItemFailures lets the Function report which records in a batch failed
+	FunctionResponseTypes []types.FunctionResponseType
+
+	// how long to wait for a full batch before invoking the Function with what has been received
+	MaximumBatchingWindowInSeconds int32
+
+	// JSON filter patterns, only records matching at least one are sent to the Function
+	FilterPatterns []string
+
+	// most pollers that can invoke the Function at once, or 0 for the default
+	MaximumConcurrency int32
+
+	// where to start reading shards of a stream that have no checkpoint, with a timestamp (in millis) for AT_TIMESTAMP
+	StartingPosition          types.EventSourcePosition
+	StartingPositionTimestamp int64
+
+	// split batches of stream records in two when the Function fails, to isolate the records that it fails on
+	BisectBatchOnFunctionError bool
+
+	// how many times a failed batch is retried & how old its records may be before they are discarded, or -1 for no
+	// limit, along with the SQS queue that discarded records are sent to, if any
+	MaximumRetryAttempts      int32
+	MaximumRecordAgeInSeconds int32
+	OnFailure                 string
+
+	// brokers & topics of self-managed Kafka, whose Event Sources don't have an ARN
+	BootstrapServers []string
+	Topics           []string
+
+	// reported by the poller rather than persisted
+	State                 string
+	StateTransitionReason string
+	LastProcessingResult  string
+}
+
+// ScalingConfig limits how many pollers may invoke the Function concurrently. The version of the SDK that is being
+// used predates it, so it is added to the inputs & outputs that include it.
+type ScalingConfig struct {
+	MaximumConcurrency *int32 `json:",omitempty"`
+}
+
+type EventSourceMappingConfiguration struct {
+	types.EventSourceMappingConfiguration
+	ScalingConfig *ScalingConfig `json:",omitempty"`
+}
+
+type CreateEventSourceMappingInput struct {
+	lambda.CreateEventSourceMappingInput
+	ScalingConfig *ScalingConfig
+
+	// the API sends seconds since the epoch, which the SDK's time can't be decoded from
+	StartingPositionTimestamp *float64
+}
+
+type CreateEventSourceMappingOutput struct {
+	lambda.CreateEventSourceMappingOutput
+	ScalingConfig *ScalingConfig `json:",omitempty"`
+}
+
+type GetEventSourceMappingOutput struct {
+	lambda.GetEventSourceMappingOutput
+	ScalingConfig *ScalingConfig `json:",omitempty"`
+}
+
+type ListEventSourceMappingsOutput struct {
+	EventSourceMappings []EventSourceMappingConfiguration
+	NextMarker          *string
+}
+
+type UpdateEventSourceMappingInput struct {
+	lambda.UpdateEventSourceMappingInput
+	ScalingConfig *ScalingConfig
+}
+
+type UpdateEventSourceMappingOutput struct {
+	lambda.UpdateEventSourceMappingOutput
+	ScalingConfig *ScalingConfig `json:",omitempty"`
+}
+
+type DeleteEventSourceMappingOutput struct {
+	lambda.DeleteEventSourceMappingOutput
+	ScalingConfig *ScalingConfig `json:",omitempty"`
+}
+
+// Checkpoint is the last record of a stream's shard that an Event Source has processed
+type Checkpoint struct {
+	ShardId        string
+	SequenceNumber string
+
+	// the shard has been closed & all of its records have been processed
+	Closed bool
 }
 
 type EventSourceRepository interface {
 	InsertEventSource(ctx context.Context, eventSource EventSource) error
 	GetAllEventSources(ctx context.Context) ([]EventSource, error)
 	GetEventSource(ctx context.Context, id string) (*EventSource, error)
+	UpdateEventSource(ctx context.Context, eventSource EventSource) error
+	DeleteEventSource(ctx context.Context, id string) error
+	GetCheckpoints(ctx context.Context, id string) (map[string]Checkpoint, error)
+	PutCheckpoint(ctx context.Context, id string, checkpoint Checkpoint) error
+}
+
+// EventSourceManager consumes the Event Sources of a service, i.e. SQS queues, Kinesis & DynamoDB streams or Kafka.
+type EventSourceManager interface {
+	CreateEventSource(ctx context.Context, eventSource *EventSource) error
+	StartEventSource(ctx context.Context, eventSource *EventSource) error
+	StopEventSource(id uuid.UUID)
+	RemoveEventSource(id uuid.UUID)
+	Describe(eventSource *EventSource)
+}
+
+// Service that the Event Source's ARN belongs to, such as sqs, kinesis or dynamodb, or kafka for self-managed Kafka.
+func (eventSource EventSource) Service() string {
+	if eventSource.IsKafka() {
+		return "kafka"
+	}
+
+	parts := strings.Split(eventSource.Arn, ":")
+	if len(parts) < 3 {
+		return ""
+	}
+
+	return parts[2]
+}
+
+// IsStream is true for Event Sources that are read shard by shard from a starting position.
+func (eventSource EventSource) IsStream() bool {
+	switch eventSource.Service() {
+	case "kinesis", "dynamodb":
+		return true
+	default:
+		return false
+	}
+}
+
+// IsKafka is true for Event Sources that consume topics from self-managed Kafka brokers.
+func (eventSource EventSource) IsKafka() bool {
+	return len(eventSource.BootstrapServers) > 0
+}
+
+// IsQueue is true for Event Sources that receive messages from SQS queues, which is any that isn't a stream or Kafka.
+func (eventSource EventSource) IsQueue() bool {
+	return !eventSource.IsStream() && !eventSource.IsKafka()
+}
+
+// ReportsBatchItemFailures is true when the Function returns the records that failed, instead of failing the batch.
+func (eventSource EventSource) ReportsBatchItemFailures() bool {
+	for _, responseType := range eventSource.FunctionResponseTypes {
+		if responseType == types.FunctionResponseTypeReportBatchItemFailures {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FilterPatternsFrom returns the patterns in the FilterCriteria of a create or update request.
+func FilterPatternsFrom(criteria *types.FilterCriteria) []string {
+	if criteria == nil {
+		return nil
+	}
+
+	patterns := make([]string, 0, len(criteria.Filters))
+	for _, filter := range criteria.Filters {
+		if filter.Pattern != nil {
+			patterns = append(patterns, *filter.Pattern)
+		}
+	}
+
+	return patterns
+}
+
+func (eventSource EventSource) filterCriteria() *types.FilterCriteria {
+	if len(eventSource.FilterPatterns) == 0 {
+		return nil
+	}
+
+	filters := make([]types.Filter, len(eventSource.FilterPatterns))
+	for i := range eventSource.FilterPatterns {
+		filters[i] = types.Filter{Pattern: &eventSource.FilterPatterns[i]}
+	}
+
+	return &types.FilterCriteria{Filters: filters}
+}
+
+func (eventSource EventSource) scalingConfig() *ScalingConfig {
+	if eventSource.MaximumConcurrency == 0 {
+		return nil
+	}
+
+	return &ScalingConfig{MaximumConcurrency: &eventSource.MaximumConcurrency}
+}
+
+func (eventSource EventSource) eventSourceArn() *string {
+	if eventSource.Arn == "" {
+		return nil
+	}
+
+	return &eventSource.Arn
+}
+
+func (eventSource EventSource) selfManagedEventSource() *types.SelfManagedEventSource {
+	if !eventSource.IsKafka() {
+		return nil
+	}
+
+	return &types.SelfManagedEventSource{
+		Endpoints: map[string][]string{
+			string(types.EndPointTypeKafkaBootstrapServers): eventSource.BootstrapServers,
+		},
+	}
 }
 
-func (eventSource EventSource) ToCreateEventSourceMappingOutput(cfg *settings.Config) lambda.CreateEventSourceMappingOutput {
+// FunctionQualifier is the Alias, published version or $LATEST version of the Function that the Event Source is
+// bound to.
+func (eventSource EventSource) FunctionQualifier() string {
+	if eventSource.FunctionAlias != "" {
+		return eventSource.FunctionAlias
+	}
+
+	return eventSource.Function.Qualifier()
+}
+
+// InvokedName is the name of the Function that the Event Source invokes, which is qualified by the Alias or published
+// version that it is bound to.
+func (eventSource EventSource) InvokedName() string {
+	if eventSource.FunctionAlias != "" {
+		return eventSource.Function.FunctionName + ":" + eventSource.FunctionAlias
+	}
+
+	return eventSource.Function.QualifiedName()
+}
+
+// functionArn is qualified by the Alias or published version that the Event Source is bound to, like AWS.
+func (eventSource EventSource) functionArn(cfg *settings.Config) *string {
+	if eventSource.FunctionAlias == "" {
+		return eventSource.Function.GetVersionArn(cfg)
+	}
+
+	arn := *eventSource.Function.GetArn(cfg) + ":" + eventSource.FunctionAlias
+	return &arn
+}
+
+// bisectBatchOnFunctionError is only reported for streams, like AWS.
+func (eventSource EventSource) bisectBatchOnFunctionError() *bool {
+	if !eventSource.IsStream() {
+		return nil
+	}
+
+	return &eventSource.BisectBatchOnFunctionError
+}
+
+// destinationConfig is reported for streams & queues, since Kafka Event Sources don't discard records.
+func (eventSource EventSource) destinationConfig() *types.DestinationConfig {
+	if eventSource.IsKafka() {
+		return nil
+	}
+
+	var onFailure types.OnFailure
+	if eventSource.OnFailure != "" {
+		onFailure.Destination = &eventSource.OnFailure
+	}
+
+	return &types.DestinationConfig{OnFailure: &onFailure}
+}
+
+// parallelizationFactor is only reported for streams, which each shard of is always processed by one poller.
+func (eventSource EventSource) parallelizationFactor() *int32 {
+	if !eventSource.IsStream() {
+		return nil
+	}
+
+	factor := int32(1)
+	return &factor
+}
+
+// tumblingWindowInSeconds is only reported for streams, which records are never aggregated over windows for.
+func (eventSource EventSource) tumblingWindowInSeconds() *int32 {
+	if !eventSource.IsStream() {
+		return nil
+	}
+
+	window := int32(0)
+	return &window
+}
+
+func (eventSource EventSource) maximumRetryAttempts() *int32 {
+	if eventSource.IsKafka() {
+		return nil
+	}
+
+	return &eventSource.MaximumRetryAttempts
+}
+
+func (eventSource EventSource) maximumRecordAgeInSeconds() *int32 {
+	if eventSource.IsKafka() {
+		return nil
+	}
+
+	return &eventSource.MaximumRecordAgeInSeconds
+}
+
+func (eventSource EventSource) startingPositionTimestamp() *time.Time {
+	if eventSource.StartingPositionTimestamp == 0 {
+		return nil
+	}
+
+	timestamp := time.UnixMilli(eventSource.StartingPositionTimestamp)
+	return &timestamp
+}
+
+func (eventSource EventSource) state() string {
+	switch {
+	case eventSource.State != "":
+		return eventSource.State
+	case eventSource.Enabled:
+		return "Enabled"
+	default:
+		return "Disabled"
+	}
+}
+
+func (eventSource EventSource) ToEventSourceMappingConfiguration(cfg *settings.Config) EventSourceMappingConfiguration {
 	id := eventSource.UUID.String()
 	lastModified := time.UnixMilli(eventSource.LastModified)
-	state := "Enabled"
+	state := eventSource.state()
+	var reason, result *string
+	if eventSource.StateTransitionReason != "" {
+		reason = &eventSource.StateTransitionReason
+	}
+	if eventSource.LastProcessingResult != "" {
+		result = &eventSource.LastProcessingResult
+	}
 
-	return lambda.CreateEventSourceMappingOutput{
+	c := types.EventSourceMappingConfiguration{
 		BatchSize:                      &eventSource.BatchSize,
-		BisectBatchOnFunctionError:     nil,
-		DestinationConfig:              nil,
-		EventSourceArn:                 &eventSource.Arn,
-		FilterCriteria:                 nil,
-		FunctionArn:                    eventSource.Function.GetArn(cfg),
-		FunctionResponseTypes:          nil,
+		BisectBatchOnFunctionError:     eventSource.bisectBatchOnFunctionError(),
+		DestinationConfig:              eventSource.destinationConfig(),
+		EventSourceArn:                 eventSource.eventSourceArn(),
+		FilterCriteria:                 eventSource.filterCriteria(),
+		FunctionArn:                    eventSource.functionArn(cfg),
+		FunctionResponseTypes:          eventSource.FunctionResponseTypes,
 		LastModified:                   &lastModified,
-		LastProcessingResult:           nil,
-		MaximumBatchingWindowInSeconds: nil,
-		MaximumRecordAgeInSeconds:      nil,
-		MaximumRetryAttempts:           nil,
-		ParallelizationFactor:          nil,
+		LastProcessingResult:           result,
+		MaximumBatchingWindowInSeconds: &eventSource.MaximumBatchingWindowInSeconds,
+		MaximumRecordAgeInSeconds:      eventSource.maximumRecordAgeInSeconds(),
+		MaximumRetryAttempts:           eventSource.maximumRetryAttempts(),
+		ParallelizationFactor:          eventSource.parallelizationFactor(),
 		Queues:                         nil,
-		SelfManagedEventSource:         nil,
+		SelfManagedEventSource:         eventSource.selfManagedEventSource(),
 		SourceAccessConfigurations:     nil,
-		StartingPosition:               "",
-		StartingPositionTimestamp:      nil,
+		StartingPosition:               eventSource.StartingPosition,
+		StartingPositionTimestamp:      eventSource.startingPositionTimestamp(),
 		State:                          &state,
-		StateTransitionReason:          nil,
-		Topics:                         nil,
-		TumblingWindowInSeconds:        nil,
+		StateTransitionReason:          reason,
+		Topics:                         eventSource.Topics,
+		TumblingWindowInSeconds:        eventSource.tumblingWindowInSeconds(),
 		UUID:                           &id,
 	}
+
+	return EventSourceMappingConfiguration{
+		EventSourceMappingConfiguration: c,
+		ScalingConfig:                   eventSource.scalingConfig(),
+	}
 }
 
-func (eventSource EventSource) ToGetEventSourceMappingOutput(cfg *settings.Config) lambda.GetEventSourceMappingOutput {
-	id := eventSource.UUID.String()
-	lastModified := time.UnixMilli(eventSource.LastModified)
-	state := "Enabled"
+func (eventSource EventSource) ToCreateEventSourceMappingOutput(cfg *settings.Config) CreateEventSourceMappingOutput {
+	c := eventSource.ToEventSourceMappingConfiguration(cfg)
 
-	return lambda.GetEventSourceMappingOutput{
-		BatchSize:                      &eventSource.BatchSize,
-		BisectBatchOnFunctionError:     nil,
-		DestinationConfig:              nil,
-		EventSourceArn:                 &eventSource.Arn,
-		FilterCriteria:                 nil,
-		FunctionArn:                    eventSource.Function.GetArn(cfg),
-		FunctionResponseTypes:          nil,
-		LastModified:                   &lastModified,
-		LastProcessingResult:           nil,
-		MaximumBatchingWindowInSeconds: nil,
-		MaximumRecordAgeInSeconds:      nil,
-		MaximumRetryAttempts:           nil,
-		ParallelizationFactor:          nil,
-		Queues:                         nil,
-		SelfManagedEventSource:         nil,
-		SourceAccessConfigurations:     nil,
-		StartingPosition:               "",
-		StartingPositionTimestamp:      nil,
+	output := lambda.CreateEventSourceMappingOutput{
+		BatchSize:                      c.BatchSize,
+		BisectBatchOnFunctionError:     c.BisectBatchOnFunctionError,
+		DestinationConfig:              c.DestinationConfig,
+		EventSourceArn:                 c.EventSourceArn,
+		FilterCriteria:                 c.FilterCriteria,
+		FunctionArn:                    c.FunctionArn,
+		FunctionResponseTypes:          c.FunctionResponseTypes,
+		LastModified:                   c.LastModified,
+		LastProcessingResult:           c.LastProcessingResult,
+		MaximumBatchingWindowInSeconds: c.MaximumBatchingWindowInSeconds,
+		MaximumRecordAgeInSeconds:      c.MaximumRecordAgeInSeconds,
+		MaximumRetryAttempts:           c.MaximumRetryAttempts,
+		ParallelizationFactor:          c.ParallelizationFactor,
+		Queues:                         c.Queues,
+		SelfManagedEventSource:         c.SelfManagedEventSource,
+		SourceAccessConfigurations:     c.SourceAccessConfigurations,
+		StartingPosition:               c.StartingPosition,
+		StartingPositionTimestamp:      c.StartingPositionTimestamp,
+		State:                          c.State,
+		StateTransitionReason:          c.StateTransitionReason,
+		Topics:                         c.Topics,
+		TumblingWindowInSeconds:        c.TumblingWindowInSeconds,
+		UUID:                           c.UUID,
+	}
+
+	return CreateEventSourceMappingOutput{
+		CreateEventSourceMappingOutput: output,
+		ScalingConfig:                  c.ScalingConfig,
+	}
+}
+
+func (eventSource EventSource) ToGetEventSourceMappingOutput(cfg *settings.Config) GetEventSourceMappingOutput {
+	c := eventSource.ToEventSourceMappingConfiguration(cfg)
+
+	output := lambda.GetEventSourceMappingOutput{
+		BatchSize:                      c.BatchSize,
+		BisectBatchOnFunctionError:     c.BisectBatchOnFunctionError,
+		DestinationConfig:              c.DestinationConfig,
+		EventSourceArn:                 c.EventSourceArn,
+		FilterCriteria:                 c.FilterCriteria,
+		FunctionArn:                    c.FunctionArn,
+		FunctionResponseTypes:          c.FunctionResponseTypes,
+		LastModified:                   c.LastModified,
+		LastProcessingResult:           c.LastProcessingResult,
+		MaximumBatchingWindowInSeconds: c.MaximumBatchingWindowInSeconds,
+		MaximumRecordAgeInSeconds:      c.MaximumRecordAgeInSeconds,
+		MaximumRetryAttempts:           c.MaximumRetryAttempts,
+		ParallelizationFactor:          c.ParallelizationFactor,
+		Queues:                         c.Queues,
+		SelfManagedEventSource:         c.SelfManagedEventSource,
+		SourceAccessConfigurations:     c.SourceAccessConfigurations,
+		StartingPosition:               c.StartingPosition,
+		StartingPositionTimestamp:      c.StartingPositionTimestamp,
+		State:                          c.State,
+		StateTransitionReason:          c.StateTransitionReason,
+		Topics:                         c.Topics,
+		TumblingWindowInSeconds:        c.TumblingWindowInSeconds,
+		UUID:                           c.UUID,
+	}
+
+	return GetEventSourceMappingOutput{
+		GetEventSourceMappingOutput: output,
+		ScalingConfig:               c.ScalingConfig,
+	}
+}
+
+func (eventSource EventSource) ToUpdateEventSourceMappingOutput(cfg *settings.Config) UpdateEventSourceMappingOutput {
+	c := eventSource.ToEventSourceMappingConfiguration(cfg)
+
+	output := lambda.UpdateEventSourceMappingOutput{
+		BatchSize:                      c.BatchSize,
+		BisectBatchOnFunctionError:     c.BisectBatchOnFunctionError,
+		DestinationConfig:              c.DestinationConfig,
+		EventSourceArn:                 c.EventSourceArn,
+		FilterCriteria:                 c.FilterCriteria,
+		FunctionArn:                    c.FunctionArn,
+		FunctionResponseTypes:          c.FunctionResponseTypes,
+		LastModified:                   c.LastModified,
+		LastProcessingResult:           c.LastProcessingResult,
+		MaximumBatchingWindowInSeconds: c.MaximumBatchingWindowInSeconds,
+		MaximumRecordAgeInSeconds:      c.MaximumRecordAgeInSeconds,
+		MaximumRetryAttempts:           c.MaximumRetryAttempts,
+		ParallelizationFactor:          c.ParallelizationFactor,
+		Queues:                         c.Queues,
+		SelfManagedEventSource:         c.SelfManagedEventSource,
+		SourceAccessConfigurations:     c.SourceAccessConfigurations,
+		StartingPosition:               c.StartingPosition,
+		StartingPositionTimestamp:      c.StartingPositionTimestamp,
+		State:                          c.State,
+		StateTransitionReason:          c.StateTransitionReason,
+		Topics:                         c.Topics,
+		TumblingWindowInSeconds:        c.TumblingWindowInSeconds,
+		UUID:                           c.UUID,
+	}
+
+	return UpdateEventSourceMappingOutput{
+		UpdateEventSourceMappingOutput: output,
+		ScalingConfig:                  c.ScalingConfig,
+	}
+}
+
+// ToDeleteEventSourceMappingOutput is the same as the other outputs, but in the Deleting state.
+func (eventSource EventSource) ToDeleteEventSourceMappingOutput(cfg *settings.Config) DeleteEventSourceMappingOutput {
+	c := eventSource.ToEventSourceMappingConfiguration(cfg)
+	state := "Deleting"
+
+	output := lambda.DeleteEventSourceMappingOutput{
+		BatchSize:                      c.BatchSize,
+		BisectBatchOnFunctionError:     c.BisectBatchOnFunctionError,
+		DestinationConfig:              c.DestinationConfig,
+		EventSourceArn:                 c.EventSourceArn,
+		FilterCriteria:                 c.FilterCriteria,
+		FunctionArn:                    c.FunctionArn,
+		FunctionResponseTypes:          c.FunctionResponseTypes,
+		LastModified:                   c.LastModified,
+		LastProcessingResult:           c.LastProcessingResult,
+		MaximumBatchingWindowInSeconds: c.MaximumBatchingWindowInSeconds,
+		MaximumRecordAgeInSeconds:      c.MaximumRecordAgeInSeconds,
+		MaximumRetryAttempts:           c.MaximumRetryAttempts,
+		ParallelizationFactor:          c.ParallelizationFactor,
+		Queues:                         c.Queues,
+		SelfManagedEventSource:         c.SelfManagedEventSource,
+		SourceAccessConfigurations:     c.SourceAccessConfigurations,
+		StartingPosition:               c.StartingPosition,
+		StartingPositionTimestamp:      c.StartingPositionTimestamp,
 		State:                          &state,
-		StateTransitionReason:          nil,
-		Topics:                         nil,
-		TumblingWindowInSeconds:        nil,
-		UUID:                           &id,
+		StateTransitionReason:          c.StateTransitionReason,
+		Topics:                         c.Topics,
+		TumblingWindowInSeconds:        c.TumblingWindowInSeconds,
+		UUID:                           c.UUID,
+	}
+
+	return DeleteEventSourceMappingOutput{
+		DeleteEventSourceMappingOutput: output,
+		ScalingConfig:                  c.ScalingConfig,
 	}
 }
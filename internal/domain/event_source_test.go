@@ -0,0 +1,110 @@
+package domain_test
+
+import (
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEventSourceFailureHandling(t *testing.T) {
+	cfg := &settings.Config{Region: "us-west-2", AccountNumber: "271828182845"}
+	eventSource := domain.EventSource{
+		Arn:                       "arn:aws:kinesis:us-west-2:271828182845:stream/my-stream",
+		Function:                  &domain.Function{FunctionName: "fn"},
+		MaximumRetryAttempts:      3,
+		MaximumRecordAgeInSeconds: -1,
+		OnFailure:                 queueArn,
+	}
+
+	c := eventSource.ToEventSourceMappingConfiguration(cfg)
+
+	assert.Equal(t, int32(3), aws.ToInt32(c.MaximumRetryAttempts))
+	assert.Equal(t, int32(-1), aws.ToInt32(c.MaximumRecordAgeInSeconds))
+	assert.Equal(t, queueArn, aws.ToString(c.DestinationConfig.OnFailure.Destination))
+}
+
+func TestEventSourceFailureHandlingWithoutDestination(t *testing.T) {
+	cfg := &settings.Config{Region: "us-west-2", AccountNumber: "271828182845"}
+	eventSource := domain.EventSource{
+		Arn:                       queueArn,
+		Function:                  &domain.Function{FunctionName: "fn"},
+		MaximumRetryAttempts:      -1,
+		MaximumRecordAgeInSeconds: -1,
+	}
+
+	c := eventSource.ToGetEventSourceMappingOutput(cfg)
+
+	assert.NotNil(t, c.DestinationConfig.OnFailure)
+	assert.Nil(t, c.DestinationConfig.OnFailure.Destination)
+}
+
+func TestEventSourceFailureHandlingNotReportedForKafka(t *testing.T) {
+	cfg := &settings.Config{Region: "us-west-2", AccountNumber: "271828182845"}
+	eventSource := domain.EventSource{
+		Function:                  &domain.Function{FunctionName: "fn"},
+		BootstrapServers:          []string{"localhost:9092"},
+		Topics:                    []string{"orders"},
+		MaximumRetryAttempts:      -1,
+		MaximumRecordAgeInSeconds: -1,
+	}
+
+	c := eventSource.ToEventSourceMappingConfiguration(cfg)
+
+	assert.Nil(t, c.DestinationConfig)
+	assert.Nil(t, c.MaximumRetryAttempts)
+	assert.Nil(t, c.MaximumRecordAgeInSeconds)
+}
+
+func TestEventSourceStreamProcessing(t *testing.T) {
+	cfg := &settings.Config{Region: "us-west-2", AccountNumber: "271828182845"}
+	stream := domain.EventSource{
+		Arn:      "arn:aws:kinesis:us-west-2:271828182845:stream/my-stream",
+		Function: &domain.Function{FunctionName: "fn"},
+	}
+
+	c := stream.ToCreateEventSourceMappingOutput(cfg)
+
+	assert.Equal(t, int32(1), aws.ToInt32(c.ParallelizationFactor))
+	if assert.NotNil(t, c.TumblingWindowInSeconds) {
+		assert.Equal(t, int32(0), *c.TumblingWindowInSeconds)
+	}
+
+	// only streams are processed in parallel or over windows, so neither is reported for queues
+	queue := domain.EventSource{Arn: queueArn, Function: &domain.Function{FunctionName: "fn"}}
+
+	q := queue.ToGetEventSourceMappingOutput(cfg)
+
+	assert.Nil(t, q.ParallelizationFactor)
+	assert.Nil(t, q.TumblingWindowInSeconds)
+}
+
+func TestEventSourceBoundFunction(t *testing.T) {
+	cfg := &settings.Config{Region: "us-west-2", AccountNumber: "271828182845"}
+	arn := "arn:aws:lambda:us-west-2:271828182845:function:fn"
+
+	tests := []struct {
+		name      string
+		function  *domain.Function
+		alias     string
+		qualifier string
+		invoked   string
+		arn       string
+	}{
+		{"latest", &domain.Function{FunctionName: "fn", Version: "2", Latest: true}, "", "$LATEST", "fn", arn},
+		{"version", &domain.Function{FunctionName: "fn", Version: "1"}, "", "1", "fn:1", arn + ":1"},
+		{"alias", &domain.Function{FunctionName: "fn", Version: "2", Latest: true}, "live", "live", "fn:live",
+			arn + ":live"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			eventSource := domain.EventSource{Arn: queueArn, Function: test.function, FunctionAlias: test.alias}
+
+			assert.Equal(t, test.qualifier, eventSource.FunctionQualifier())
+			assert.Equal(t, test.invoked, eventSource.InvokedName())
+			assert.Equal(t, test.arn, aws.ToString(eventSource.ToEventSourceMappingConfiguration(cfg).FunctionArn))
+		})
+	}
+}
@@ -2,11 +2,17 @@ package domain
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
 	"github.com/ATenderholt/rainbow-functions/settings"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	aws "github.com/aws/aws-sdk-go-v2/service/lambda/types"
 	"github.com/aws/smithy-go/middleware"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -62,18 +68,44 @@ type Function struct {
 	// can't invoke or modify the function.
 	StateReasonCode aws.StateReasonCode
 
-	// The version of the Lambda function.
+	// The version of the Lambda function. The highest version of a Function is $LATEST, which is mutable, while
+	// lower versions are immutable snapshots created when $LATEST is published.
 	Version string
+
+	// Whether this is the $LATEST version of the Function.
+	Latest bool
+
+	// Concurrency reserved for the Function as a whole, or nil if it is unreserved.
+	ReservedConcurrency *int32
 }
 
+const LatestVersion = "$LATEST"
+
+// MaxListItems is the most Functions that are listed at once, which is also the default.
+const MaxListItems = 50
+
 type FunctionRepository interface {
+	DeleteFunction(ctx context.Context, name string) error
+	DeleteFunctionConcurrency(ctx context.Context, name string) error
+	DeleteFunctionVersion(ctx context.Context, name string, version int) error
 	GetAllLatestFunctions(ctx context.Context) ([]Function, error)
 	GetEnvironmentForFunction(ctx context.Context, function Function) (*aws.Environment, error)
+	GetFunctionConcurrency(ctx context.Context, name string) (*int32, error)
+	GetFunctionVersion(ctx context.Context, name string, version int) (*Function, error)
 	GetLayersForFunction(ctx context.Context, function Function) ([]LambdaLayer, error)
 	GetLatestFunctionByName(ctx context.Context, name string) (*Function, error)
 	GetLatestVersionForFunctionName(ctx context.Context, name string) (int, error)
+	GetTagsForFunction(ctx context.Context, function Function) (map[string]string, error)
 	GetVersionsForFunctionName(ctx context.Context, name string) ([]Function, error)
 	InsertFunction(ctx context.Context, function *Function) (*Function, error)
+	ListFunctions(ctx context.Context, afterName string, afterVersion int, limit int, allVersions bool) ([]Function, error)
+	PublishFunction(ctx context.Context, latest *Function, description *string) (*Function, error)
+	PutFunctionConcurrency(ctx context.Context, name string, reserved int32) error
+	TagFunction(ctx context.Context, name string, tags map[string]string) error
+	UntagFunction(ctx context.Context, name string, keys []string) error
+	UpdateFunctionCode(ctx context.Context, function *Function) error
+	UpdateFunctionConfiguration(ctx context.Context, function *Function) error
+	UpdateFunctionStatus(ctx context.Context, function *Function) error
 	UpsertFunctionEnvironment(ctx context.Context, function *Function, environment *aws.Environment) error
 }
 
@@ -82,9 +114,10 @@ func (f Function) AwsRuntime() aws.Runtime {
 }
 
 func (f Function) EnvVars() []string {
-	environment := make([]string, 2)
+	// code is only changed through the API, which swaps containers, so don't watch for changes (unlike DevFunction)
+	// since the runtime restarting would fail in-flight invocations
+	environment := make([]string, 1)
 	environment[0] = "DOCKER_LAMBDA_STAY_OPEN=1"
-	environment[1] = "DOCKER_LAMBDA_WATCH=1"
 
 	if f.Environment == nil {
 		return environment
@@ -105,6 +138,80 @@ func (f Function) Name() string {
 	return f.FunctionName
 }
 
+// Qualifier returns the version of the Function as exposed through the API, i.e. $LATEST or a published version.
+func (f Function) Qualifier() string {
+	if f.Latest {
+		return LatestVersion
+	}
+
+	return f.Version
+}
+
+// EncodeMarker creates an opaque pagination token for the position after the specified Function name & version.
+func EncodeMarker(name string, version string) *string {
+	marker := base64.URLEncoding.EncodeToString([]byte(name + ":" + version))
+	return &marker
+}
+
+// DecodeMarker returns the Function name & version encoded in a pagination token from EncodeMarker.
+func DecodeMarker(marker string) (string, int, error) {
+	decoded, err := base64.URLEncoding.DecodeString(marker)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid marker %s: %v", marker, err)
+	}
+
+	position := string(decoded)
+	i := strings.LastIndex(position, ":")
+	if i < 0 {
+		return "", 0, fmt.Errorf("invalid marker %s", marker)
+	}
+
+	version, err := strconv.Atoi(position[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid version in marker %s: %v", marker, err)
+	}
+
+	return position[:i], version, nil
+}
+
+// QualifiedName returns the name that invokes this version of the Function, which is only qualified for published
+// versions.
+func (f Function) QualifiedName() string {
+	if f.Latest {
+		return f.FunctionName
+	}
+
+	return f.FunctionName + ":" + f.Version
+}
+
+// ParseFunctionName splits a Function name, partial ARN or ARN (optionally with a qualifier) into the name and
+// qualifier. The qualifier is empty if not specified.
+func ParseFunctionName(value string) (name string, qualifier string) {
+	parts := strings.Split(value, ":")
+
+	switch {
+	case len(parts) >= 7 && parts[0] == "arn":
+		// arn:aws:lambda:region:account:function:name[:qualifier]
+		name = parts[6]
+		if len(parts) > 7 {
+			qualifier = parts[7]
+		}
+	case len(parts) >= 3 && parts[1] == "function":
+		// account:function:name[:qualifier]
+		name = parts[2]
+		if len(parts) > 3 {
+			qualifier = parts[3]
+		}
+	default:
+		name = parts[0]
+		if len(parts) > 1 {
+			qualifier = parts[1]
+		}
+	}
+
+	return
+}
+
 func CreateFunction(input *lambda.CreateFunctionInput) *Function {
 	var deadLetterArn string
 	if input.DeadLetterConfig != nil {
@@ -132,8 +239,43 @@ func CreateFunction(input *lambda.CreateFunctionInput) *Function {
 	}
 }
 
+// ApplyConfiguration updates the Function with any settings specified in the input. Layers are not applied since
+// they need to be looked up first.
+func (f *Function) ApplyConfiguration(input *lambda.UpdateFunctionConfigurationInput) {
+	if input.Description != nil {
+		f.Description = *input.Description
+	}
+
+	if input.Handler != nil {
+		f.Handler = *input.Handler
+	}
+
+	if input.Role != nil {
+		f.Role = *input.Role
+	}
+
+	if input.DeadLetterConfig != nil {
+		f.DeadLetterArn = stringOrEmpty(input.DeadLetterConfig.TargetArn)
+	}
+
+	if input.MemorySize != nil {
+		f.MemorySize = *input.MemorySize
+	}
+
+	if input.Runtime != "" {
+		f.Runtime = input.Runtime
+	}
+
+	if input.Timeout != nil {
+		f.Timeout = *input.Timeout
+	}
+
+	f.LastModified = time.Now().UnixMilli()
+}
+
 func (f Function) ToCreateFunctionOutput(cfg *settings.Config) *lambda.CreateFunctionOutput {
 	lastModified := time.UnixMilli(f.LastModified).Format(TimeFormat)
+	version := f.Qualifier()
 
 	return &lambda.CreateFunctionOutput{
 		Architectures:    nil,
@@ -169,7 +311,7 @@ func (f Function) ToCreateFunctionOutput(cfg *settings.Config) *lambda.CreateFun
 		StateReasonCode:            "",
 		Timeout:                    &f.Timeout,
 		TracingConfig:              nil,
-		Version:                    &f.Version,
+		Version:                    &version,
 		VpcConfig:                  nil,
 		ResultMetadata:             middleware.Metadata{},
 	}
@@ -177,6 +319,7 @@ func (f Function) ToCreateFunctionOutput(cfg *settings.Config) *lambda.CreateFun
 
 func (f *Function) ToFunctionConfiguration(cfg *settings.Config) *aws.FunctionConfiguration {
 	lastModified := timeMillisToString(f.LastModified)
+	version := f.Qualifier()
 	layers := make([]aws.Layer, len(f.Layers))
 	for i, layer := range f.Layers {
 		layers[i] = aws.Layer{
@@ -197,19 +340,19 @@ func (f *Function) ToFunctionConfiguration(cfg *settings.Config) *aws.FunctionCo
 		Architectures:              nil,
 		CodeSha256:                 &f.CodeSha256,
 		CodeSize:                   f.CodeSize,
-		DeadLetterConfig:           nil,
+		DeadLetterConfig:           f.deadLetterConfig(),
 		Description:                &f.Description,
 		Environment:                environment,
 		FileSystemConfigs:          nil,
-		FunctionArn:                f.GetArn(cfg),
+		FunctionArn:                f.GetVersionArn(cfg),
 		FunctionName:               &f.FunctionName,
 		Handler:                    &f.Handler,
 		ImageConfigResponse:        nil,
 		KMSKeyArn:                  nil,
 		LastModified:               &lastModified,
-		LastUpdateStatus:           "",
-		LastUpdateStatusReason:     nil,
-		LastUpdateStatusReasonCode: "",
+		LastUpdateStatus:           f.LastUpdateStatus,
+		LastUpdateStatusReason:     f.LastUpdateStatusReason,
+		LastUpdateStatusReasonCode: f.LastUpdateStatusReasonCode,
 		Layers:                     layers,
 		MasterArn:                  nil,
 		MemorySize:                 &f.MemorySize,
@@ -224,7 +367,7 @@ func (f *Function) ToFunctionConfiguration(cfg *settings.Config) *aws.FunctionCo
 		StateReasonCode:            "",
 		Timeout:                    &f.Timeout,
 		TracingConfig:              nil,
-		Version:                    &f.Version,
+		Version:                    &version,
 		VpcConfig:                  nil,
 	}
 }
@@ -234,17 +377,21 @@ func (f *Function) ToGetFunctionOutput(cfg *settings.Config) *lambda.GetFunction
 	code := aws.FunctionCodeLocation{}
 	one := int32(-1)
 	concurrency := aws.Concurrency{ReservedConcurrentExecutions: &one}
+	if f.ReservedConcurrency != nil {
+		concurrency.ReservedConcurrentExecutions = f.ReservedConcurrency
+	}
 	return &lambda.GetFunctionOutput{
 		Code:           &code,
 		Concurrency:    &concurrency,
 		Configuration:  config,
-		Tags:           nil,
+		Tags:           f.Tags,
 		ResultMetadata: middleware.Metadata{},
 	}
 }
 
 func (f *Function) ToUpdateFunctionConfigurationOutput(cfg *settings.Config) *lambda.UpdateFunctionConfigurationOutput {
 	lastModified := timeMillisToString(f.LastModified)
+	version := f.Qualifier()
 	layers := make([]aws.Layer, len(f.Layers))
 	for i, layer := range f.Layers {
 		layers[i] = aws.Layer{
@@ -256,6 +403,46 @@ func (f *Function) ToUpdateFunctionConfigurationOutput(cfg *settings.Config) *la
 	}
 
 	return &lambda.UpdateFunctionConfigurationOutput{
+		Architectures:              nil,
+		CodeSha256:                 &f.CodeSha256,
+		CodeSize:                   f.CodeSize,
+		DeadLetterConfig:           f.deadLetterConfig(),
+		Description:                &f.Description,
+		Environment:                &aws.EnvironmentResponse{Variables: f.Environment.Variables},
+		FileSystemConfigs:          nil,
+		FunctionArn:                f.GetArn(cfg),
+		FunctionName:               &f.FunctionName,
+		Handler:                    &f.Handler,
+		ImageConfigResponse:        nil,
+		KMSKeyArn:                  nil,
+		LastModified:               &lastModified,
+		LastUpdateStatus:           f.LastUpdateStatus,
+		LastUpdateStatusReason:     f.LastUpdateStatusReason,
+		LastUpdateStatusReasonCode: f.LastUpdateStatusReasonCode,
+		Layers:                     layers,
+		MasterArn:                  nil,
+		MemorySize:                 &f.MemorySize,
+		PackageType:                "Zip",
+		RevisionId:                 nil,
+		Role:                       &f.Role,
+		Runtime:                    f.Runtime,
+		SigningJobArn:              nil,
+		SigningProfileVersionArn:   nil,
+		State:                      aws.StateActive,
+		StateReason:                nil,
+		StateReasonCode:            "",
+		Timeout:                    &f.Timeout,
+		TracingConfig:              nil,
+		Version:                    &version,
+		VpcConfig:                  nil,
+	}
+}
+
+func (f *Function) ToUpdateFunctionCodeOutput(cfg *settings.Config) *lambda.UpdateFunctionCodeOutput {
+	lastModified := timeMillisToString(f.LastModified)
+	version := f.Qualifier()
+
+	return &lambda.UpdateFunctionCodeOutput{
 		Architectures:              nil,
 		CodeSha256:                 &f.CodeSha256,
 		CodeSize:                   f.CodeSize,
@@ -272,7 +459,7 @@ func (f *Function) ToUpdateFunctionConfigurationOutput(cfg *settings.Config) *la
 		LastUpdateStatus:           aws.LastUpdateStatusSuccessful,
 		LastUpdateStatusReason:     nil,
 		LastUpdateStatusReasonCode: "",
-		Layers:                     layers,
+		Layers:                     layersToAws(f.Layers, cfg),
 		MasterArn:                  nil,
 		MemorySize:                 &f.MemorySize,
 		PackageType:                "Zip",
@@ -286,11 +473,61 @@ func (f *Function) ToUpdateFunctionConfigurationOutput(cfg *settings.Config) *la
 		StateReasonCode:            "",
 		Timeout:                    &f.Timeout,
 		TracingConfig:              nil,
-		Version:                    &f.Version,
+		Version:                    &version,
 		VpcConfig:                  nil,
+		ResultMetadata:             middleware.Metadata{},
 	}
 }
 
+func (f *Function) ToPublishVersionOutput(cfg *settings.Config) *lambda.PublishVersionOutput {
+	lastModified := timeMillisToString(f.LastModified)
+	version := f.Qualifier()
+
+	return &lambda.PublishVersionOutput{
+		Architectures:              nil,
+		CodeSha256:                 &f.CodeSha256,
+		CodeSize:                   f.CodeSize,
+		DeadLetterConfig:           f.deadLetterConfig(),
+		Description:                &f.Description,
+		Environment:                &aws.EnvironmentResponse{Variables: f.Environment.Variables},
+		FileSystemConfigs:          nil,
+		FunctionArn:                f.GetVersionArn(cfg),
+		FunctionName:               &f.FunctionName,
+		Handler:                    &f.Handler,
+		ImageConfigResponse:        nil,
+		KMSKeyArn:                  nil,
+		LastModified:               &lastModified,
+		LastUpdateStatus:           f.LastUpdateStatus,
+		LastUpdateStatusReason:     f.LastUpdateStatusReason,
+		LastUpdateStatusReasonCode: f.LastUpdateStatusReasonCode,
+		Layers:                     layersToAws(f.Layers, cfg),
+		MasterArn:                  nil,
+		MemorySize:                 &f.MemorySize,
+		PackageType:                "Zip",
+		RevisionId:                 nil,
+		Role:                       &f.Role,
+		Runtime:                    f.Runtime,
+		SigningJobArn:              nil,
+		SigningProfileVersionArn:   nil,
+		State:                      aws.StateActive,
+		StateReason:                nil,
+		StateReasonCode:            "",
+		Timeout:                    &f.Timeout,
+		TracingConfig:              nil,
+		Version:                    &version,
+		VpcConfig:                  nil,
+		ResultMetadata:             middleware.Metadata{},
+	}
+}
+
+func (f *Function) deadLetterConfig() *aws.DeadLetterConfig {
+	if f.DeadLetterArn == "" {
+		return nil
+	}
+
+	return &aws.DeadLetterConfig{TargetArn: &f.DeadLetterArn}
+}
+
 func layersToAws(layers []LambdaLayer, cfg *settings.Config) []aws.Layer {
 	results := make([]aws.Layer, len(layers))
 	for i, layer := range layers {
@@ -307,17 +544,76 @@ func (f *Function) GetBasePath(cfg *settings.Config) string {
 	return filepath.Join(cfg.DataPath(), "lambda", "functions", f.FunctionName, f.Version)
 }
 
+// GetDestPath is where the code of the Function is extracted to. Each revision of the code has its own directory, so
+// that it can be replaced without changing the files of a container that is still running.
 func (f *Function) GetDestPath(cfg *settings.Config) string {
 	basePath := f.GetBasePath(cfg)
-	return filepath.Join(basePath, "content")
+	return filepath.Join(basePath, "code", revision(f.CodeSha256))
 }
 
+// GetLayerDestPath is where the Layers of the Function are installed to, with a directory for each set of Layers for
+// the same reason as the code.
 func (f *Function) GetLayerDestPath(cfg *settings.Config) string {
+	var versions strings.Builder
+	for _, layer := range f.Layers {
+		versions.WriteString(layer.Name + ":" + strconv.Itoa(layer.Version) + "\n")
+	}
+	hash := sha256.Sum256([]byte(versions.String()))
+
+	basePath := f.GetBasePath(cfg)
+	return filepath.Join(basePath, "opt", revision(base64.StdEncoding.EncodeToString(hash[:])))
+}
+
+// MoveLegacyPaths moves the code & Layers of Functions that were saved before each revision had its own directory to
+// where they are expected now. The Function's Layers must be loaded.
+func (f *Function) MoveLegacyPaths(cfg *settings.Config) error {
 	basePath := f.GetBasePath(cfg)
-	return filepath.Join(basePath, "layers")
+	moves := [][2]string{
+		{filepath.Join(basePath, "content"), f.GetDestPath(cfg)},
+		{filepath.Join(basePath, "layers"), f.GetLayerDestPath(cfg)},
+	}
+
+	for _, move := range moves {
+		legacy, dest := move[0], move[1]
+		if _, err := os.Stat(legacy); err != nil {
+			continue
+		}
+
+		if _, err := os.Stat(dest); err == nil {
+			continue
+		}
+
+		err := os.MkdirAll(filepath.Dir(dest), 0755)
+		if err != nil {
+			return err
+		}
+
+		err = os.Rename(legacy, dest)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revision names a directory after the base64 encoded hash, which may include a slash.
+func revision(hash string) string {
+	return strings.NewReplacer("/", "_", "+", "-", "=", "").Replace(hash)
 }
 
 func (f *Function) GetArn(cfg *settings.Config) *string {
 	result := "arn:aws:lambda:" + cfg.Region + ":" + cfg.AccountNumber + ":function:" + f.FunctionName
 	return &result
 }
+
+// GetVersionArn returns the ARN qualified with the version for published versions, and the unqualified ARN for $LATEST.
+func (f *Function) GetVersionArn(cfg *settings.Config) *string {
+	arn := f.GetArn(cfg)
+	if f.Latest {
+		return arn
+	}
+
+	result := *arn + ":" + f.Version
+	return &result
+}
@@ -1,9 +1,14 @@
 package domain_test
 
 import (
+	"encoding/base64"
 	"github.com/ATenderholt/rainbow-functions/internal/domain"
 	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
 	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -19,11 +24,22 @@ func TestLocalFunctionDestPaths(t *testing.T) {
 	f := domain.Function{
 		FunctionName: "test-function",
 		Version:      "1.2.3",
+		CodeSha256:   "n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=",
 	}
 
 	destPath := f.GetDestPath(cfg)
 
-	assert.Condition(t, stringEndsWith(destPath, "data/lambda/functions/test-function/1.2.3/content"))
+	assert.Condition(t, stringEndsWith(destPath,
+		"data/lambda/functions/test-function/1.2.3/code/n4bQgYhMfWWaL-qgxVrQFaO_TxsrC4Is0V1sFbDwCgg"))
+}
+
+func TestFunctionDestPathChangesWithCode(t *testing.T) {
+	cfg := settings.DefaultConfig()
+	f := domain.Function{FunctionName: "test-function", Version: "1", CodeSha256: "abc"}
+	g := domain.Function{FunctionName: "test-function", Version: "1", CodeSha256: "def"}
+
+	assert.NotEqual(t, f.GetDestPath(cfg), g.GetDestPath(cfg))
+	assert.Equal(t, f.GetLayerDestPath(cfg), g.GetLayerDestPath(cfg))
 }
 
 func TestLocalLayerDestPaths(t *testing.T) {
@@ -35,5 +51,144 @@ func TestLocalLayerDestPaths(t *testing.T) {
 
 	destPath := f.GetLayerDestPath(cfg)
 
-	assert.Condition(t, stringEndsWith(destPath, "data/lambda/functions/test-function/1.2.3/layers"))
+	assert.Contains(t, destPath, "data/lambda/functions/test-function/1.2.3/opt/")
+}
+
+func TestLayerDestPathChangesWithLayers(t *testing.T) {
+	cfg := settings.DefaultConfig()
+	f := domain.Function{FunctionName: "test-function", Version: "1"}
+	g := domain.Function{FunctionName: "test-function", Version: "1", Layers: []domain.LambdaLayer{{Name: "deps", Version: 1}}}
+	h := domain.Function{FunctionName: "test-function", Version: "1", Layers: []domain.LambdaLayer{{Name: "deps", Version: 2}}}
+
+	assert.NotEqual(t, f.GetLayerDestPath(cfg), g.GetLayerDestPath(cfg))
+	assert.NotEqual(t, g.GetLayerDestPath(cfg), h.GetLayerDestPath(cfg))
+	assert.Equal(t, g.GetLayerDestPath(cfg), g.GetLayerDestPath(cfg))
+}
+
+func TestMoveLegacyPaths(t *testing.T) {
+	cfg := settings.DefaultConfig()
+	f := domain.Function{FunctionName: "legacy-function", Version: "1", CodeSha256: "abc"}
+	basePath := f.GetBasePath(cfg)
+	defer os.RemoveAll(filepath.Dir(basePath))
+
+	err := os.MkdirAll(filepath.Join(basePath, "content"), 0755)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(basePath, "content", "handler.py"), []byte("pass"), 0644)
+	assert.NoError(t, err)
+
+	err = f.MoveLegacyPaths(cfg)
+	assert.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(f.GetDestPath(cfg), "handler.py"))
+	assert.NoDirExists(t, filepath.Join(basePath, "content"))
+	assert.NoDirExists(t, f.GetLayerDestPath(cfg))
+}
+
+func TestApplyConfiguration(t *testing.T) {
+	f := domain.Function{
+		FunctionName:  "test-function",
+		Description:   "original",
+		Handler:       "main.handler",
+		Role:          "role",
+		DeadLetterArn: "arn:aws:sqs:us-west-2:271828182845:dlq",
+		MemorySize:    128,
+		Runtime:       "python3.8",
+		Timeout:       3,
+	}
+
+	handler := "main.other_handler"
+	timeout := int32(30)
+	f.ApplyConfiguration(&lambda.UpdateFunctionConfigurationInput{
+		Handler:          &handler,
+		Runtime:          "python3.9",
+		Timeout:          &timeout,
+		DeadLetterConfig: &types.DeadLetterConfig{},
+	})
+
+	assert.Equal(t, "original", f.Description)
+	assert.Equal(t, "main.other_handler", f.Handler)
+	assert.Equal(t, "role", f.Role)
+	assert.Equal(t, "", f.DeadLetterArn)
+	assert.Equal(t, int32(128), f.MemorySize)
+	assert.Equal(t, types.Runtime("python3.9"), f.Runtime)
+	assert.Equal(t, int32(30), f.Timeout)
+}
+
+func TestParseFunctionName(t *testing.T) {
+	tests := []struct {
+		value     string
+		name      string
+		qualifier string
+	}{
+		{"my-function", "my-function", ""},
+		{"my-function:2", "my-function", "2"},
+		{"123456789012:function:my-function", "my-function", ""},
+		{"123456789012:function:my-function:$LATEST", "my-function", "$LATEST"},
+		{"arn:aws:lambda:us-west-2:123456789012:function:my-function", "my-function", ""},
+		{"arn:aws:lambda:us-west-2:123456789012:function:my-function:3", "my-function", "3"},
+	}
+
+	for _, test := range tests {
+		name, qualifier := domain.ParseFunctionName(test.value)
+		assert.Equal(t, test.name, name, test.value)
+		assert.Equal(t, test.qualifier, qualifier, test.value)
+	}
+}
+
+func TestQualifier(t *testing.T) {
+	f := domain.Function{FunctionName: "test-function", Version: "3"}
+	assert.Equal(t, "3", f.Qualifier())
+
+	f.Latest = true
+	assert.Equal(t, domain.LatestVersion, f.Qualifier())
+}
+
+func TestQualifiedName(t *testing.T) {
+	latest := domain.Function{FunctionName: "test-function", Version: "3", Latest: true}
+	published := domain.Function{FunctionName: "test-function", Version: "2"}
+
+	assert.Equal(t, "test-function", latest.QualifiedName())
+	assert.Equal(t, "test-function:2", published.QualifiedName())
+}
+
+func TestMarkerRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    int
+	}{
+		{"test-function", "1", 1},
+		{"test-function", "12", 12},
+		{"a", "0", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name+":"+test.version, func(t *testing.T) {
+			marker := domain.EncodeMarker(test.name, test.version)
+
+			name, version, err := domain.DecodeMarker(*marker)
+			assert.NoError(t, err)
+			assert.Equal(t, test.name, name)
+			assert.Equal(t, test.want, version)
+		})
+	}
+}
+
+func TestDecodeInvalidMarker(t *testing.T) {
+	tests := []struct {
+		name   string
+		marker string
+	}{
+		{"not base64", "not a marker!"},
+		{"without version", base64.URLEncoding.EncodeToString([]byte("test-function"))},
+		{"non-numeric version", base64.URLEncoding.EncodeToString([]byte("test-function:$LATEST"))},
+		{"empty", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := domain.DecodeMarker(test.marker)
+			assert.Error(t, err)
+		})
+	}
 }
@@ -0,0 +1,358 @@
+package http
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	aws "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+)
+
+type AliasHandler struct {
+	cfg          *settings.Config
+	aliasRepo    domain.AliasRepository
+	functionRepo domain.FunctionRepository
+}
+
+func NewAliasHandler(cfg *settings.Config, aliasRepo domain.AliasRepository,
+	functionRepo domain.FunctionRepository) AliasHandler {
+
+	return AliasHandler{
+		cfg:          cfg,
+		aliasRepo:    aliasRepo,
+		functionRepo: functionRepo,
+	}
+}
+
+// aliasError is returned when validating an Alias, along with the HTTP status that should be returned
+type aliasError struct {
+	status int
+	msg    string
+}
+
+func (e aliasError) Error() string {
+	return e.msg
+}
+
+func (a AliasHandler) PostAlias(response http.ResponseWriter, request *http.Request) {
+	name, _, ok := functionParam(response, request)
+	if !ok {
+		return
+	}
+
+	var body lambda.CreateAliasInput
+	err := json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to decode request to create Alias for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusBadRequest)
+		return
+	}
+
+	alias := domain.CreateAlias(name, &body)
+
+	logger.Infof("Creating Alias %s for Function %s", alias.Name, name)
+
+	ctx := request.Context()
+
+	if !a.validate(ctx, response, alias) {
+		return
+	}
+
+	_, err = a.aliasRepo.GetAlias(ctx, name, alias.Name)
+	switch {
+	case err == nil:
+		msg := fmt.Sprintf("Alias %s already exists for Function %s", alias.Name, name)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusConflict)
+		return
+	case err != sql.ErrNoRows:
+		msg := fmt.Sprintf("Unable to check for existing Alias %s of Function %s: %v", alias.Name, name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	err = a.aliasRepo.InsertAlias(ctx, alias)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to save Alias %s for Function %s: %v", alias.Name, name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusCreated)
+	respondWithJson(response, alias.ToCreateAliasOutput(a.cfg))
+}
+
+func (a AliasHandler) GetAlias(response http.ResponseWriter, request *http.Request) {
+	alias := a.loadAlias(response, request)
+	if alias == nil {
+		return
+	}
+
+	respondWithJson(response, alias.ToGetAliasOutput(a.cfg))
+}
+
+func (a AliasHandler) PutAlias(response http.ResponseWriter, request *http.Request) {
+	var body lambda.UpdateAliasInput
+	err := json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to decode request to update Alias: %v", err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusBadRequest)
+		return
+	}
+
+	alias := a.loadAlias(response, request)
+	if alias == nil {
+		return
+	}
+
+	if body.RevisionId != nil && *body.RevisionId != alias.RevisionId {
+		msg := fmt.Sprintf("RevisionId %s does not match Alias %s of Function %s", *body.RevisionId, alias.Name,
+			alias.FunctionName)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusPreconditionFailed)
+		return
+	}
+
+	alias.ApplyUpdate(&body)
+
+	logger.Infof("Updating Alias %s of Function %s: %+v", alias.Name, alias.FunctionName, alias)
+
+	ctx := request.Context()
+
+	if !a.validate(ctx, response, alias) {
+		return
+	}
+
+	err = a.aliasRepo.UpdateAlias(ctx, alias)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to update Alias %s of Function %s: %v", alias.Name, alias.FunctionName, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJson(response, alias.ToUpdateAliasOutput(a.cfg))
+}
+
+func (a AliasHandler) DeleteAlias(response http.ResponseWriter, request *http.Request) {
+	name, _, ok := functionParam(response, request)
+	if !ok {
+		return
+	}
+
+	aliasName := chi.URLParam(request, "alias")
+
+	logger.Infof("Deleting Alias %s of Function %s", aliasName, name)
+
+	err := a.aliasRepo.DeleteAlias(request.Context(), name, aliasName)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to delete Alias %s of Function %s: %v", aliasName, name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+func (a AliasHandler) ListAliases(response http.ResponseWriter, request *http.Request) {
+	name, _, ok := functionParam(response, request)
+	if !ok {
+		return
+	}
+
+	query := request.URL.Query()
+	functionVersion := query.Get("FunctionVersion")
+
+	maxItems := 50
+	if value := query.Get("MaxItems"); value != "" {
+		var err error
+		maxItems, err = strconv.Atoi(value)
+		if err != nil || maxItems < 1 {
+			msg := fmt.Sprintf("Invalid MaxItems %s", value)
+			logger.Error(msg)
+			http.Error(response, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	after := ""
+	if marker := query.Get("Marker"); marker != "" {
+		decoded, err := base64.URLEncoding.DecodeString(marker)
+		if err != nil {
+			msg := fmt.Sprintf("Invalid marker %s: %v", marker, err)
+			logger.Error(msg)
+			http.Error(response, msg, http.StatusBadRequest)
+			return
+		}
+		after = string(decoded)
+	}
+
+	logger.Infof("Listing Aliases for Function %s", name)
+
+	ctx := request.Context()
+
+	aliases, err := a.aliasRepo.GetAliasesForFunction(ctx, name)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to list Aliases for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	configs := make([]aws.AliasConfiguration, 0, len(aliases))
+	var nextMarker *string
+	for _, alias := range aliases {
+		if alias.Name <= after {
+			continue
+		}
+
+		// aliases also apply to a version when it receives a share of the invocations
+		_, routed := alias.AdditionalVersionWeights[functionVersion]
+		if functionVersion != "" && alias.FunctionVersion != functionVersion && !routed {
+			continue
+		}
+
+		if len(configs) == maxItems {
+			marker := base64.URLEncoding.EncodeToString([]byte(*configs[len(configs)-1].Name))
+			nextMarker = &marker
+			break
+		}
+
+		configs = append(configs, alias.ToAliasConfiguration(a.cfg))
+	}
+
+	results := lambda.ListAliasesOutput{
+		Aliases:        configs,
+		NextMarker:     nextMarker,
+		ResultMetadata: middleware.Metadata{},
+	}
+
+	respondWithJson(response, results)
+}
+
+// loadAlias writes the appropriate error response & returns nil if the Alias in the URL cannot be loaded.
+func (a AliasHandler) loadAlias(response http.ResponseWriter, request *http.Request) *domain.Alias {
+	name, _, ok := functionParam(response, request)
+	if !ok {
+		return nil
+	}
+
+	aliasName := chi.URLParam(request, "alias")
+
+	logger.Infof("Getting Alias %s of Function %s", aliasName, name)
+
+	alias, err := a.aliasRepo.GetAlias(request.Context(), name, aliasName)
+	if err == sql.ErrNoRows {
+		http.NotFound(response, request)
+		return nil
+	}
+
+	if err != nil {
+		msg := fmt.Sprintf("Unable to get Alias %s of Function %s: %v", aliasName, name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return nil
+	}
+
+	return alias
+}
+
+// validate writes the appropriate error response & returns false if the Alias is not valid.
+func (a AliasHandler) validate(ctx context.Context, response http.ResponseWriter, alias *domain.Alias) bool {
+	err := a.checkAlias(ctx, alias)
+	if err == nil {
+		return true
+	}
+
+	status := http.StatusInternalServerError
+	if e, ok := err.(aliasError); ok {
+		status = e.status
+	}
+
+	msg := fmt.Sprintf("Invalid Alias %s for Function %s: %v", alias.Name, alias.FunctionName, err)
+	logger.Error(msg)
+	http.Error(response, msg, status)
+
+	return false
+}
+
+func (a AliasHandler) checkAlias(ctx context.Context, alias *domain.Alias) error {
+	if _, err := strconv.Atoi(alias.Name); alias.Name == "" || alias.Name == domain.LatestVersion || err == nil {
+		return aliasError{http.StatusBadRequest, "name must not be empty, $LATEST or a version"}
+	}
+
+	_, err := a.functionRepo.GetLatestFunctionByName(ctx, alias.FunctionName)
+	switch {
+	case err == sql.ErrNoRows:
+		return aliasError{http.StatusNotFound, "Function not found"}
+	case err != nil:
+		return err
+	}
+
+	if alias.FunctionVersion != domain.LatestVersion {
+		err := a.checkPublished(ctx, alias.FunctionName, alias.FunctionVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(alias.AdditionalVersionWeights) == 0 {
+		return nil
+	}
+
+	if len(alias.AdditionalVersionWeights) > 1 {
+		return aliasError{http.StatusBadRequest, "only one additional version is supported"}
+	}
+
+	if alias.FunctionVersion == domain.LatestVersion {
+		return aliasError{http.StatusBadRequest, "routing is not supported for $LATEST"}
+	}
+
+	for version, weight := range alias.AdditionalVersionWeights {
+		if version == alias.FunctionVersion {
+			return aliasError{http.StatusBadRequest, "additional version must differ from FunctionVersion"}
+		}
+
+		if weight < 0.0 || weight >= 1.0 {
+			return aliasError{http.StatusBadRequest, fmt.Sprintf("weight %f must be between 0.0 and 1.0", weight)}
+		}
+
+		err := a.checkPublished(ctx, alias.FunctionName, version)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkPublished returns an error unless version is a published version of the Function.
+func (a AliasHandler) checkPublished(ctx context.Context, name string, version string) error {
+	number, err := strconv.Atoi(version)
+	if err != nil {
+		return aliasError{http.StatusBadRequest, fmt.Sprintf("version %s is not a published version", version)}
+	}
+
+	function, err := a.functionRepo.GetFunctionVersion(ctx, name, number)
+	switch {
+	case err == sql.ErrNoRows || (err == nil && function.Latest):
+		return aliasError{http.StatusNotFound, fmt.Sprintf("version %s not found", version)}
+	case err != nil:
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/smithy-go/middleware"
+	"net/http"
+)
+
+// concurrencyFunction writes the appropriate error response & returns "" if the Function in the URL cannot be found.
+// Reserved concurrency applies to the Function as a whole, so qualified names aren't allowed.
+func (f FunctionHandler) concurrencyFunction(response http.ResponseWriter, request *http.Request) string {
+	name, qualifier, ok := functionParam(response, request)
+	if !ok {
+		return ""
+	}
+
+	if qualifier != "" {
+		msg := fmt.Sprintf("Unable to reserve concurrency for qualified Function %s:%s", name, qualifier)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusBadRequest)
+		return ""
+	}
+
+	_, err := f.functionRepo.GetLatestFunctionByName(request.Context(), name)
+	if err == sql.ErrNoRows {
+		logger.Infof("Unable to find Function named %s", name)
+		http.NotFound(response, request)
+		return ""
+	}
+
+	if err != nil {
+		msg := fmt.Sprintf("Unable to get Lambda Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return ""
+	}
+
+	return name
+}
+
+func (f FunctionHandler) PutFunctionConcurrency(response http.ResponseWriter, request *http.Request) {
+	var body lambda.PutFunctionConcurrencyInput
+	err := json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to decode request to reserve concurrency: %v", err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusBadRequest)
+		return
+	}
+
+	if body.ReservedConcurrentExecutions == nil || *body.ReservedConcurrentExecutions < 0 {
+		msg := "ReservedConcurrentExecutions must be at least 0"
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusBadRequest)
+		return
+	}
+
+	name := f.concurrencyFunction(response, request)
+	if name == "" {
+		return
+	}
+
+	err = f.functionRepo.PutFunctionConcurrency(request.Context(), name, *body.ReservedConcurrentExecutions)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to reserve concurrency for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	result := lambda.PutFunctionConcurrencyOutput{
+		ReservedConcurrentExecutions: body.ReservedConcurrentExecutions,
+		ResultMetadata:               middleware.Metadata{},
+	}
+
+	respondWithJson(response, result)
+}
+
+func (f FunctionHandler) GetFunctionConcurrency(response http.ResponseWriter, request *http.Request) {
+	name := f.concurrencyFunction(response, request)
+	if name == "" {
+		return
+	}
+
+	reserved, err := f.functionRepo.GetFunctionConcurrency(request.Context(), name)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to get reserved concurrency for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	result := lambda.GetFunctionConcurrencyOutput{
+		ReservedConcurrentExecutions: reserved,
+		ResultMetadata:               middleware.Metadata{},
+	}
+
+	respondWithJson(response, result)
+}
+
+func (f FunctionHandler) DeleteFunctionConcurrency(response http.ResponseWriter, request *http.Request) {
+	name := f.concurrencyFunction(response, request)
+	if name == "" {
+		return
+	}
+
+	err := f.functionRepo.DeleteFunctionConcurrency(request.Context(), name)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to remove reserved concurrency for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,62 @@
+package http_test
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func getConcurrency(t *testing.T, router http.Handler) *int32 {
+	response := serve(router, http.MethodGet, "/2019-09-30/functions/test-function/concurrency", "")
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	var result lambda.GetFunctionConcurrencyOutput
+	err := json.Unmarshal(response.Body.Bytes(), &result)
+	assert.NoError(t, err)
+
+	return result.ReservedConcurrentExecutions
+}
+
+func TestFunctionConcurrency(t *testing.T) {
+	router := newFunctionRouter(t)
+
+	assert.Nil(t, getConcurrency(t, router))
+
+	response := serve(router, http.MethodPut, "/2017-10-31/functions/test-function/concurrency",
+		`{"ReservedConcurrentExecutions": 3}`)
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	if reserved := getConcurrency(t, router); assert.NotNil(t, reserved) {
+		assert.Equal(t, int32(3), *reserved)
+	}
+
+	response = serve(router, http.MethodDelete, "/2017-10-31/functions/test-function/concurrency", "")
+	assert.Equal(t, http.StatusNoContent, response.Code, response.Body.String())
+
+	assert.Nil(t, getConcurrency(t, router))
+}
+
+func TestFunctionConcurrencyQualified(t *testing.T) {
+	router := newFunctionRouter(t)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{"get", http.MethodGet, "/2019-09-30/functions/test-function%3A1/concurrency", ""},
+		{"put", http.MethodPut, "/2017-10-31/functions/test-function%3A1/concurrency",
+			`{"ReservedConcurrentExecutions": 3}`},
+		{"delete", http.MethodDelete, "/2017-10-31/functions/test-function%3A1/concurrency", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := serve(router, test.method, test.target, test.body)
+			assert.Equal(t, http.StatusBadRequest, response.Code, response.Body.String())
+		})
+	}
+}
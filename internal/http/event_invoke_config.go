@@ -0,0 +1,296 @@
+package http
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"net/http"
+	"strconv"
+)
+
+type EventInvokeConfigHandler struct {
+	cfg          *settings.Config
+	configRepo   domain.EventInvokeConfigRepository
+	functionRepo domain.FunctionRepository
+	aliasRepo    domain.AliasRepository
+}
+
+func NewEventInvokeConfigHandler(cfg *settings.Config, configRepo domain.EventInvokeConfigRepository,
+	functionRepo domain.FunctionRepository, aliasRepo domain.AliasRepository) EventInvokeConfigHandler {
+
+	return EventInvokeConfigHandler{
+		cfg:          cfg,
+		configRepo:   configRepo,
+		functionRepo: functionRepo,
+		aliasRepo:    aliasRepo,
+	}
+}
+
+func (e EventInvokeConfigHandler) PutEventInvokeConfig(response http.ResponseWriter, request *http.Request) {
+	name, qualifier, ok := invokeConfigQualifier(response, request)
+	if !ok {
+		return
+	}
+
+	var body lambda.PutFunctionEventInvokeConfigInput
+	err := json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to decode request to put invoke config for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusBadRequest)
+		return
+	}
+
+	logger.Infof("Putting invoke config for %s of Function %s", qualifier, name)
+
+	ctx := request.Context()
+
+	if !e.checkQualifier(ctx, response, name, qualifier) {
+		return
+	}
+
+	config := domain.PutEventInvokeConfig(name, qualifier, &body)
+	e.save(response, request, config)
+}
+
+func (e EventInvokeConfigHandler) UpdateEventInvokeConfig(response http.ResponseWriter, request *http.Request) {
+	var body lambda.UpdateFunctionEventInvokeConfigInput
+	err := json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to decode request to update invoke config: %v", err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusBadRequest)
+		return
+	}
+
+	config := e.loadConfig(response, request)
+	if config == nil {
+		return
+	}
+
+	config.Update(&body)
+	e.save(response, request, config)
+}
+
+func (e EventInvokeConfigHandler) GetEventInvokeConfig(response http.ResponseWriter, request *http.Request) {
+	config := e.loadConfig(response, request)
+	if config == nil {
+		return
+	}
+
+	respondWithJson(response, config.ToFunctionEventInvokeConfig(e.cfg))
+}
+
+func (e EventInvokeConfigHandler) DeleteEventInvokeConfig(response http.ResponseWriter, request *http.Request) {
+	name, qualifier, ok := invokeConfigQualifier(response, request)
+	if !ok {
+		return
+	}
+
+	err := e.configRepo.DeleteEventInvokeConfig(request.Context(), name, qualifier)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to delete invoke config for %s of Function %s: %v", qualifier, name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+func (e EventInvokeConfigHandler) ListEventInvokeConfigs(response http.ResponseWriter, request *http.Request) {
+	name, _, ok := invokeConfigQualifier(response, request)
+	if !ok {
+		return
+	}
+
+	query := request.URL.Query()
+
+	maxItems := 50
+	if value := query.Get("MaxItems"); value != "" {
+		var err error
+		maxItems, err = strconv.Atoi(value)
+		if err != nil || maxItems < 1 || maxItems > 50 {
+			msg := fmt.Sprintf("Invalid MaxItems %s", value)
+			logger.Error(msg)
+			http.Error(response, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// marker is the qualifier of the last config in the previous page
+	after := ""
+	if marker := query.Get("Marker"); marker != "" {
+		decoded, err := base64.URLEncoding.DecodeString(marker)
+		if err != nil {
+			msg := fmt.Sprintf("Invalid marker %s: %v", marker, err)
+			logger.Error(msg)
+			http.Error(response, msg, http.StatusBadRequest)
+			return
+		}
+		after = string(decoded)
+	}
+
+	logger.Infof("Listing invoke configs for Function %s", name)
+
+	configs, err := e.configRepo.GetEventInvokeConfigs(request.Context(), name)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to list invoke configs for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]domain.FunctionEventInvokeConfig, 0, len(configs))
+	var nextMarker *string
+	for i, config := range configs {
+		if config.Qualifier <= after {
+			continue
+		}
+
+		if len(results) == maxItems {
+			marker := base64.URLEncoding.EncodeToString([]byte(configs[i-1].Qualifier))
+			nextMarker = &marker
+			break
+		}
+
+		results = append(results, config.ToFunctionEventInvokeConfig(e.cfg))
+	}
+
+	respondWithJson(response, domain.ListFunctionEventInvokeConfigsOutput{
+		FunctionEventInvokeConfigs: results,
+		NextMarker:                 nextMarker,
+	})
+}
+
+// invokeConfigQualifier returns the Function name & qualifier of the config in the URL, which is $LATEST if there
+// isn't a qualifier.
+func invokeConfigQualifier(response http.ResponseWriter, request *http.Request) (string, string, bool) {
+	name, qualifier, ok := functionNameAndQualifier(response, request)
+	if qualifier == "" {
+		qualifier = domain.LatestVersion
+	}
+
+	return name, qualifier, ok
+}
+
+// loadConfig writes the appropriate error response & returns nil if the config in the URL cannot be loaded.
+func (e EventInvokeConfigHandler) loadConfig(response http.ResponseWriter,
+	request *http.Request) *domain.EventInvokeConfig {
+
+	name, qualifier, ok := invokeConfigQualifier(response, request)
+	if !ok {
+		return nil
+	}
+
+	logger.Infof("Getting invoke config for %s of Function %s", qualifier, name)
+
+	config, err := e.configRepo.GetEventInvokeConfig(request.Context(), name, qualifier)
+	if err == sql.ErrNoRows {
+		http.NotFound(response, request)
+		return nil
+	}
+
+	if err != nil {
+		msg := fmt.Sprintf("Unable to get invoke config for %s of Function %s: %v", qualifier, name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return nil
+	}
+
+	return config
+}
+
+// save validates & saves the config, and then responds with it.
+func (e EventInvokeConfigHandler) save(response http.ResponseWriter, request *http.Request,
+	config *domain.EventInvokeConfig) {
+
+	err := validateEventInvokeConfig(config)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid invoke config for %s of Function %s: %v", config.Qualifier,
+			config.FunctionName, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusBadRequest)
+		return
+	}
+
+	err = e.configRepo.PutEventInvokeConfig(request.Context(), config)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to save invoke config for %s of Function %s: %v", config.Qualifier,
+			config.FunctionName, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJson(response, config.ToFunctionEventInvokeConfig(e.cfg))
+}
+
+// checkQualifier writes the appropriate error response & returns false unless the qualifier is $LATEST, a published
+// version or an Alias of the Function.
+func (e EventInvokeConfigHandler) checkQualifier(ctx context.Context, response http.ResponseWriter, name string,
+	qualifier string) bool {
+
+	err := e.findQualifier(ctx, name, qualifier)
+	switch {
+	case err == sql.ErrNoRows:
+		msg := fmt.Sprintf("Function %s:%s not found", name, qualifier)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusNotFound)
+		return false
+	case err != nil:
+		msg := fmt.Sprintf("Unable to load Function %s:%s: %v", name, qualifier, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
+
+// findQualifier returns sql.ErrNoRows unless the qualifier is $LATEST, a published version or an Alias of the
+// Function.
+func (e EventInvokeConfigHandler) findQualifier(ctx context.Context, name string, qualifier string) error {
+	if qualifier == domain.LatestVersion {
+		_, err := e.functionRepo.GetLatestFunctionByName(ctx, name)
+		return err
+	}
+
+	version, err := strconv.Atoi(qualifier)
+	if err != nil {
+		_, err = e.aliasRepo.GetAlias(ctx, name, qualifier)
+		return err
+	}
+
+	function, err := e.functionRepo.GetFunctionVersion(ctx, name, version)
+	if err == nil && function.Latest {
+		return sql.ErrNoRows
+	}
+
+	return err
+}
+
+// validateEventInvokeConfig applies the same limits as AWS does, and checks that destinations are for supported
+// services.
+func validateEventInvokeConfig(config *domain.EventInvokeConfig) error {
+	if attempts := config.MaximumRetryAttempts; attempts != nil && (*attempts < 0 || *attempts > 2) {
+		return fmt.Errorf("MaximumRetryAttempts %d must be between 0 and 2", *attempts)
+	}
+
+	if age := config.MaximumEventAgeInSeconds; age != nil && (*age < 60 || *age > 21600) {
+		return fmt.Errorf("MaximumEventAgeInSeconds %d must be between 60 and 21600", *age)
+	}
+
+	for _, destination := range []string{config.OnSuccess, config.OnFailure} {
+		if destination != "" && domain.DestinationService(destination) == "" {
+			return fmt.Errorf("destination %s must be a Function, SQS queue or event bus", destination)
+		}
+	}
+
+	return nil
+}
@@ -1,15 +1,23 @@
 package http
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/kafka"
+	"github.com/ATenderholt/rainbow-functions/internal/sqs"
+	"github.com/ATenderholt/rainbow-functions/internal/stream"
+	"github.com/ATenderholt/rainbow-functions/pkg/filter"
 	"github.com/ATenderholt/rainbow-functions/settings"
-	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -18,13 +26,34 @@ type EventSourceHandler struct {
 	cfg          *settings.Config
 	eventRepo    domain.EventSourceRepository
 	functionRepo domain.FunctionRepository
+	aliasRepo    domain.AliasRepository
+	sqs          *sqs.Manager
+	streams      *stream.Manager
+	kafka        *kafka.Manager
 }
 
-func NewEventSourceHandler(cfg *settings.Config, eventRepo domain.EventSourceRepository, functionRepo domain.FunctionRepository) EventSourceHandler {
+func NewEventSourceHandler(cfg *settings.Config, eventRepo domain.EventSourceRepository, functionRepo domain.FunctionRepository,
+	aliasRepo domain.AliasRepository, sqs *sqs.Manager, streams *stream.Manager, kafka *kafka.Manager) EventSourceHandler {
 	return EventSourceHandler{
 		cfg:          cfg,
 		eventRepo:    eventRepo,
 		functionRepo: functionRepo,
+		aliasRepo:    aliasRepo,
+		sqs:          sqs,
+		streams:      streams,
+		kafka:        kafka,
+	}
+}
+
+// manager returns the manager that consumes the Event Source, depending on whether it is a stream, Kafka or a queue.
+func (e EventSourceHandler) manager(eventSource *domain.EventSource) domain.EventSourceManager {
+	switch {
+	case eventSource.IsStream():
+		return e.streams
+	case eventSource.IsKafka():
+		return e.kafka
+	default:
+		return e.sqs
 	}
 }
 
@@ -32,7 +61,7 @@ func (e EventSourceHandler) PostEventSource(writer http.ResponseWriter, request
 	var requestBodyBuilder strings.Builder
 	reader := io.TeeReader(request.Body, &requestBodyBuilder)
 
-	var payload lambda.CreateEventSourceMappingInput
+	var payload domain.CreateEventSourceMappingInput
 	decoder := json.NewDecoder(reader)
 	err := decoder.Decode(&payload)
 	if err != nil {
@@ -42,23 +71,73 @@ func (e EventSourceHandler) PostEventSource(writer http.ResponseWriter, request
 		return
 	}
 
-	ctx := request.Context()
+	if !validResponseTypes(payload.FunctionResponseTypes) {
+		msg := fmt.Sprintf("invalid FunctionResponseTypes %v", payload.FunctionResponseTypes)
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusBadRequest)
+		return
+	}
 
-	function, err := e.functionRepo.GetLatestFunctionByName(ctx, *payload.FunctionName)
-	if err != nil {
-		msg := fmt.Sprintf("unable to load Function %s: %v", *payload.FunctionName, err)
+	if !validDestinationConfig(payload.DestinationConfig) {
+		msg := "only OnFailure destinations are supported for Event Sources"
 		logger.Error(msg)
-		http.Error(writer, msg, http.StatusInternalServerError)
+		http.Error(writer, msg, http.StatusBadRequest)
+		return
+	}
+
+	if !validStreamProcessing(payload.ParallelizationFactor, payload.TumblingWindowInSeconds) {
+		msg := "only the default ParallelizationFactor (1) & TumblingWindowInSeconds (0) are supported for Event Sources"
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusBadRequest)
+		return
+	}
+
+	ctx := request.Context()
+
+	function, alias := e.loadFunction(writer, request, aws.ToString(payload.FunctionName))
+	if function == nil {
 		return
 	}
 
+	enabled := true
+	if payload.Enabled != nil {
+		enabled = *payload.Enabled
+	}
+
 	eventSource := domain.EventSource{
-		UUID:         uuid.New(),
-		Enabled:      true,
-		Arn:          *payload.EventSourceArn,
-		Function:     function,
-		BatchSize:    *payload.BatchSize,
-		LastModified: time.Now().UnixMilli(),
+		UUID:          uuid.New(),
+		Enabled:       enabled,
+		Arn:           aws.ToString(payload.EventSourceArn),
+		Function:      function,
+		FunctionAlias: alias,
+		BatchSize:     int32OrDefault(payload.BatchSize, 10),
+		LastModified:  time.Now().UnixMilli(),
+
+		FunctionResponseTypes:          payload.FunctionResponseTypes,
+		MaximumBatchingWindowInSeconds: int32OrDefault(payload.MaximumBatchingWindowInSeconds, 0),
+		FilterPatterns:                 domain.FilterPatternsFrom(payload.FilterCriteria),
+		MaximumConcurrency:             maximumConcurrency(payload.ScalingConfig),
+		StartingPosition:               payload.StartingPosition,
+		StartingPositionTimestamp:      startingPositionTimestamp(payload.StartingPositionTimestamp),
+		BisectBatchOnFunctionError:     aws.ToBool(payload.BisectBatchOnFunctionError),
+		BootstrapServers:               bootstrapServers(payload.SelfManagedEventSource),
+		Topics:                         payload.Topics,
+		MaximumRetryAttempts:           int32OrDefault(payload.MaximumRetryAttempts, -1),
+		MaximumRecordAgeInSeconds:      int32OrDefault(payload.MaximumRecordAgeInSeconds, -1),
+		OnFailure:                      onFailureDestination(payload.DestinationConfig),
+	}
+
+	if payload.BatchSize == nil && !eventSource.IsQueue() {
+		// like AWS, batches of stream & Kafka records are larger by default than batches of messages
+		eventSource.BatchSize = 100
+	}
+
+	err = validateEventSource(&eventSource)
+	if err != nil {
+		msg := fmt.Sprintf("invalid Event Source: %v", err)
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusBadRequest)
+		return
 	}
 
 	logger.Infof("Saving Event Source: %+v", eventSource)
@@ -71,6 +150,15 @@ func (e EventSourceHandler) PostEventSource(writer http.ResponseWriter, request
 		return
 	}
 
+	if eventSource.Enabled {
+		// poll for as long as the mapping exists, not just for this request
+		err = e.manager(&eventSource).CreateEventSource(context.Background(), &eventSource)
+		if err != nil {
+			logger.Errorf("Unable to start Event Source %s: %v", eventSource.UUID, err)
+		}
+	}
+
+	e.manager(&eventSource).Describe(&eventSource)
 	body := eventSource.ToCreateEventSourceMappingOutput(e.cfg)
 
 	respondWithJson(writer, body)
@@ -81,23 +169,571 @@ func (e EventSourceHandler) GetEventSource(writer http.ResponseWriter, request *
 
 	logger.Infof("Getting event source %s", id)
 
+	eventSource := e.loadEventSource(writer, request, id)
+	if eventSource == nil {
+		return
+	}
+
+	e.manager(eventSource).Describe(eventSource)
+	body := eventSource.ToGetEventSourceMappingOutput(e.cfg)
+
+	respondWithJson(writer, body)
+}
+
+func (e EventSourceHandler) ListEventSources(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	functionName, qualifier := domain.ParseFunctionName(query.Get("FunctionName"))
+	arn := query.Get("EventSourceArn")
+
+	maxItems := 100
+	if value := query.Get("MaxItems"); value != "" {
+		var err error
+		maxItems, err = strconv.Atoi(value)
+		if err != nil || maxItems < 1 {
+			msg := fmt.Sprintf("Invalid MaxItems %s", value)
+			logger.Error(msg)
+			http.Error(writer, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// marker is the UUID of the last Event Source in the previous page
+	marker := query.Get("Marker")
+
+	logger.Infof("Listing Event Sources for Function %s and ARN %s", functionName, arn)
+
+	eventSources, err := e.eventRepo.GetAllEventSources(request.Context())
+	if err != nil {
+		msg := fmt.Sprintf("Unable to list Event Sources: %v", err)
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusInternalServerError)
+		return
+	}
+
+	configs := make([]domain.EventSourceMappingConfiguration, 0, len(eventSources))
+	var nextMarker *string
+	found := marker == ""
+	for i := range eventSources {
+		eventSource := &eventSources[i]
+		if !found {
+			found = eventSource.UUID.String() == marker
+			continue
+		}
+
+		if functionName != "" && eventSource.Function.FunctionName != functionName {
+			continue
+		}
+
+		// Event Sources of a qualified Function are only listed when they are bound to the same Alias or version
+		if qualifier != "" && eventSource.FunctionQualifier() != qualifier {
+			continue
+		}
+
+		if arn != "" && eventSource.Arn != arn {
+			continue
+		}
+
+		if len(configs) == maxItems {
+			nextMarker = configs[len(configs)-1].UUID
+			break
+		}
+
+		e.manager(eventSource).Describe(eventSource)
+		configs = append(configs, eventSource.ToEventSourceMappingConfiguration(e.cfg))
+	}
+
+	body := domain.ListEventSourceMappingsOutput{
+		EventSourceMappings: configs,
+		NextMarker:          nextMarker,
+	}
+
+	respondWithJson(writer, body)
+}
+
+func (e EventSourceHandler) PutEventSource(writer http.ResponseWriter, request *http.Request) {
+	id := chi.URLParam(request, "id")
+
+	var payload domain.UpdateEventSourceMappingInput
+	err := json.NewDecoder(request.Body).Decode(&payload)
+	if err != nil {
+		msg := fmt.Sprintf("unable to decode body for updating Event Source %s: %v", id, err)
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusBadRequest)
+		return
+	}
+
+	logger.Infof("Updating Event Source %s: %+v", id, payload)
+
+	if !validResponseTypes(payload.FunctionResponseTypes) {
+		msg := fmt.Sprintf("invalid FunctionResponseTypes %v", payload.FunctionResponseTypes)
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusBadRequest)
+		return
+	}
+
+	if !validDestinationConfig(payload.DestinationConfig) {
+		msg := "only OnFailure destinations are supported for Event Sources"
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusBadRequest)
+		return
+	}
+
+	if !validStreamProcessing(payload.ParallelizationFactor, payload.TumblingWindowInSeconds) {
+		msg := "only the default ParallelizationFactor (1) & TumblingWindowInSeconds (0) are supported for Event Sources"
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusBadRequest)
+		return
+	}
+
 	ctx := request.Context()
 
-	eventSource, err := e.eventRepo.GetEventSource(ctx, id)
+	eventSource := e.loadEventSource(writer, request, id)
+	if eventSource == nil {
+		return
+	}
+
+	if payload.FunctionName != nil {
+		function, alias := e.loadFunction(writer, request, *payload.FunctionName)
+		if function == nil {
+			return
+		}
+
+		eventSource.Function = function
+		eventSource.FunctionAlias = alias
+	}
+
+	if payload.BatchSize != nil {
+		eventSource.BatchSize = *payload.BatchSize
+	}
+
+	if payload.Enabled != nil {
+		eventSource.Enabled = *payload.Enabled
+	}
+
+	if payload.FunctionResponseTypes != nil {
+		eventSource.FunctionResponseTypes = payload.FunctionResponseTypes
+	}
+
+	if payload.MaximumBatchingWindowInSeconds != nil {
+		eventSource.MaximumBatchingWindowInSeconds = *payload.MaximumBatchingWindowInSeconds
+	}
+
+	if payload.BisectBatchOnFunctionError != nil {
+		eventSource.BisectBatchOnFunctionError = *payload.BisectBatchOnFunctionError
+	}
+
+	if payload.MaximumRetryAttempts != nil {
+		eventSource.MaximumRetryAttempts = *payload.MaximumRetryAttempts
+	}
+
+	if payload.MaximumRecordAgeInSeconds != nil {
+		eventSource.MaximumRecordAgeInSeconds = *payload.MaximumRecordAgeInSeconds
+	}
+
+	// an empty OnFailure destination removes it
+	if payload.DestinationConfig != nil {
+		eventSource.OnFailure = onFailureDestination(payload.DestinationConfig)
+	}
+
+	// an empty FilterCriteria removes the filters
+	if payload.FilterCriteria != nil {
+		eventSource.FilterPatterns = domain.FilterPatternsFrom(payload.FilterCriteria)
+	}
+
+	// likewise, an empty ScalingConfig removes the limit
+	if payload.ScalingConfig != nil {
+		eventSource.MaximumConcurrency = maximumConcurrency(payload.ScalingConfig)
+	}
+
+	err = validateEventSource(eventSource)
 	if err != nil {
-		msg := fmt.Sprintf("Unable to load Event Source %+v: %v", eventSource, err)
+		msg := fmt.Sprintf("invalid Event Source %s: %v", id, err)
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusBadRequest)
+		return
+	}
+
+	eventSource.LastModified = time.Now().UnixMilli()
+
+	err = e.eventRepo.UpdateEventSource(ctx, *eventSource)
+	if err != nil {
+		msg := fmt.Sprintf("unable to update Event Source %s: %v", id, err)
 		logger.Error(msg)
 		http.Error(writer, msg, http.StatusInternalServerError)
 		return
 	}
 
+	// restart the poller so that it picks up the changes
+	e.manager(eventSource).StopEventSource(eventSource.UUID)
+	if eventSource.Enabled {
+		err = e.manager(eventSource).StartEventSource(context.Background(), eventSource)
+		if err != nil {
+			logger.Errorf("Unable to start Event Source %s: %v", eventSource.UUID, err)
+		}
+	}
+
+	e.manager(eventSource).Describe(eventSource)
+	body := eventSource.ToUpdateEventSourceMappingOutput(e.cfg)
+
+	respondWithJson(writer, body)
+}
+
+func (e EventSourceHandler) DeleteEventSource(writer http.ResponseWriter, request *http.Request) {
+	id := chi.URLParam(request, "id")
+
+	logger.Infof("Deleting Event Source %s", id)
+
+	eventSource := e.loadEventSource(writer, request, id)
 	if eventSource == nil {
-		logger.Infof("Event Source %s not found", id)
-		http.NotFound(writer, request)
 		return
 	}
 
-	body := eventSource.ToGetEventSourceMappingOutput(e.cfg)
+	e.manager(eventSource).RemoveEventSource(eventSource.UUID)
 
+	err := e.eventRepo.DeleteEventSource(request.Context(), id)
+	if err != nil {
+		msg := fmt.Sprintf("unable to delete Event Source %s: %v", id, err)
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusInternalServerError)
+		return
+	}
+
+	body := eventSource.ToDeleteEventSourceMappingOutput(e.cfg)
+
+	writer.WriteHeader(http.StatusAccepted)
 	respondWithJson(writer, body)
 }
+
+// loadEventSource writes the appropriate error response & returns nil if the Event Source cannot be loaded.
+func (e EventSourceHandler) loadEventSource(writer http.ResponseWriter, request *http.Request, id string) *domain.EventSource {
+	// like AWS, an id that isn't a UUID can't belong to an Event Source
+	_, err := uuid.Parse(id)
+	if err != nil {
+		logger.Infof("Event Source %s not found: %v", id, err)
+		http.NotFound(writer, request)
+		return nil
+	}
+
+	eventSource, err := e.eventRepo.GetEventSource(request.Context(), id)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to load Event Source %s: %v", id, err)
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusInternalServerError)
+		return nil
+	}
+
+	if eventSource == nil {
+		logger.Infof("Event Source %s not found", id)
+		http.NotFound(writer, request)
+		return nil
+	}
+
+	return eventSource
+}
+
+// loadFunction writes the appropriate error response & returns nil if the Function (specified by name, partial ARN
+// or ARN) cannot be loaded. When qualified by a published version, that version is returned, and when qualified by an
+// Alias, $LATEST is returned along with the name of the Alias, since the version it points to may change.
+func (e EventSourceHandler) loadFunction(writer http.ResponseWriter, request *http.Request,
+	functionName string) (*domain.Function, string) {
+
+	name, qualifier := domain.ParseFunctionName(functionName)
+	if name == "" {
+		msg := "FunctionName is required for Event Sources"
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusBadRequest)
+		return nil, ""
+	}
+
+	function, alias, err := e.findFunction(request.Context(), name, qualifier)
+	switch {
+	case err == sql.ErrNoRows:
+		logger.Infof("Unable to find Function %s with qualifier %s", name, qualifier)
+		http.NotFound(writer, request)
+		return nil, ""
+	case err != nil:
+		msg := fmt.Sprintf("unable to load Function %s: %v", functionName, err)
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusInternalServerError)
+		return nil, ""
+	}
+
+	return function, alias
+}
+
+// findFunction returns sql.ErrNoRows unless the qualifier is empty, $LATEST, a published version or an Alias of the
+// Function.
+func (e EventSourceHandler) findFunction(ctx context.Context, name string,
+	qualifier string) (*domain.Function, string, error) {
+
+	if qualifier == "" || qualifier == domain.LatestVersion {
+		function, err := e.functionRepo.GetLatestFunctionByName(ctx, name)
+		return function, "", err
+	}
+
+	version, err := strconv.Atoi(qualifier)
+	if err != nil {
+		_, err = e.aliasRepo.GetAlias(ctx, name, qualifier)
+		if err != nil {
+			return nil, "", err
+		}
+
+		function, err := e.functionRepo.GetLatestFunctionByName(ctx, name)
+		return function, qualifier, err
+	}
+
+	function, err := e.functionRepo.GetFunctionVersion(ctx, name, version)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// $LATEST is only addressable by its qualifier
+	if function.Latest {
+		return nil, "", sql.ErrNoRows
+	}
+
+	return function, "", nil
+}
+
+func validResponseTypes(responseTypes []types.FunctionResponseType) bool {
+	for _, responseType := range responseTypes {
+		if responseType != types.FunctionResponseTypeReportBatchItemFailures {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validDestinationConfig is false when the DestinationConfig has an OnSuccess destination, since Event Sources only
+// send records to a destination when they are discarded.
+func validDestinationConfig(config *types.DestinationConfig) bool {
+	return config == nil || config.OnSuccess == nil || aws.ToString(config.OnSuccess.Destination) == ""
+}
+
+// validStreamProcessing is false when ParallelizationFactor or TumblingWindowInSeconds isn't its default, since each
+// shard is processed by a single poller & records aren't aggregated over windows.
+func validStreamProcessing(parallelizationFactor *int32, tumblingWindowInSeconds *int32) bool {
+	return (parallelizationFactor == nil || *parallelizationFactor == 1) &&
+		(tumblingWindowInSeconds == nil || *tumblingWindowInSeconds == 0)
+}
+
+// onFailureDestination returns the OnFailure destination of the DestinationConfig, or an empty string if there isn't
+// one.
+func onFailureDestination(config *types.DestinationConfig) string {
+	if config == nil || config.OnFailure == nil {
+		return ""
+	}
+
+	return aws.ToString(config.OnFailure.Destination)
+}
+
+// bootstrapServers returns the Kafka brokers of a self-managed Event Source, if there is one.
+func bootstrapServers(selfManaged *types.SelfManagedEventSource) []string {
+	if selfManaged == nil {
+		return nil
+	}
+
+	return selfManaged.Endpoints[string(types.EndPointTypeKafkaBootstrapServers)]
+}
+
+func validateEventSource(eventSource *domain.EventSource) error {
+	err := validateSource(eventSource)
+	if err != nil {
+		return err
+	}
+
+	err = validateBatching(eventSource)
+	if err != nil {
+		return err
+	}
+
+	err = validateFilterPatterns(eventSource.FilterPatterns)
+	if err != nil {
+		return err
+	}
+
+	err = validateStartingPosition(eventSource)
+	if err != nil {
+		return err
+	}
+
+	if eventSource.BisectBatchOnFunctionError && !eventSource.IsStream() {
+		return fmt.Errorf("BisectBatchOnFunctionError is only supported for streams")
+	}
+
+	err = validateFailures(eventSource)
+	if err != nil {
+		return err
+	}
+
+	return validateScaling(eventSource)
+}
+
+// validateSource checks that the Event Source is either an ARN, or the brokers & topic of self-managed Kafka.
+func validateSource(eventSource *domain.EventSource) error {
+	if !eventSource.IsKafka() {
+		if eventSource.Arn == "" {
+			return fmt.Errorf("EventSourceArn or SelfManagedEventSource is required")
+		}
+
+		if len(eventSource.Topics) > 0 {
+			return fmt.Errorf("Topics are only supported for Kafka")
+		}
+
+		return nil
+	}
+
+	if eventSource.Arn != "" {
+		return fmt.Errorf("EventSourceArn is not supported with SelfManagedEventSource")
+	}
+
+	// like AWS, a mapping consumes exactly one topic
+	if len(eventSource.Topics) != 1 || eventSource.Topics[0] == "" {
+		return fmt.Errorf("exactly one topic is required for Kafka, but got %v", eventSource.Topics)
+	}
+
+	for _, server := range eventSource.BootstrapServers {
+		if server == "" || strings.Contains(server, ",") {
+			return fmt.Errorf("invalid KAFKA_BOOTSTRAP_SERVERS %v", eventSource.BootstrapServers)
+		}
+	}
+
+	return nil
+}
+
+// validateBatching applies the same limits as AWS does for SQS queues, streams & Kafka.
+func validateBatching(eventSource *domain.EventSource) error {
+	if eventSource.BatchSize < 1 || eventSource.BatchSize > 10000 {
+		return fmt.Errorf("BatchSize %d must be between 1 and 10000", eventSource.BatchSize)
+	}
+
+	window := eventSource.MaximumBatchingWindowInSeconds
+	if window < 0 || window > 300 {
+		return fmt.Errorf("MaximumBatchingWindowInSeconds %d must be between 0 and 300", window)
+	}
+
+	if !eventSource.IsQueue() {
+		return nil
+	}
+
+	// FIFO queues are read in order, so batches can't be accumulated across receives
+	if strings.HasSuffix(eventSource.Arn, ".fifo") {
+		if eventSource.BatchSize > 10 {
+			return fmt.Errorf("BatchSize %d must be at most 10 for FIFO queues", eventSource.BatchSize)
+		}
+
+		if window != 0 {
+			return fmt.Errorf("MaximumBatchingWindowInSeconds is not supported for FIFO queues")
+		}
+	}
+
+	if eventSource.BatchSize > 10 && window < 1 {
+		return fmt.Errorf("MaximumBatchingWindowInSeconds must be at least 1 when BatchSize is more than 10")
+	}
+
+	return nil
+}
+
+// validateFilterPatterns checks that each pattern is valid, and that there are no more than AWS allows by default.
+func validateFilterPatterns(patterns []string) error {
+	if len(patterns) > 5 {
+		return fmt.Errorf("at most 5 filters are allowed, but got %d", len(patterns))
+	}
+
+	_, err := filter.NewCriteria(patterns)
+	return err
+}
+
+func maximumConcurrency(scalingConfig *domain.ScalingConfig) int32 {
+	if scalingConfig == nil {
+		return 0
+	}
+
+	return int32OrDefault(scalingConfig.MaximumConcurrency, 0)
+}
+
+// startingPositionTimestamp converts the timestamp from seconds since the epoch to millis, or 0 if there isn't one.
+func startingPositionTimestamp(timestamp *float64) int64 {
+	if timestamp == nil {
+		return 0
+	}
+
+	return int64(*timestamp * 1000)
+}
+
+// validateStartingPosition checks that streams & Kafka have a StartingPosition, with a timestamp if it is
+// AT_TIMESTAMP, and that queues don't.
+func validateStartingPosition(eventSource *domain.EventSource) error {
+	if eventSource.IsQueue() {
+		if eventSource.StartingPosition != "" || eventSource.StartingPositionTimestamp != 0 {
+			return fmt.Errorf("StartingPosition is only supported for streams and Kafka")
+		}
+		return nil
+	}
+
+	switch eventSource.StartingPosition {
+	case types.EventSourcePositionTrimHorizon, types.EventSourcePositionLatest:
+		if eventSource.StartingPositionTimestamp != 0 {
+			return fmt.Errorf("StartingPositionTimestamp is only supported with AT_TIMESTAMP")
+		}
+	case types.EventSourcePositionAtTimestamp:
+		if eventSource.Service() != "kinesis" {
+			return fmt.Errorf("AT_TIMESTAMP is only supported for Kinesis streams")
+		}
+
+		if eventSource.StartingPositionTimestamp == 0 {
+			return fmt.Errorf("StartingPositionTimestamp is required with AT_TIMESTAMP")
+		}
+	case "":
+		return fmt.Errorf("StartingPosition is required for streams and Kafka")
+	default:
+		return fmt.Errorf("invalid StartingPosition %s", eventSource.StartingPosition)
+	}
+
+	return nil
+}
+
+// validateFailures applies the same limits as AWS does for retrying & discarding records, which aren't supported for
+// Kafka, and checks that the OnFailure destination is an SQS queue.
+func validateFailures(eventSource *domain.EventSource) error {
+	retries := eventSource.MaximumRetryAttempts
+	age := eventSource.MaximumRecordAgeInSeconds
+	destination := eventSource.OnFailure
+
+	if eventSource.IsKafka() {
+		if retries != -1 || age != -1 || destination != "" {
+			return fmt.Errorf("MaximumRetryAttempts, MaximumRecordAgeInSeconds and DestinationConfig are not " +
+				"supported for Kafka")
+		}
+		return nil
+	}
+
+	if retries < -1 || retries > 10000 {
+		return fmt.Errorf("MaximumRetryAttempts %d must be between -1 and 10000", retries)
+	}
+
+	if age != -1 && (age < 60 || age > 604800) {
+		return fmt.Errorf("MaximumRecordAgeInSeconds %d must be -1 or between 60 and 604800", age)
+	}
+
+	if destination != "" && domain.DestinationService(destination) != "sqs" {
+		return fmt.Errorf("OnFailure destination %s must be an SQS queue", destination)
+	}
+
+	return nil
+}
+
+// validateScaling applies the same limits as AWS does for MaximumConcurrency, when it is set.
+func validateScaling(eventSource *domain.EventSource) error {
+	maximum := eventSource.MaximumConcurrency
+	if maximum != 0 && !eventSource.IsQueue() {
+		return fmt.Errorf("ScalingConfig is only supported for SQS queues")
+	}
+
+	if maximum != 0 && (maximum < 2 || maximum > 1000) {
+		return fmt.Errorf("MaximumConcurrency %d must be between 2 and 1000", maximum)
+	}
+
+	return nil
+}
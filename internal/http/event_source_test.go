@@ -0,0 +1,333 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	handler "github.com/ATenderholt/rainbow-functions/internal/http"
+	"github.com/ATenderholt/rainbow-functions/internal/kafka"
+	"github.com/ATenderholt/rainbow-functions/internal/repo"
+	"github.com/ATenderholt/rainbow-functions/internal/sqs"
+	"github.com/ATenderholt/rainbow-functions/internal/stream"
+	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// an Event Source can be created for each queue, since only one can map a queue to the same Function
+const queueArn = "arn:aws:sqs:us-west-2:271828182845:test-queue"
+
+// newEventSourceRouter routes requests for Event Sources, which are saved to a new database along with a Function
+// named test-function that has a published version 1, $LATEST version 2 & an Alias named live for version 1.
+func newEventSourceRouter(t *testing.T) *chi.Mux {
+	cfg := settings.DefaultConfig()
+	db := newDatabase(t)
+	ctx := context.Background()
+
+	functionRepo := repo.NewFunctionRepository(db)
+	aliasRepo := repo.NewAliasRepository(db)
+	eventRepo := repo.NewEventSourceRepository(db)
+
+	saved, err := functionRepo.InsertFunction(ctx, &domain.Function{
+		FunctionName: "test-function",
+		Version:      "1",
+		Handler:      "index.handler",
+		Runtime:      "python3.8",
+		Environment:  &types.Environment{},
+	})
+	if err != nil {
+		t.Fatalf("unable to insert Function: %v", err)
+	}
+
+	_, err = functionRepo.PublishFunction(ctx, saved, nil)
+	if err != nil {
+		t.Fatalf("unable to publish Function: %v", err)
+	}
+
+	err = aliasRepo.InsertAlias(ctx, &domain.Alias{FunctionName: "test-function", Name: "live", FunctionVersion: "1"})
+	if err != nil {
+		t.Fatalf("unable to insert Alias: %v", err)
+	}
+
+	sqsManager := sqs.NewManager(cfg, eventRepo)
+	eventHandler := handler.NewEventSourceHandler(cfg, eventRepo, functionRepo, aliasRepo, sqsManager,
+		stream.NewManager(cfg, eventRepo, sqsManager), kafka.NewManager(cfg, eventRepo))
+
+	return handler.NewChiMux(handler.LayerHandler{}, handler.FunctionHandler{}, handler.AliasHandler{}, eventHandler,
+		handler.EventInvokeConfigHandler{}, nil)
+}
+
+func serve(router http.Handler, method string, target string, body string) *httptest.ResponseRecorder {
+	return serveRequest(router, httptest.NewRequest(method, target, strings.NewReader(body)))
+}
+
+func serveRequest(router http.Handler, request *http.Request) *httptest.ResponseRecorder {
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response
+}
+
+// createEventSource creates a disabled Event Source, so that nothing polls the queue, and returns its UUID.
+func createEventSource(t *testing.T, router http.Handler, functionName string, arn string) string {
+	response := serve(router, http.MethodPost, "/2015-03-31/event-source-mappings",
+		`{"FunctionName": "`+functionName+`", "EventSourceArn": "`+arn+`", "Enabled": false}`)
+	if !assert.Equal(t, http.StatusOK, response.Code, response.Body.String()) {
+		t.FailNow()
+	}
+
+	var result domain.EventSourceMappingConfiguration
+	err := json.Unmarshal(response.Body.Bytes(), &result)
+	assert.NoError(t, err)
+
+	return *result.UUID
+}
+
+func listEventSources(t *testing.T, router http.Handler, query string) domain.ListEventSourceMappingsOutput {
+	response := serve(router, http.MethodGet, "/2015-03-31/event-source-mappings"+query, "")
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	var result domain.ListEventSourceMappingsOutput
+	err := json.Unmarshal(response.Body.Bytes(), &result)
+	assert.NoError(t, err)
+
+	return result
+}
+
+func TestPostEventSourceWithArn(t *testing.T) {
+	router := newEventSourceRouter(t)
+
+	id := createEventSource(t, router, "arn:aws:lambda:us-west-2:271828182845:function:test-function", queueArn)
+
+	response := serve(router, http.MethodGet, "/2015-03-31/event-source-mappings/"+id, "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), "function:test-function")
+}
+
+func TestPostEventSourceQualified(t *testing.T) {
+	router := newEventSourceRouter(t)
+	arn := "arn:aws:lambda:us-west-2:271828182845:function:test-function"
+
+	tests := []struct {
+		name         string
+		functionName string
+		expected     string
+	}{
+		{"unqualified", "test-function", arn},
+		{"latest", arn + ":$LATEST", arn},
+		{"version", "test-function:1", arn + ":1"},
+		{"alias", arn + ":live", arn + ":live"},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id := createEventSource(t, router, test.functionName, fmt.Sprintf("%s-%d", queueArn, i))
+
+			response := serve(router, http.MethodGet, "/2015-03-31/event-source-mappings/"+id, "")
+			assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+			var result domain.EventSourceMappingConfiguration
+			err := json.Unmarshal(response.Body.Bytes(), &result)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, *result.FunctionArn)
+		})
+	}
+
+	assert.Len(t, listEventSources(t, router, "?FunctionName=test-function").EventSourceMappings, 4)
+	assert.Len(t, listEventSources(t, router, "?FunctionName=test-function:live").EventSourceMappings, 1)
+	assert.Len(t, listEventSources(t, router, "?FunctionName=test-function:$LATEST").EventSourceMappings, 2)
+}
+
+func TestUpdateEventSourceQualified(t *testing.T) {
+	router := newEventSourceRouter(t)
+	id := createEventSource(t, router, "test-function", queueArn)
+
+	response := serve(router, http.MethodPut, "/2015-03-31/event-source-mappings/"+id,
+		`{"FunctionName": "test-function:live"}`)
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	list := listEventSources(t, router, "?FunctionName=test-function:live")
+	if assert.Len(t, list.EventSourceMappings, 1) {
+		assert.Equal(t, "arn:aws:lambda:us-west-2:271828182845:function:test-function:live",
+			*list.EventSourceMappings[0].FunctionArn)
+	}
+
+	response = serve(router, http.MethodPut, "/2015-03-31/event-source-mappings/"+id,
+		`{"FunctionName": "test-function"}`)
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	assert.Empty(t, listEventSources(t, router, "?FunctionName=test-function:live").EventSourceMappings)
+}
+
+func TestPostEventSourceErrors(t *testing.T) {
+	router := newEventSourceRouter(t)
+
+	tests := []struct {
+		name         string
+		functionName string
+		expected     int
+	}{
+		{"missing", "missing-function", http.StatusNotFound},
+		{"missing arn", "arn:aws:lambda:us-west-2:271828182845:function:missing-function", http.StatusNotFound},
+		{"missing version", "test-function:3", http.StatusNotFound},
+		{"latest version", "test-function:2", http.StatusNotFound},
+		{"missing alias", "arn:aws:lambda:us-west-2:271828182845:function:test-function:missing", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := serve(router, http.MethodPost, "/2015-03-31/event-source-mappings",
+				`{"FunctionName": "`+test.functionName+`", "EventSourceArn": "`+queueArn+`", "Enabled": false}`)
+			assert.Equal(t, test.expected, response.Code, response.Body.String())
+		})
+	}
+
+	assert.Empty(t, listEventSources(t, router, "").EventSourceMappings)
+}
+
+func TestPostEventSourceStreamProcessing(t *testing.T) {
+	router := newEventSourceRouter(t)
+
+	tests := []struct {
+		name     string
+		options  string
+		expected int
+	}{
+		{"default parallelization factor", `"ParallelizationFactor": 1`, http.StatusOK},
+		{"default tumbling window", `"TumblingWindowInSeconds": 0`, http.StatusOK},
+		{"parallelization factor", `"ParallelizationFactor": 2`, http.StatusBadRequest},
+		{"tumbling window", `"TumblingWindowInSeconds": 60`, http.StatusBadRequest},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			arn := fmt.Sprintf("arn:aws:kinesis:us-west-2:271828182845:stream/test-stream-%d", i)
+			response := serve(router, http.MethodPost, "/2015-03-31/event-source-mappings",
+				`{"FunctionName": "test-function", "EventSourceArn": "`+arn+`", "StartingPosition": "LATEST", `+
+					`"Enabled": false, `+test.options+`}`)
+			assert.Equal(t, test.expected, response.Code, response.Body.String())
+		})
+	}
+
+	assert.Len(t, listEventSources(t, router, "").EventSourceMappings, 2)
+}
+
+func TestListEventSources(t *testing.T) {
+	router := newEventSourceRouter(t)
+
+	ids := []string{
+		createEventSource(t, router, "test-function", queueArn+"-1"),
+		createEventSource(t, router, "test-function", queueArn+"-2"),
+		createEventSource(t, router, "test-function", queueArn+"-3"),
+	}
+
+	all := listEventSources(t, router, "?FunctionName=test-function")
+	assert.Len(t, all.EventSourceMappings, 3)
+	assert.Nil(t, all.NextMarker)
+
+	first := listEventSources(t, router, "?MaxItems=2")
+	if assert.Len(t, first.EventSourceMappings, 2) && assert.NotNil(t, first.NextMarker) {
+		assert.Equal(t, ids[0], *first.EventSourceMappings[0].UUID)
+		assert.Equal(t, ids[1], *first.EventSourceMappings[1].UUID)
+
+		second := listEventSources(t, router, "?MaxItems=2&Marker="+*first.NextMarker)
+		if assert.Len(t, second.EventSourceMappings, 1) {
+			assert.Equal(t, ids[2], *second.EventSourceMappings[0].UUID)
+		}
+		assert.Nil(t, second.NextMarker)
+	}
+
+	other := listEventSources(t, router, "?FunctionName=other-function")
+	assert.Empty(t, other.EventSourceMappings)
+
+	byArn := listEventSources(t, router, "?EventSourceArn="+queueArn+"-2")
+	if assert.Len(t, byArn.EventSourceMappings, 1) {
+		assert.Equal(t, ids[1], *byArn.EventSourceMappings[0].UUID)
+	}
+
+	response := serve(router, http.MethodGet, "/2015-03-31/event-source-mappings?MaxItems=0", "")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestUpdateEventSource(t *testing.T) {
+	router := newEventSourceRouter(t)
+	id := createEventSource(t, router, "test-function", queueArn)
+
+	response := serve(router, http.MethodPut, "/2015-03-31/event-source-mappings/"+id, `{"BatchSize": 5}`)
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	list := listEventSources(t, router, "")
+	if assert.Len(t, list.EventSourceMappings, 1) {
+		assert.Equal(t, int32(5), *list.EventSourceMappings[0].BatchSize)
+		assert.Equal(t, "Disabled", *list.EventSourceMappings[0].State)
+	}
+}
+
+func TestUpdateEventSourceErrors(t *testing.T) {
+	router := newEventSourceRouter(t)
+	id := createEventSource(t, router, "test-function", queueArn)
+
+	tests := []struct {
+		name     string
+		id       string
+		body     string
+		expected int
+	}{
+		{"missing", "6f3c1c51-9e0e-4b8e-a4a1-0d0c6d2c0d3a", `{"BatchSize": 5}`, http.StatusNotFound},
+		{"missing function", id, `{"FunctionName": "missing-function"}`, http.StatusNotFound},
+		{"missing version", id, `{"FunctionName": "test-function:3"}`, http.StatusNotFound},
+		{"missing alias", id, `{"FunctionName": "test-function:missing"}`, http.StatusNotFound},
+		{"invalid response types", id, `{"FunctionResponseTypes": ["Invalid"]}`, http.StatusBadRequest},
+		{"parallelization factor", id, `{"ParallelizationFactor": 2}`, http.StatusBadRequest},
+		{"tumbling window", id, `{"TumblingWindowInSeconds": 60}`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := serve(router, http.MethodPut, "/2015-03-31/event-source-mappings/"+test.id, test.body)
+			assert.Equal(t, test.expected, response.Code, response.Body.String())
+		})
+	}
+}
+
+func TestDeleteEventSource(t *testing.T) {
+	router := newEventSourceRouter(t)
+	id := createEventSource(t, router, "test-function", queueArn)
+
+	response := serve(router, http.MethodDelete, "/2015-03-31/event-source-mappings/"+id, "")
+	assert.Equal(t, http.StatusAccepted, response.Code, response.Body.String())
+
+	response = serve(router, http.MethodGet, "/2015-03-31/event-source-mappings/"+id, "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	response = serve(router, http.MethodDelete, "/2015-03-31/event-source-mappings/"+id, "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	assert.Empty(t, listEventSources(t, router, "").EventSourceMappings)
+}
+
+func TestEventSourceInvalidId(t *testing.T) {
+	router := newEventSourceRouter(t)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+	}{
+		{"get", http.MethodGet, ""},
+		{"update", http.MethodPut, `{"BatchSize": 5}`},
+		{"delete", http.MethodDelete, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := serve(router, test.method, "/2015-03-31/event-source-mappings/not-a-uuid", test.body)
+			assert.Equal(t, http.StatusNotFound, response.Code, response.Body.String())
+		})
+	}
+}
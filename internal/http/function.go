@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
@@ -8,6 +9,9 @@ import (
 	"fmt"
 	"github.com/ATenderholt/rainbow-functions/internal/docker"
 	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/kafka"
+	"github.com/ATenderholt/rainbow-functions/internal/sqs"
+	"github.com/ATenderholt/rainbow-functions/internal/stream"
 	"github.com/ATenderholt/rainbow-functions/pkg/zip"
 	"github.com/ATenderholt/rainbow-functions/settings"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
@@ -15,25 +19,45 @@ import (
 	"github.com/aws/smithy-go/middleware"
 	"github.com/go-chi/chi/v5"
 	"net/http"
+	"os"
 	"strconv"
+	"sync"
+	"time"
 )
 
 type FunctionHandler struct {
 	cfg          *settings.Config
 	functionRepo domain.FunctionRepository
+	aliasRepo    domain.AliasRepository
 	layerRepo    domain.LayerRepository
 	runtimeRepo  domain.RuntimeRepository
 	docker       *docker.Manager
+	sqs          *sqs.Manager
+	streams      *stream.Manager
+	kafka        *kafka.Manager
+
+	// a *sync.Mutex for each Function name, so that its container is only replaced by one update at a time
+	restarts *sync.Map
+
+	// restarts that haven't finished yet, which are drained on shutdown
+	restarting *sync.WaitGroup
 }
 
-func NewFunctionHandler(cfg *settings.Config, functionRepo domain.FunctionRepository, layerRepo domain.LayerRepository,
-	runtimeRepo domain.RuntimeRepository, docker *docker.Manager) FunctionHandler {
+func NewFunctionHandler(cfg *settings.Config, functionRepo domain.FunctionRepository, aliasRepo domain.AliasRepository,
+	layerRepo domain.LayerRepository, runtimeRepo domain.RuntimeRepository, docker *docker.Manager,
+	sqs *sqs.Manager, streams *stream.Manager, kafka *kafka.Manager) FunctionHandler {
 	return FunctionHandler{
 		cfg:          cfg,
 		functionRepo: functionRepo,
+		aliasRepo:    aliasRepo,
 		layerRepo:    layerRepo,
 		runtimeRepo:  runtimeRepo,
 		docker:       docker,
+		sqs:          sqs,
+		streams:      streams,
+		kafka:        kafka,
+		restarts:     &sync.Map{},
+		restarting:   &sync.WaitGroup{},
 	}
 }
 
@@ -79,14 +103,25 @@ func (f FunctionHandler) PostLambdaFunction(writer http.ResponseWriter, request
 		return
 	}
 
+	if dbVersion > 0 {
+		msg := fmt.Sprintf("Function %s already exists", *body.FunctionName)
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusConflict)
+		return
+	}
+
 	function := domain.CreateFunction(&body)
-	function.Version = strconv.Itoa(dbVersion + 1)
+	function.Version = "1"
+	function.Latest = true
 	rawHash := sha256.Sum256(code.ZipFile)
 	function.CodeSha256 = base64.StdEncoding.EncodeToString(rawHash[:])
+	function.CodeSize = int64(len(code.ZipFile))
 
 	// TODO : validate Layer runtime support
 
-	err = zip.UncompressZipFileBytes(code.ZipFile, function.GetDestPath(f.cfg))
+	_, err = extractOnce(function.GetDestPath(f.cfg), func(dir string) error {
+		return zip.UncompressZipFileBytes(code.ZipFile, dir)
+	})
 	if err != nil {
 		msg := fmt.Sprintf("error when saving function %s: %v", *body.FunctionName, err)
 		logger.Errorf(msg)
@@ -94,28 +129,35 @@ func (f FunctionHandler) PostLambdaFunction(writer http.ResponseWriter, request
 		return
 	}
 
-	layerDestPath := function.GetLayerDestPath(f.cfg)
-	err = createDirs(layerDestPath)
+	err = f.installLayers(function)
 	if err != nil {
-		msg := fmt.Sprintf("Unable to create Layer path for Function %s: %v", function.FunctionName, err)
+		msg := fmt.Sprintf("Unable to install Layers for Function %s: %v", function.FunctionName, err)
 		logger.Errorf(msg)
 		http.Error(writer, msg, http.StatusInternalServerError)
 		return
 	}
 
-	for _, layer := range function.Layers {
-		layerPath := layer.GetDestPath(f.cfg)
-		err = zip.UncompressZipFile(layerPath, layerDestPath)
+	saved, err := f.functionRepo.InsertFunction(ctx, function)
+	if err != nil {
+		msg := fmt.Sprintf("unable to save Function %s: %v", function.FunctionName, err)
+		logger.Error(msg)
+		http.Error(writer, msg, http.StatusInternalServerError)
+		return
+	}
+	saved.Layers = function.Layers
+
+	latest := saved
+	if body.Publish {
+		saved, latest, err = f.publish(ctx, saved, nil)
 		if err != nil {
-			msg := fmt.Sprintf("error when unpacking layer %s: %v", layer.Name, err)
-			logger.Errorf(msg)
+			msg := fmt.Sprintf("unable to publish Function %s: %v", function.FunctionName, err)
+			logger.Error(msg)
 			http.Error(writer, msg, http.StatusInternalServerError)
 			return
 		}
 	}
 
-	saved, err := f.functionRepo.InsertFunction(ctx, function)
-	err = f.docker.StartFunction(ctx, function)
+	err = f.docker.StartFunction(ctx, latest)
 	if err != nil {
 		msg := fmt.Sprintf("unable to start Function %s: %v", function.FunctionName, err)
 		logger.Error(msg)
@@ -128,8 +170,185 @@ func (f FunctionHandler) PostLambdaFunction(writer http.ResponseWriter, request
 	respondWithJson(writer, result)
 }
 
+// publish copies the code & layers of $LATEST before freezing it as a published version. Returns the published
+// version and the new $LATEST, whose container should be started or replaced by the caller.
+func (f FunctionHandler) publish(ctx context.Context, latest *domain.Function, description *string) (*domain.Function,
+	*domain.Function, error) {
+
+	version, err := strconv.Atoi(latest.Version)
+	if err != nil {
+		e := fmt.Errorf("unable to parse version %s of Function %s: %v", latest.Version, latest.FunctionName, err)
+		logger.Error(e)
+		return nil, nil, e
+	}
+
+	next := *latest
+	next.Version = strconv.Itoa(version + 1)
+	nextPath := next.GetBasePath(f.cfg)
+
+	// only the revisions in use are copied, since those that were replaced may not have been removed yet
+	err = copyDir(latest.GetDestPath(f.cfg), next.GetDestPath(f.cfg))
+	if err == nil {
+		err = copyDir(latest.GetLayerDestPath(f.cfg), next.GetLayerDestPath(f.cfg))
+	}
+
+	if err != nil {
+		e := fmt.Errorf("unable to copy Function %s for publishing: %v", latest.FunctionName, err)
+		logger.Error(e)
+		os.RemoveAll(nextPath)
+		return nil, nil, e
+	}
+
+	saved, err := f.functionRepo.PublishFunction(ctx, latest, description)
+	if err != nil {
+		os.RemoveAll(nextPath)
+		return nil, nil, err
+	}
+
+	published := *latest
+	published.Latest = false
+	if description != nil {
+		published.Description = *description
+	}
+
+	logger.Infof("Published version %s of Function %s", published.Version, published.FunctionName)
+
+	return &published, saved, nil
+}
+
+func (f FunctionHandler) installLayers(function *domain.Function) error {
+	_, err := extractOnce(function.GetLayerDestPath(f.cfg), func(dir string) error {
+		for _, layer := range function.Layers {
+			layerPath := layer.GetDestPath(f.cfg)
+			err := zip.UncompressZipFile(layerPath, dir)
+			if err != nil {
+				e := fmt.Errorf("error when unpacking layer %s: %v", layer.Name, err)
+				logger.Error(e)
+				return e
+			}
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+func (f FunctionHandler) PutLambdaCode(response http.ResponseWriter, request *http.Request) {
+	name, _, ok := functionParam(response, request)
+	if !ok {
+		return
+	}
+
+	logger.Infof("Updating code for Lambda Function %s ...", name)
+
+	decoder := json.NewDecoder(request.Body)
+	defer request.Body.Close()
+
+	var body lambda.UpdateFunctionCodeInput
+	err := decoder.Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Error when decoding body: %v", err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	ctx := request.Context()
+
+	function, err := f.functionRepo.GetLatestFunctionByName(ctx, name)
+
+	switch {
+	case err == sql.ErrNoRows:
+		logger.Infof("Unable to find Function named %s", name)
+		http.NotFound(response, request)
+		return
+	case err != nil:
+		msg := fmt.Sprintf("Error when querying for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	layers, err := f.functionRepo.GetLayersForFunction(ctx, *function)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to load Layers for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	// the revision of the code that the running container uses, which is removed once it has been replaced
+	var retired []string
+	previousPath := function.GetDestPath(f.cfg)
+
+	rawHash := sha256.Sum256(body.ZipFile)
+	function.Layers = layers
+	function.CodeSha256 = base64.StdEncoding.EncodeToString(rawHash[:])
+	function.CodeSize = int64(len(body.ZipFile))
+	function.LastModified = time.Now().UnixMilli()
+
+	if body.DryRun {
+		logger.Infof("Dry run, so not updating code for Function %s", name)
+		respondWithJson(response, function.ToUpdateFunctionCodeOutput(f.cfg))
+		return
+	}
+
+	destPath := function.GetDestPath(f.cfg)
+	if destPath != previousPath {
+		retired = append(retired, previousPath)
+	}
+
+	created, err := extractOnce(destPath, func(dir string) error {
+		return zip.UncompressZipFileBytes(body.ZipFile, dir)
+	})
+	if err != nil {
+		msg := fmt.Sprintf("error when saving function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	err = f.functionRepo.UpdateFunctionCode(ctx, function)
+	if err != nil {
+		if created {
+			os.RemoveAll(destPath)
+		}
+
+		msg := fmt.Sprintf("Unable to update code for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	result := function
+	latest := function
+	if body.Publish {
+		result, latest, err = f.publish(ctx, function, nil)
+		if err != nil {
+			msg := fmt.Sprintf("Unable to publish new version of Function %s: %v", name, err)
+			logger.Error(msg)
+			http.Error(response, msg, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = f.docker.ReplaceFunction(ctx, latest, retired...)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to replace running Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJson(response, result.ToUpdateFunctionCodeOutput(f.cfg))
+}
+
 func (f FunctionHandler) PutLambdaConfiguration(response http.ResponseWriter, request *http.Request) {
-	name := chi.URLParam(request, "name")
+	name, _, ok := functionParam(response, request)
+	if !ok {
+		return
+	}
 
 	logger.Infof("Setting configuration for Lambda Function %s ...", name)
 
@@ -163,6 +382,76 @@ func (f FunctionHandler) PutLambdaConfiguration(response http.ResponseWriter, re
 		return
 	}
 
+	layers, err := f.functionRepo.GetLayersForFunction(ctx, *function)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to load Layers for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+	function.Layers = layers
+
+	if body.Runtime != "" {
+		runtimeExists, err := f.runtimeRepo.RuntimeExistsByName(ctx, body.Runtime)
+		if err != nil {
+			msg := fmt.Sprintf("Error when querying runtime %s for function %s", body.Runtime, name)
+			logger.Error(msg)
+			http.Error(response, msg, http.StatusInternalServerError)
+			return
+		}
+
+		if !runtimeExists {
+			msg := fmt.Sprintf("Unable to find runtime %s for function %s", body.Runtime, name)
+			logger.Error(msg)
+			http.Error(response, msg, http.StatusNotFound)
+			return
+		}
+	}
+
+	// the Layers that the running container uses, which are removed once it has been replaced
+	var retired []string
+	previousLayerPath := function.GetLayerDestPath(f.cfg)
+
+	if body.Layers != nil {
+		requested := make([]domain.LambdaLayer, len(body.Layers))
+		for i, arn := range body.Layers {
+			layer := domain.LayerFromArn(arn)
+			requested[i], err = f.layerRepo.GetLayerByNameAndVersion(ctx, layer.Name, layer.Version)
+			if err != nil {
+				msg := fmt.Sprintf("Unable to find Layer %s for Function %s: %v", arn, name, err)
+				logger.Error(msg)
+				http.Error(response, msg, http.StatusBadRequest)
+				return
+			}
+		}
+
+		function.Layers = requested
+	}
+
+	if layerPath := function.GetLayerDestPath(f.cfg); layerPath != previousLayerPath {
+		err = f.installLayers(function)
+		if err != nil {
+			msg := fmt.Sprintf("Unable to install Layers for Function %s: %v", name, err)
+			logger.Error(msg)
+			http.Error(response, msg, http.StatusInternalServerError)
+			return
+		}
+
+		retired = append(retired, previousLayerPath)
+	}
+
+	function.ApplyConfiguration(&body)
+	function.LastUpdateStatus = aws.LastUpdateStatusInProgress
+	function.LastUpdateStatusReason = nil
+
+	err = f.functionRepo.UpdateFunctionConfiguration(ctx, function)
+	if err != nil {
+		msg := fmt.Sprintf("Error when updating Configuration for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
 	if body.Environment != nil {
 		err = f.functionRepo.UpsertFunctionEnvironment(ctx, function, body.Environment)
 		if err != nil {
@@ -173,23 +462,135 @@ func (f FunctionHandler) PutLambdaConfiguration(response http.ResponseWriter, re
 		}
 	}
 
+	f.restarting.Add(1)
+	go func() {
+		defer f.restarting.Done()
+		f.restartFunction(name, retired)
+	}()
+
 	result := function.ToUpdateFunctionConfigurationOutput(f.cfg)
 	respondWithJson(response, result)
 }
 
-func (f FunctionHandler) GetLambdaFunction(response http.ResponseWriter, request *http.Request) {
-	name := chi.URLParam(request, "name")
+// restartFunction replaces the running container for the named Function with one using its latest configuration, and
+// then records whether the update was successful. Updates of the same Function are restarted one at a time, so the
+// last one to be saved is the one that is running.
+func (f FunctionHandler) restartFunction(name string, retired []string) {
+	lock, _ := f.restarts.LoadOrStore(name, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	ctx := context.Background()
 
-	logger.Infof("Getting Lambda Function %s", name)
+	function, err := f.functionRepo.GetLatestFunctionByName(ctx, name)
+	if err != nil {
+		logger.Errorf("Unable to load Function %s to restart it: %v", name, err)
+		return
+	}
+
+	function.Layers, err = f.functionRepo.GetLayersForFunction(ctx, *function)
+	if err == nil {
+		// a later update may have changed the Layers back to those of an earlier one
+		current := function.GetLayerDestPath(f.cfg)
+		unused := make([]string, 0, len(retired))
+		for _, path := range retired {
+			if path != current {
+				unused = append(unused, path)
+			}
+		}
+
+		// nothing is installed unless the Layers were removed after being retired by an earlier update
+		err = f.installLayers(function)
+		if err == nil {
+			err = f.docker.ReplaceFunction(ctx, function, unused...)
+		}
+	}
+
+	if err != nil {
+		logger.Errorf("Unable to update Function %s: %v", name, err)
+		reason := err.Error()
+		function.LastUpdateStatus = aws.LastUpdateStatusFailed
+		function.LastUpdateStatusReason = &reason
+	} else {
+		logger.Infof("Finished updating Function %s", name)
+		function.LastUpdateStatus = aws.LastUpdateStatusSuccessful
+		function.LastUpdateStatusReason = nil
+	}
+
+	err = f.functionRepo.UpdateFunctionStatus(ctx, function)
+	if err != nil {
+		logger.Errorf("Unable to save status of update for Function %s: %v", name, err)
+	}
+}
+
+// ShutdownAll waits for restarts of updated Functions to finish until the context is done, so that their status
+// isn't left as InProgress.
+func (f FunctionHandler) ShutdownAll(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		f.restarting.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("restarts of Functions did not finish before shutdown: %v", ctx.Err())
+	}
+}
+
+// getFunction loads $LATEST when the qualifier is empty or $LATEST, otherwise the published version (or the version
+// an Alias points to). Returns sql.ErrNoRows if the Function, version or Alias doesn't exist.
+func (f FunctionHandler) getFunction(ctx context.Context, name string, qualifier string) (*domain.Function, error) {
+	if qualifier == "" || qualifier == domain.LatestVersion {
+		return f.functionRepo.GetLatestFunctionByName(ctx, name)
+	}
+
+	version, err := strconv.Atoi(qualifier)
+	if err != nil {
+		alias, err := f.aliasRepo.GetAlias(ctx, name, qualifier)
+		if err != nil {
+			return nil, err
+		}
+
+		return f.getFunction(ctx, name, alias.FunctionVersion)
+	}
+
+	function, err := f.functionRepo.GetFunctionVersion(ctx, name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// $LATEST is only addressable by its qualifier
+	if function.Latest {
+		return nil, sql.ErrNoRows
+	}
+
+	return function, nil
+}
+
+// loadFunction writes the appropriate error response & returns nil if the qualified Function cannot be loaded.
+func (f FunctionHandler) loadFunction(response http.ResponseWriter, request *http.Request) *domain.Function {
+	name, qualifier, ok := functionNameAndQualifier(response, request)
+	if !ok {
+		return nil
+	}
 
 	ctx := request.Context()
 
-	function, err := f.functionRepo.GetLatestFunctionByName(ctx, name)
+	function, err := f.getFunction(ctx, name, qualifier)
+	if err == sql.ErrNoRows {
+		logger.Infof("Unable to find Function %s with qualifier %s", name, qualifier)
+		http.NotFound(response, request)
+		return nil
+	}
+
 	if err != nil {
 		msg := fmt.Sprintf("Unable to get Lambda Function %s: %v", name, err)
 		logger.Error(msg)
 		http.Error(response, msg, http.StatusInternalServerError)
-		return
+		return nil
 	}
 
 	layers, err := f.functionRepo.GetLayersForFunction(ctx, *function)
@@ -197,17 +598,224 @@ func (f FunctionHandler) GetLambdaFunction(response http.ResponseWriter, request
 		msg := fmt.Sprintf("Unable to load Layers for Function %s: %v", name, err)
 		logger.Error(msg)
 		http.Error(response, msg, http.StatusInternalServerError)
-		return
+		return nil
 	}
 
 	function.Layers = layers
+
+	return function
+}
+
+func (f FunctionHandler) GetLambdaFunction(response http.ResponseWriter, request *http.Request) {
+	logger.Infof("Getting Lambda Function %s", chi.URLParam(request, "name"))
+
+	function := f.loadFunction(response, request)
+	if function == nil {
+		return
+	}
+
+	tags, err := f.functionRepo.GetTagsForFunction(request.Context(), *function)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to load Tags for Function %s: %v", function.FunctionName, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	reserved, err := f.functionRepo.GetFunctionConcurrency(request.Context(), function.FunctionName)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to load reserved concurrency for Function %s: %v", function.FunctionName, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	function.Tags = tags
+	function.ReservedConcurrency = reserved
 	result := function.ToGetFunctionOutput(f.cfg)
 
 	respondWithJson(response, result)
 }
 
+func (f FunctionHandler) GetLambdaConfiguration(response http.ResponseWriter, request *http.Request) {
+	logger.Infof("Getting configuration for Lambda Function %s", chi.URLParam(request, "name"))
+
+	function := f.loadFunction(response, request)
+	if function == nil {
+		return
+	}
+
+	result := function.ToFunctionConfiguration(f.cfg)
+
+	respondWithJson(response, result)
+}
+
+func (f FunctionHandler) PublishVersion(response http.ResponseWriter, request *http.Request) {
+	name, _, ok := functionParam(response, request)
+	if !ok {
+		return
+	}
+
+	logger.Infof("Publishing version of Lambda Function %s", name)
+
+	var body lambda.PublishVersionInput
+	err := json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to decode request to publish Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusBadRequest)
+		return
+	}
+
+	ctx := request.Context()
+
+	latest, err := f.functionRepo.GetLatestFunctionByName(ctx, name)
+	if err == sql.ErrNoRows {
+		logger.Infof("Unable to find Function named %s", name)
+		http.NotFound(response, request)
+		return
+	}
+
+	if err != nil {
+		msg := fmt.Sprintf("Unable to get Lambda Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	if body.CodeSha256 != nil && *body.CodeSha256 != latest.CodeSha256 {
+		msg := fmt.Sprintf("CodeSha256 %s does not match $LATEST of Function %s", *body.CodeSha256, name)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusPreconditionFailed)
+		return
+	}
+
+	layers, err := f.functionRepo.GetLayersForFunction(ctx, *latest)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to load Layers for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+	latest.Layers = layers
+
+	// nothing has changed since the last published version, so return it instead of publishing another
+	previous, err := f.previousVersion(ctx, latest)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to get previous version of Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	if previous != nil && previous.CodeSha256 == latest.CodeSha256 && previous.LastModified == latest.LastModified {
+		logger.Infof("Function %s is unchanged since version %s", name, previous.Version)
+		previous.Layers = layers
+		respondWithJson(response, previous.ToPublishVersionOutput(f.cfg))
+		return
+	}
+
+	published, next, err := f.publish(ctx, latest, body.Description)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to publish new version of Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	err = f.docker.ReplaceFunction(ctx, next)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to replace running Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJson(response, published.ToPublishVersionOutput(f.cfg))
+}
+
+// previousVersion returns the most recently published version of the Function, or nil if none has been published.
+func (f FunctionHandler) previousVersion(ctx context.Context, latest *domain.Function) (*domain.Function, error) {
+	version, err := strconv.Atoi(latest.Version)
+	if err != nil || version <= 1 {
+		return nil, nil
+	}
+
+	previous, err := f.functionRepo.GetFunctionVersion(ctx, latest.FunctionName, version-1)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return previous, err
+}
+
+func (f FunctionHandler) ListLambdaFunctions(response http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	allVersions := aws.FunctionVersion(query.Get("FunctionVersion")) == aws.FunctionVersionAll
+
+	maxItems := domain.MaxListItems
+	if value := query.Get("MaxItems"); value != "" {
+		var err error
+		maxItems, err = strconv.Atoi(value)
+		if err != nil || maxItems < 1 || maxItems > domain.MaxListItems {
+			msg := fmt.Sprintf("Invalid MaxItems %s, which must be between 1 and %d", value, domain.MaxListItems)
+			logger.Error(msg)
+			http.Error(response, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	afterName, afterVersion := "", 0
+	if marker := query.Get("Marker"); marker != "" {
+		var err error
+		afterName, afterVersion, err = domain.DecodeMarker(marker)
+		if err != nil {
+			msg := fmt.Sprintf("Unable to list Lambda Functions: %v", err)
+			logger.Error(msg)
+			http.Error(response, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	logger.Infof("Listing Lambda Functions")
+
+	ctx := request.Context()
+
+	// query one extra to know whether there is another page
+	functions, err := f.functionRepo.ListFunctions(ctx, afterName, afterVersion, maxItems+1, allVersions)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to list Lambda Functions: %v", err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	var nextMarker *string
+	if len(functions) > maxItems {
+		functions = functions[:maxItems]
+		last := functions[maxItems-1]
+		nextMarker = domain.EncodeMarker(last.FunctionName, last.Version)
+	}
+
+	configs := make([]aws.FunctionConfiguration, len(functions))
+	for i := range functions {
+		configs[i] = *functions[i].ToFunctionConfiguration(f.cfg)
+	}
+
+	results := lambda.ListFunctionsOutput{
+		Functions:      configs,
+		NextMarker:     nextMarker,
+		ResultMetadata: middleware.Metadata{},
+	}
+
+	respondWithJson(response, results)
+}
+
 func (f FunctionHandler) GetFunctionVersions(response http.ResponseWriter, request *http.Request) {
-	name := chi.URLParam(request, "name")
+	name, _, ok := functionParam(response, request)
+	if !ok {
+		return
+	}
 
 	logger.Infof("Getting Versions for Lambda Function %s", name)
 
@@ -223,8 +831,8 @@ func (f FunctionHandler) GetFunctionVersions(response http.ResponseWriter, reque
 	}
 
 	configs := make([]aws.FunctionConfiguration, len(functions))
-	for i, function := range functions {
-		configs[i] = *function.ToFunctionConfiguration(f.cfg)
+	for i := range functions {
+		configs[i] = *functions[i].ToFunctionConfiguration(f.cfg)
 	}
 
 	results := lambda.ListVersionsByFunctionOutput{
@@ -236,6 +844,189 @@ func (f FunctionHandler) GetFunctionVersions(response http.ResponseWriter, reque
 	respondWithJson(response, results)
 }
 
+func (f FunctionHandler) DeleteLambdaFunction(response http.ResponseWriter, request *http.Request) {
+	name, qualifier, ok := functionNameAndQualifier(response, request)
+	if !ok {
+		return
+	}
+
+	logger.Infof("Deleting Lambda Function %s (qualifier=%s)", name, qualifier)
+
+	ctx := request.Context()
+
+	versions, err := f.functionRepo.GetVersionsForFunctionName(ctx, name)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to get versions for Lambda Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	if len(versions) == 0 {
+		logger.Infof("Unable to find Function named %s", name)
+		http.NotFound(response, request)
+		return
+	}
+
+	if qualifier == "" {
+		f.deleteAllVersions(response, request, name, versions)
+		return
+	}
+
+	f.deleteVersion(response, request, name, qualifier, versions)
+}
+
+// stopEventSources stops the queues, streams & Kafka topics that invoke the Function, or a version of it if one is
+// specified.
+func (f FunctionHandler) stopEventSources(ctx context.Context, name string, version string) error {
+	err := f.sqs.StopEventSourcesForFunction(ctx, name, version)
+	if err != nil {
+		return err
+	}
+
+	err = f.streams.StopEventSourcesForFunction(ctx, name, version)
+	if err != nil {
+		return err
+	}
+
+	return f.kafka.StopEventSourcesForFunction(ctx, name, version)
+}
+
+func (f FunctionHandler) deleteAllVersions(response http.ResponseWriter, request *http.Request, name string,
+	versions []domain.Function) {
+
+	ctx := request.Context()
+
+	err := f.stopEventSources(ctx, name, "")
+	if err != nil {
+		msg := fmt.Sprintf("Unable to stop Event Sources for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	err = f.docker.StopFunction(ctx, name)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to stop Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	err = f.functionRepo.DeleteFunction(ctx, name)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to delete Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	for _, version := range versions {
+		f.removeBasePath(&version)
+	}
+
+	f.restarts.Delete(name)
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+func (f FunctionHandler) deleteVersion(response http.ResponseWriter, request *http.Request, name string,
+	qualifier string, versions []domain.Function) {
+
+	version, err := strconv.Atoi(qualifier)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to delete Function %s with qualifier %s: not a version", name, qualifier)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusBadRequest)
+		return
+	}
+
+	var function *domain.Function
+	latest := 0
+	for i, v := range versions {
+		number, _ := strconv.Atoi(v.Version)
+		if number > latest {
+			latest = number
+		}
+
+		if number == version {
+			function = &versions[i]
+		}
+	}
+
+	if function == nil {
+		logger.Infof("Unable to find version %d of Function %s", version, name)
+		http.NotFound(response, request)
+		return
+	}
+
+	if version == latest {
+		msg := fmt.Sprintf("Unable to delete version %d of Function %s since it is $LATEST", version, name)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusConflict)
+		return
+	}
+
+	ctx := request.Context()
+
+	aliases, err := f.aliasRepo.GetAliasesForFunction(ctx, name)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to get Aliases for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	for _, alias := range aliases {
+		_, routed := alias.AdditionalVersionWeights[function.Version]
+		if alias.FunctionVersion == function.Version || routed {
+			msg := fmt.Sprintf("Unable to delete version %d of Function %s since Alias %s refers to it", version, name,
+				alias.Name)
+			logger.Error(msg)
+			http.Error(response, msg, http.StatusConflict)
+			return
+		}
+	}
+
+	err = f.stopEventSources(ctx, name, function.Version)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to stop Event Sources for Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	err = f.docker.StopFunctionVersion(ctx, name, function.Version)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to stop version %d of Function %s: %v", version, name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	err = f.functionRepo.DeleteFunctionVersion(ctx, name, version)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to delete version %d of Function %s: %v", version, name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	f.removeBasePath(function)
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+func (f FunctionHandler) removeBasePath(function *domain.Function) {
+	basePath := function.GetBasePath(f.cfg)
+	logger.Infof("Removing %s for version %s of Function %s", basePath, function.Version, function.FunctionName)
+
+	err := os.RemoveAll(basePath)
+	if err != nil {
+		logger.Warnf("Unable to remove %s: %v", basePath, err)
+	}
+}
+
 func (f FunctionHandler) GetFunctionCodeSigning(response http.ResponseWriter, request *http.Request) {
 	result := lambda.GetFunctionCodeSigningConfigOutput{}
 	respondWithJson(response, result)
@@ -0,0 +1,239 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ATenderholt/rainbow-functions/internal/async"
+	"github.com/ATenderholt/rainbow-functions/internal/docker"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	handler "github.com/ATenderholt/rainbow-functions/internal/http"
+	"github.com/ATenderholt/rainbow-functions/internal/kafka"
+	"github.com/ATenderholt/rainbow-functions/internal/repo"
+	"github.com/ATenderholt/rainbow-functions/internal/sqs"
+	"github.com/ATenderholt/rainbow-functions/internal/stream"
+	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+// newFunctionRouter routes requests for Functions & their Event Sources, which are saved to a new database along with
+// a Function named test-function that has a published version 1 and $LATEST version 2.
+func newFunctionRouter(t *testing.T) *chi.Mux {
+	cfg := settings.DefaultConfig()
+	db := newDatabase(t)
+	ctx := context.Background()
+
+	functionRepo := repo.NewFunctionRepository(db)
+	aliasRepo := repo.NewAliasRepository(db)
+	eventRepo := repo.NewEventSourceRepository(db)
+
+	saved, err := functionRepo.InsertFunction(ctx, &domain.Function{
+		FunctionName: "test-function",
+		Version:      "1",
+		Handler:      "index.handler",
+		Runtime:      "python3.8",
+		Environment:  &types.Environment{},
+	})
+	if err != nil {
+		t.Fatalf("unable to insert Function: %v", err)
+	}
+
+	_, err = functionRepo.PublishFunction(ctx, saved, nil)
+	if err != nil {
+		t.Fatalf("unable to publish Function: %v", err)
+	}
+
+	// nothing is started, so the managers don't need Docker or the AWS services
+	sqsManager := sqs.NewManager(cfg, eventRepo)
+	streamManager := stream.NewManager(cfg, eventRepo, sqsManager)
+	kafkaManager := kafka.NewManager(cfg, eventRepo)
+	asyncManager := async.NewManager(cfg, functionRepo, aliasRepo, repo.NewAsyncInvocationRepository(db),
+		repo.NewEventInvokeConfigRepository(db), sqsManager)
+
+	dockerManager, err := docker.NewManager(cfg, functionRepo, aliasRepo, asyncManager)
+	if err != nil {
+		t.Fatalf("unable to create Docker manager: %v", err)
+	}
+
+	functionHandler := handler.NewFunctionHandler(cfg, functionRepo, aliasRepo, repo.NewLayerRepository(db),
+		repo.NewRuntimeRepository(db), dockerManager, sqsManager, streamManager, kafkaManager)
+	eventHandler := handler.NewEventSourceHandler(cfg, eventRepo, functionRepo, aliasRepo, sqsManager, streamManager,
+		kafkaManager)
+
+	return handler.NewChiMux(handler.LayerHandler{}, functionHandler, handler.AliasHandler{}, eventHandler,
+		handler.EventInvokeConfigHandler{}, nil)
+}
+
+func TestGetFunctionEscaped(t *testing.T) {
+	router := newFunctionRouter(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{"name", "test-function", "2"},
+		{"arn", "arn%3Aaws%3Alambda%3Aus-west-2%3A271828182845%3Afunction%3Atest-function", "2"},
+		{"partial arn", "271828182845%3Afunction%3Atest-function", "2"},
+		{"qualified name", "test-function%3A1", "1"},
+		{"qualified arn", "arn%3Aaws%3Alambda%3Aus-west-2%3A271828182845%3Afunction%3Atest-function%3A1", "1"},
+		{"latest", "test-function%3A%24LATEST", "2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := serve(router, http.MethodGet, "/2015-03-31/functions/"+test.path, "")
+			if !assert.Equal(t, http.StatusOK, response.Code, response.Body.String()) {
+				return
+			}
+
+			var result lambda.GetFunctionOutput
+			err := json.Unmarshal(response.Body.Bytes(), &result)
+			assert.NoError(t, err)
+			assert.Equal(t, "test-function", *result.Configuration.FunctionName)
+
+			version := *result.Configuration.Version
+			if version == domain.LatestVersion {
+				version = "2"
+			}
+			assert.Equal(t, test.expected, version)
+		})
+	}
+}
+
+func TestGetFunctionEscapedMissing(t *testing.T) {
+	router := newFunctionRouter(t)
+
+	response := serve(router, http.MethodGet, "/2015-03-31/functions/test-function%3A3", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	response = serve(router, http.MethodGet,
+		"/2015-03-31/functions/arn%3Aaws%3Alambda%3Aus-west-2%3A271828182845%3Afunction%3Amissing-function", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestGetFunctionInvalidEscape(t *testing.T) {
+	router := newFunctionRouter(t)
+
+	// requests can't be parsed with an invalid escape, but the router matches the raw path as it is sent
+	request, err := http.NewRequest(http.MethodGet, "/2015-03-31/functions/test-function", nil)
+	assert.NoError(t, err)
+	request.URL.RawPath = "/2015-03-31/functions/test-function%3"
+
+	response := serveRequest(router, request)
+	assert.Equal(t, http.StatusBadRequest, response.Code, response.Body.String())
+}
+
+func listFunctions(t *testing.T, router http.Handler, query string) lambda.ListFunctionsOutput {
+	response := serve(router, http.MethodGet, "/2015-03-31/functions"+query, "")
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	var result lambda.ListFunctionsOutput
+	err := json.Unmarshal(response.Body.Bytes(), &result)
+	assert.NoError(t, err)
+
+	return result
+}
+
+func TestListFunctionsPaging(t *testing.T) {
+	router := newFunctionRouter(t)
+
+	first := listFunctions(t, router, "?FunctionVersion=ALL&MaxItems=1")
+	if assert.Len(t, first.Functions, 1) && assert.NotNil(t, first.NextMarker) {
+		assert.Equal(t, "1", *first.Functions[0].Version)
+
+		last := listFunctions(t, router, "?FunctionVersion=ALL&MaxItems=1&Marker="+*first.NextMarker)
+		if assert.Len(t, last.Functions, 1) {
+			assert.Equal(t, domain.LatestVersion, *last.Functions[0].Version)
+		}
+		assert.Nil(t, last.NextMarker)
+	}
+
+	latest := listFunctions(t, router, "")
+	assert.Len(t, latest.Functions, 1)
+	assert.Nil(t, latest.NextMarker)
+}
+
+func TestListFunctionsInvalid(t *testing.T) {
+	router := newFunctionRouter(t)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"zero", "?MaxItems=0"},
+		{"negative", "?MaxItems=-1"},
+		{"too many", "?MaxItems=51"},
+		{"not a number", "?MaxItems=many"},
+		{"invalid marker", "?Marker=not-a-marker"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := serve(router, http.MethodGet, "/2015-03-31/functions"+test.query, "")
+			assert.Equal(t, http.StatusBadRequest, response.Code, response.Body.String())
+		})
+	}
+
+	assert.NotNil(t, listFunctions(t, router, "?MaxItems=50").Functions)
+}
+
+func TestDeleteFunction(t *testing.T) {
+	router := newFunctionRouter(t)
+	createEventSource(t, router, "test-function", queueArn)
+
+	response := serve(router, http.MethodDelete, "/2015-03-31/functions/test-function", "")
+	assert.Equal(t, http.StatusNoContent, response.Code, response.Body.String())
+
+	for _, path := range []string{"test-function", "test-function%3A1"} {
+		response = serve(router, http.MethodGet, "/2015-03-31/functions/"+path, "")
+		assert.Equal(t, http.StatusNotFound, response.Code, path)
+	}
+
+	assert.Empty(t, listEventSources(t, router, "").EventSourceMappings)
+
+	response = serve(router, http.MethodDelete, "/2015-03-31/functions/test-function", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestDeleteFunctionVersion(t *testing.T) {
+	router := newFunctionRouter(t)
+
+	response := serve(router, http.MethodDelete, "/2015-03-31/functions/test-function?Qualifier=1", "")
+	assert.Equal(t, http.StatusNoContent, response.Code, response.Body.String())
+
+	response = serve(router, http.MethodGet, "/2015-03-31/functions/test-function%3A1", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	response = serve(router, http.MethodGet, "/2015-03-31/functions/test-function", "")
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+}
+
+func TestDeleteFunctionVersionErrors(t *testing.T) {
+	router := newFunctionRouter(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		expected int
+	}{
+		{"missing function", "missing-function", http.StatusNotFound},
+		{"missing version", "test-function?Qualifier=3", http.StatusNotFound},
+		{"latest", "test-function?Qualifier=2", http.StatusConflict},
+		{"not a version", "test-function?Qualifier=live", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := serve(router, http.MethodDelete, "/2015-03-31/functions/"+test.path, "")
+			assert.Equal(t, test.expected, response.Code, response.Body.String())
+		})
+	}
+
+	// nothing was deleted
+	assert.Len(t, listFunctions(t, router, "?FunctionVersion=ALL").Functions, 2)
+}
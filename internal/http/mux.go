@@ -6,8 +6,8 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-func NewChiMux(layerHandler LayerHandler, functionHandler FunctionHandler, eventHandler EventSourceHandler,
-	docker *docker.Manager) *chi.Mux {
+func NewChiMux(layerHandler LayerHandler, functionHandler FunctionHandler, aliasHandler AliasHandler,
+	eventHandler EventSourceHandler, invokeConfigHandler EventInvokeConfigHandler, docker *docker.Manager) *chi.Mux {
 
 	r := chi.NewRouter()
 	r.Use(middleware.StripSlashes)
@@ -18,14 +18,41 @@ func NewChiMux(layerHandler LayerHandler, functionHandler FunctionHandler, event
 
 	r.Get("/2020-06-30/functions/{name}/code-signing-config", functionHandler.GetFunctionCodeSigning)
 	r.Get("/2015-03-31/functions/{name}/versions", functionHandler.GetFunctionVersions)
+	r.Post("/2015-03-31/functions/{name}/versions", functionHandler.PublishVersion)
+	r.Get("/2015-03-31/functions/{name}/configuration", functionHandler.GetLambdaConfiguration)
 	r.Put("/2015-03-31/functions/{name}/configuration", functionHandler.PutLambdaConfiguration)
+	r.Put("/2015-03-31/functions/{name}/code", functionHandler.PutLambdaCode)
+	r.Get("/2019-09-30/functions/{name}/concurrency", functionHandler.GetFunctionConcurrency)
+	r.Put("/2017-10-31/functions/{name}/concurrency", functionHandler.PutFunctionConcurrency)
+	r.Delete("/2017-10-31/functions/{name}/concurrency", functionHandler.DeleteFunctionConcurrency)
 	r.Get("/2015-03-31/functions/{name}", functionHandler.GetLambdaFunction)
+	r.Delete("/2015-03-31/functions/{name}", functionHandler.DeleteLambdaFunction)
+	r.Get("/2015-03-31/functions", functionHandler.ListLambdaFunctions)
 	r.Post("/2015-03-31/functions", functionHandler.PostLambdaFunction)
 
+	r.Get("/2015-03-31/functions/{name}/aliases/{alias}", aliasHandler.GetAlias)
+	r.Put("/2015-03-31/functions/{name}/aliases/{alias}", aliasHandler.PutAlias)
+	r.Delete("/2015-03-31/functions/{name}/aliases/{alias}", aliasHandler.DeleteAlias)
+	r.Get("/2015-03-31/functions/{name}/aliases", aliasHandler.ListAliases)
+	r.Post("/2015-03-31/functions/{name}/aliases", aliasHandler.PostAlias)
+
 	r.Post("/2015-03-31/functions/{name}/invocations", docker.Invoke)
 
+	r.Get("/2019-09-25/functions/{name}/event-invoke-config/list", invokeConfigHandler.ListEventInvokeConfigs)
+	r.Get("/2019-09-25/functions/{name}/event-invoke-config", invokeConfigHandler.GetEventInvokeConfig)
+	r.Put("/2019-09-25/functions/{name}/event-invoke-config", invokeConfigHandler.PutEventInvokeConfig)
+	r.Post("/2019-09-25/functions/{name}/event-invoke-config", invokeConfigHandler.UpdateEventInvokeConfig)
+	r.Delete("/2019-09-25/functions/{name}/event-invoke-config", invokeConfigHandler.DeleteEventInvokeConfig)
+
+	r.Get("/2017-03-31/tags/{arn}", functionHandler.ListTags)
+	r.Post("/2017-03-31/tags/{arn}", functionHandler.TagResource)
+	r.Delete("/2017-03-31/tags/{arn}", functionHandler.UntagResource)
+
+	r.Get("/2015-03-31/event-source-mappings", eventHandler.ListEventSources)
 	r.Post("/2015-03-31/event-source-mappings", eventHandler.PostEventSource)
 	r.Get("/2015-03-31/event-source-mappings/{id}", eventHandler.GetEventSource)
+	r.Put("/2015-03-31/event-source-mappings/{id}", eventHandler.PutEventSource)
+	r.Delete("/2015-03-31/event-source-mappings/{id}", eventHandler.DeleteEventSource)
 
 	return r
 }
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/url"
+)
+
+// taggedFunction writes the appropriate error response & returns nil if the Function for the ARN in the URL cannot
+// be loaded. Tags apply to the Function as a whole, so qualified ARNs aren't allowed.
+func (f FunctionHandler) taggedFunction(response http.ResponseWriter, request *http.Request) *domain.Function {
+	arn, err := url.PathUnescape(chi.URLParam(request, "arn"))
+	if err != nil {
+		msg := fmt.Sprintf("Invalid ARN %s: %v", chi.URLParam(request, "arn"), err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusBadRequest)
+		return nil
+	}
+
+	name, qualifier := domain.ParseFunctionName(arn)
+	if qualifier != "" {
+		msg := fmt.Sprintf("Unable to tag qualified ARN %s", arn)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusBadRequest)
+		return nil
+	}
+
+	function, err := f.functionRepo.GetLatestFunctionByName(request.Context(), name)
+	if err == sql.ErrNoRows {
+		logger.Infof("Unable to find Function named %s", name)
+		http.NotFound(response, request)
+		return nil
+	}
+
+	if err != nil {
+		msg := fmt.Sprintf("Unable to get Lambda Function %s: %v", name, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return nil
+	}
+
+	return function
+}
+
+func (f FunctionHandler) TagResource(response http.ResponseWriter, request *http.Request) {
+	var body lambda.TagResourceInput
+	err := json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to decode request to tag resource: %v", err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusBadRequest)
+		return
+	}
+
+	function := f.taggedFunction(response, request)
+	if function == nil {
+		return
+	}
+
+	err = f.functionRepo.TagFunction(request.Context(), function.FunctionName, body.Tags)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to tag Function %s: %v", function.FunctionName, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+func (f FunctionHandler) UntagResource(response http.ResponseWriter, request *http.Request) {
+	keys := request.URL.Query()["tagKeys"]
+
+	function := f.taggedFunction(response, request)
+	if function == nil {
+		return
+	}
+
+	err := f.functionRepo.UntagFunction(request.Context(), function.FunctionName, keys)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to untag Function %s: %v", function.FunctionName, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+func (f FunctionHandler) ListTags(response http.ResponseWriter, request *http.Request) {
+	function := f.taggedFunction(response, request)
+	if function == nil {
+		return
+	}
+
+	tags, err := f.functionRepo.GetTagsForFunction(request.Context(), *function)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to load Tags for Function %s: %v", function.FunctionName, err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusInternalServerError)
+		return
+	}
+
+	result := lambda.ListTagsOutput{
+		Tags:           tags,
+		ResultMetadata: middleware.Metadata{},
+	}
+
+	respondWithJson(response, result)
+}
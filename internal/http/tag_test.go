@@ -0,0 +1,79 @@
+package http_test
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+const functionArn = "arn%3Aaws%3Alambda%3Aus-west-2%3A271828182845%3Afunction%3Atest-function"
+
+func listTags(t *testing.T, router http.Handler, arn string) map[string]string {
+	response := serve(router, http.MethodGet, "/2017-03-31/tags/"+arn, "")
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	var result lambda.ListTagsOutput
+	err := json.Unmarshal(response.Body.Bytes(), &result)
+	assert.NoError(t, err)
+
+	return result.Tags
+}
+
+func TestTagResource(t *testing.T) {
+	router := newFunctionRouter(t)
+
+	response := serve(router, http.MethodPost, "/2017-03-31/tags/"+functionArn,
+		`{"Tags": {"team": "functions", "stage": "dev"}}`)
+	assert.Equal(t, http.StatusNoContent, response.Code, response.Body.String())
+
+	response = serve(router, http.MethodPost, "/2017-03-31/tags/"+functionArn, `{"Tags": {"stage": "prod"}}`)
+	assert.Equal(t, http.StatusNoContent, response.Code, response.Body.String())
+
+	assert.Equal(t, map[string]string{"team": "functions", "stage": "prod"}, listTags(t, router, functionArn))
+
+	// GetFunction returns the tags of the Function, whichever version is requested
+	for _, path := range []string{"test-function", "test-function%3A1"} {
+		response = serve(router, http.MethodGet, "/2015-03-31/functions/"+path, "")
+		if !assert.Equal(t, http.StatusOK, response.Code, response.Body.String()) {
+			continue
+		}
+
+		var result lambda.GetFunctionOutput
+		err := json.Unmarshal(response.Body.Bytes(), &result)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"team": "functions", "stage": "prod"}, result.Tags, path)
+	}
+
+	response = serve(router, http.MethodDelete, "/2017-03-31/tags/"+functionArn+"?tagKeys=stage&tagKeys=missing", "")
+	assert.Equal(t, http.StatusNoContent, response.Code, response.Body.String())
+
+	assert.Equal(t, map[string]string{"team": "functions"}, listTags(t, router, functionArn))
+}
+
+func TestTagResourceErrors(t *testing.T) {
+	router := newFunctionRouter(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		arn      string
+		expected int
+	}{
+		{"missing", http.MethodGet, "arn%3Aaws%3Alambda%3Aus-west-2%3A271828182845%3Afunction%3Amissing-function",
+			http.StatusNotFound},
+		{"qualified list", http.MethodGet, functionArn + "%3A1", http.StatusBadRequest},
+		{"qualified tag", http.MethodPost, functionArn + "%3A1", http.StatusBadRequest},
+		{"qualified untag", http.MethodDelete, functionArn + "%3A1?tagKeys=stage", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := serve(router, test.method, "/2017-03-31/tags/"+test.arn, `{"Tags": {"stage": "dev"}}`)
+			assert.Equal(t, test.expected, response.Code, response.Body.String())
+		})
+	}
+
+	assert.Empty(t, listTags(t, router, functionArn))
+}
@@ -6,8 +6,12 @@ import (
 	"github.com/ATenderholt/rainbow-functions/internal/domain"
 	"github.com/ATenderholt/rainbow-functions/settings"
 	aws "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/go-chi/chi/v5"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 )
 
 func createDirs(dirPath string) error {
@@ -22,6 +26,125 @@ func createDirs(dirPath string) error {
 	return nil
 }
 
+// extractOnce calls extract with a temporary directory next to destPath and then renames it to destPath, so that a
+// container never sees a partially extracted directory. Since each revision of a Function's code & Layers has its own
+// directory, nothing is extracted when destPath already exists. Returns whether destPath was created.
+func extractOnce(destPath string, extract func(string) error) (bool, error) {
+	if _, err := os.Stat(destPath); err == nil {
+		logger.Infof("%s already exists, so not extracting it again", destPath)
+		return false, nil
+	}
+
+	err := createDirs(filepath.Dir(destPath))
+	if err != nil {
+		return false, err
+	}
+
+	tmpPath, err := os.MkdirTemp(filepath.Dir(destPath), filepath.Base(destPath)+".tmp-")
+	if err != nil {
+		return false, err
+	}
+
+	err = os.Chmod(tmpPath, 0755)
+	if err == nil {
+		err = extract(tmpPath)
+	}
+
+	if err != nil {
+		os.RemoveAll(tmpPath)
+		return false, err
+	}
+
+	err = os.Rename(tmpPath, destPath)
+	if err != nil {
+		os.RemoveAll(tmpPath)
+
+		// extracted concurrently by another request for the same revision
+		if _, e := os.Stat(destPath); e == nil {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// copyDir recursively copies the contents of src into dest, preserving file modes & symlinks.
+func copyDir(src string, dest string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src string, dest string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// functionParam returns the Function name and qualifier from the {name} URL parameter, which may be a name, partial
+// ARN or full ARN. The router matches the escaped path, so the parameter is unescaped first, and the appropriate error
+// response is written & false returned if it can't be.
+func functionParam(response http.ResponseWriter, request *http.Request) (string, string, bool) {
+	value, err := url.PathUnescape(chi.URLParam(request, "name"))
+	if err != nil {
+		msg := fmt.Sprintf("Invalid Function name %s: %v", chi.URLParam(request, "name"), err)
+		logger.Error(msg)
+		http.Error(response, msg, http.StatusBadRequest)
+		return "", "", false
+	}
+
+	name, qualifier := domain.ParseFunctionName(value)
+	return name, qualifier, true
+}
+
+// functionNameAndQualifier is like functionParam, but with the Qualifier query parameter taking precedence.
+func functionNameAndQualifier(response http.ResponseWriter, request *http.Request) (string, string, bool) {
+	name, qualifier, ok := functionParam(response, request)
+	if value := request.URL.Query().Get("Qualifier"); value != "" {
+		qualifier = value
+	}
+
+	return name, qualifier, ok
+}
+
 func layersToAwsLayers(layers []domain.LambdaLayer, cfg *settings.Config) []aws.LayerVersionsListItem {
 	results := make([]aws.LayerVersionsListItem, len(layers))
 	for i, layer := range layers {
@@ -40,3 +163,11 @@ func respondWithJson(response http.ResponseWriter, value interface{}) {
 		http.Error(response, msg, http.StatusInternalServerError)
 	}
 }
+
+func int32OrDefault(p *int32, d int32) int32 {
+	if p == nil {
+		return d
+	}
+
+	return *p
+}
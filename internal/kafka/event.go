@@ -0,0 +1,120 @@
+package kafka
+
+import (
+	"encoding/json"
+	"github.com/ATenderholt/rainbow-functions/pkg/filter"
+	"github.com/segmentio/kafka-go"
+	"strconv"
+	"strings"
+)
+
+// Event is the payload that Lambda sends to Functions for a batch of records from self-managed Kafka
+type Event struct {
+	EventSource      string `json:"eventSource"`
+	BootstrapServers string `json:"bootstrapServers"`
+
+	// records of each partition, keyed by topic-partition
+	Records map[string][]Record `json:"records"`
+}
+
+type Record struct {
+	Topic         string `json:"topic"`
+	Partition     int    `json:"partition"`
+	Offset        int64  `json:"offset"`
+	Timestamp     int64  `json:"timestamp"`
+	TimestampType string `json:"timestampType"`
+
+	// base64 encoded when marshalled
+	Key   []byte `json:"key,omitempty"`
+	Value []byte `json:"value"`
+
+	// header values are arrays of bytes, rather than base64 encoded
+	Headers []map[string][]int `json:"headers"`
+}
+
+// NewEvent creates the Event for messages consumed from the brokers.
+func NewEvent(bootstrapServers []string, messages []kafka.Message) Event {
+	records := make(map[string][]Record)
+	for _, message := range messages {
+		key := message.Topic + "-" + strconv.Itoa(message.Partition)
+		records[key] = append(records[key], newRecord(message))
+	}
+
+	return Event{
+		EventSource:      "SelfManagedKafka",
+		BootstrapServers: strings.Join(bootstrapServers, ","),
+		Records:          records,
+	}
+}
+
+func newRecord(message kafka.Message) Record {
+	headers := make([]map[string][]int, len(message.Headers))
+	for i, header := range message.Headers {
+		value := make([]int, len(header.Value))
+		for j, b := range header.Value {
+			value[j] = int(b)
+		}
+		headers[i] = map[string][]int{header.Key: value}
+	}
+
+	var timestamp int64
+	if !message.Time.IsZero() {
+		timestamp = message.Time.UnixMilli()
+	}
+
+	return Record{
+		Topic:         message.Topic,
+		Partition:     message.Partition,
+		Offset:        message.Offset,
+		Timestamp:     timestamp,
+		TimestampType: "CREATE_TIME",
+		Key:           message.Key,
+		Value:         message.Value,
+		Headers:       headers,
+	}
+}
+
+// FilterMessages returns the messages that match the criteria. Like AWS, patterns are evaluated against the record
+// sent to the Function, with a value that is valid JSON matched as an object.
+func FilterMessages(criteria *filter.Criteria, messages []kafka.Message) []kafka.Message {
+	if criteria == nil {
+		return messages
+	}
+
+	results := make([]kafka.Message, 0, len(messages))
+	for _, message := range messages {
+		fields, err := recordFields(newRecord(message))
+		if err != nil {
+			logger.Errorf("Unable to evaluate filter criteria for offset %d of %s-%d: %v", message.Offset,
+				message.Topic, message.Partition, err)
+			results = append(results, message)
+			continue
+		}
+
+		if criteria.Matches(fields) {
+			results = append(results, message)
+		}
+	}
+
+	return results
+}
+
+func recordFields(record Record) (map[string]interface{}, error) {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(value, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	if json.Unmarshal(record.Value, &v) == nil {
+		fields["value"] = v
+	}
+
+	return fields, nil
+}
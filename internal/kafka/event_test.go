@@ -0,0 +1,95 @@
+package kafka_test
+
+import (
+	"encoding/json"
+	"github.com/ATenderholt/rainbow-functions/internal/kafka"
+	"github.com/ATenderholt/rainbow-functions/pkg/filter"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var servers = []string{"broker-1:9092", "broker-2:9092"}
+
+func TestNewEvent(t *testing.T) {
+	messages := []kafkago.Message{
+		{
+			Topic:     "orders",
+			Partition: 0,
+			Offset:    15,
+			Key:       []byte("key-1"),
+			Value:     []byte("hello"),
+			Headers:   []kafkago.Header{{Key: "source", Value: []byte("ab")}},
+			Time:      time.UnixMilli(1545084650987),
+		},
+		{Topic: "orders", Partition: 1, Offset: 3, Value: []byte("world")},
+		{Topic: "orders", Partition: 0, Offset: 16, Value: []byte("again")},
+	}
+
+	event := kafka.NewEvent(servers, messages)
+
+	assert.Equal(t, "SelfManagedKafka", event.EventSource)
+	assert.Equal(t, "broker-1:9092,broker-2:9092", event.BootstrapServers)
+	assert.Len(t, event.Records, 2)
+	assert.Len(t, event.Records["orders-0"], 2)
+	assert.Len(t, event.Records["orders-1"], 1)
+
+	record := event.Records["orders-0"][0]
+	assert.Equal(t, "orders", record.Topic)
+	assert.Equal(t, 0, record.Partition)
+	assert.Equal(t, int64(15), record.Offset)
+	assert.Equal(t, int64(1545084650987), record.Timestamp)
+	assert.Equal(t, "CREATE_TIME", record.TimestampType)
+	assert.Equal(t, []map[string][]int{{"source": {97, 98}}}, record.Headers)
+
+	assert.Equal(t, int64(16), event.Records["orders-0"][1].Offset)
+	assert.Equal(t, int64(0), event.Records["orders-1"][0].Timestamp)
+	assert.NotNil(t, event.Records["orders-1"][0].Headers)
+}
+
+func TestEventJson(t *testing.T) {
+	messages := []kafkago.Message{{Topic: "orders", Partition: 2, Offset: 7, Key: []byte("key-1"), Value: []byte("hello")}}
+
+	payload, err := json.Marshal(kafka.NewEvent(servers, messages))
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	err = json.Unmarshal(payload, &decoded)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "SelfManagedKafka", decoded["eventSource"])
+
+	records := decoded["records"].(map[string]interface{})
+	record := records["orders-2"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "orders", record["topic"])
+	assert.Equal(t, float64(7), record["offset"])
+	assert.Equal(t, "a2V5LTE=", record["key"])
+	assert.Equal(t, "aGVsbG8=", record["value"])
+	assert.Equal(t, []interface{}{}, record["headers"])
+}
+
+func TestFilterMessages(t *testing.T) {
+	criteria, err := filter.NewCriteria([]string{
+		`{"value": {"color": ["red"]}}`,
+		`{"topic": ["audit"]}`,
+	})
+	assert.NoError(t, err)
+
+	messages := []kafkago.Message{
+		{Topic: "orders", Offset: 1, Value: []byte(`{"color": "red"}`)},
+		{Topic: "orders", Offset: 2, Value: []byte(`{"color": "blue"}`)},
+		{Topic: "orders", Offset: 3, Value: []byte("not json")},
+		{Topic: "audit", Offset: 4, Value: []byte("not json")},
+	}
+
+	results := kafka.FilterMessages(criteria, messages)
+
+	assert.Equal(t, []kafkago.Message{messages[0], messages[3]}, results)
+}
+
+func TestFilterMessagesWithoutCriteria(t *testing.T) {
+	messages := []kafkago.Message{{Topic: "orders", Offset: 1}}
+
+	assert.Equal(t, messages, kafka.FilterMessages(nil, messages))
+}
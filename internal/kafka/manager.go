@@ -0,0 +1,312 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/ATenderholt/rainbow-functions/pkg/filter"
+	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"math/rand"
+	"time"
+)
+
+const (
+	// like AWS, records are batched for at least this long, since Kafka consumers fetch a record at a time
+	minimumWindow = 500 * time.Millisecond
+
+	// how long to spend committing offsets, which happens even if the Event Source is stopping
+	commitTimeout = 30 * time.Second
+)
+
+// Manager consumes Event Sources for self-managed Kafka, each with a consumer group named after its UUID.
+type Manager struct {
+	cfg       *settings.Config
+	eventRepo domain.EventSourceRepository
+	pollers   *poller.Registry
+	lambda    *poller.Lambda
+}
+
+func NewManager(cfg *settings.Config, eventRepo domain.EventSourceRepository) *Manager {
+	return &Manager{
+		cfg:       cfg,
+		eventRepo: eventRepo,
+		pollers:   poller.NewRegistry(),
+		lambda:    poller.NewLambda(cfg),
+	}
+}
+
+// CreateEventSource starts consumption for a newly created Event Source.
+func (m *Manager) CreateEventSource(ctx context.Context, eventSource *domain.EventSource) error {
+	return m.startEventSource(ctx, eventSource, poller.StateCreating)
+}
+
+// StartEventSource starts consumption for an existing Event Source that is being enabled.
+func (m *Manager) StartEventSource(ctx context.Context, eventSource *domain.EventSource) error {
+	return m.startEventSource(ctx, eventSource, poller.StateEnabling)
+}
+
+func (m *Manager) startEventSource(ctx context.Context, eventSource *domain.EventSource, state string) error {
+	logger.Infof("Starting consumption from topics %v ...", eventSource.Topics)
+
+	st := m.pollers.NewStatus(eventSource.UUID, state)
+
+	criteria, err := filter.NewCriteria(eventSource.FilterPatterns)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to parse filter criteria for Event Source %s: %v", eventSource.UUID, err)
+		logger.Error(msg)
+		m.pollers.SetState(st, poller.StateDisabled, "PROBLEM: "+msg)
+		return errors.New(msg)
+	}
+
+	// the reader connects to the brokers in the background, so that it keeps retrying if they aren't available yet
+	m.pollers.Run(ctx, eventSource.UUID, st, func(ctx context.Context) {
+		m.consume(ctx, eventSource, criteria, st)
+	})
+
+	return nil
+}
+
+func (m *Manager) newReader(eventSource *domain.EventSource, st *poller.Status) *kafka.Reader {
+	startOffset := kafka.LastOffset
+	if eventSource.StartingPosition == types.EventSourcePositionTrimHorizon {
+		startOffset = kafka.FirstOffset
+	}
+
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     eventSource.BootstrapServers,
+		GroupID:     eventSource.UUID.String(),
+		GroupTopics: eventSource.Topics,
+		StartOffset: startOffset,
+		MaxWait:     time.Second,
+
+		// offsets are committed once the Function has processed them
+		CommitInterval: 0,
+
+		Logger: kafka.LoggerFunc(logger.Debugf),
+		ErrorLogger: kafka.LoggerFunc(func(msg string, args ...interface{}) {
+			logger.Errorf(msg, args...)
+			m.pollers.SetProblem(st, "PROBLEM: "+fmt.Sprintf(msg, args...))
+		}),
+	})
+}
+
+// consume fetches batches of records for the consumer group & invokes the Function with each, until the context is
+// cancelled. Offsets are only committed once the Function succeeds, so records that were fetched but not processed
+// are consumed again when the Event Source is restarted. Fetch errors are retried with backoff.
+func (m *Manager) consume(ctx context.Context, eventSource *domain.EventSource, criteria *filter.Criteria,
+	st *poller.Status) {
+
+	reader := m.newReader(eventSource, st)
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			logger.Errorf("Unable to close consumer for Event Source %s: %v", eventSource.UUID, err)
+		}
+	}()
+
+	failures := 0
+	for {
+		messages, err := m.collect(ctx, eventSource, reader)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// the reader has moved past records that were fetched before an error, so they're processed first, since
+		// committing a later batch would skip them
+		if len(messages) > 0 && !m.process(ctx, eventSource, reader, criteria, messages, st) {
+			return
+		}
+
+		if err == nil {
+			if failures > 0 {
+				logger.Infof("Consuming for Event Source %s recovered after %d failures", eventSource.UUID, failures)
+				failures = 0
+			}
+			m.pollers.SetProblem(st, "")
+			continue
+		}
+
+		delay := poller.Backoff(failures, rand.Float64())
+		failures++
+
+		logger.Errorf("Unable to consume topics %v for Event Source %s (attempt %d), retrying in %v: %v",
+			eventSource.Topics, eventSource.UUID, failures, delay, err)
+		m.pollers.SetProblem(st, fmt.Sprintf("PROBLEM: Unable to consume topics %v: %v", eventSource.Topics, err))
+
+		if !poller.Sleep(ctx, delay) {
+			return
+		}
+	}
+}
+
+// collect fetches records until there are BatchSize of them, or the batching window has passed since the first one
+// was fetched. Records that were fetched before an error are returned along with it.
+func (m *Manager) collect(ctx context.Context, eventSource *domain.EventSource,
+	reader *kafka.Reader) ([]kafka.Message, error) {
+
+	window := time.Duration(eventSource.MaximumBatchingWindowInSeconds) * time.Second
+	if window < minimumWindow {
+		window = minimumWindow
+	}
+
+	message, err := reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	batchCtx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+
+	messages := []kafka.Message{message}
+	for int32(len(messages)) < eventSource.BatchSize {
+		message, err = reader.FetchMessage(batchCtx)
+		if batchCtx.Err() != nil {
+			break
+		}
+
+		if err != nil {
+			return messages, err
+		}
+
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+// process invokes the Function with the batch of records until it succeeds & then commits their offsets, returning
+// false if the context is cancelled first. Records that don't match the filter criteria are committed without
+// invoking the Function.
+func (m *Manager) process(ctx context.Context, eventSource *domain.EventSource, reader *kafka.Reader,
+	criteria *filter.Criteria, messages []kafka.Message, st *poller.Status) bool {
+
+	logger.Infof("Consumed %d records for Event Source %s", len(messages), eventSource.UUID)
+
+	matched := FilterMessages(criteria, messages)
+	if len(matched) < len(messages) {
+		logger.Infof("Skipping %d records that don't match filter criteria", len(messages)-len(matched))
+	}
+
+	failures := 0
+	for len(matched) > 0 {
+		err := m.invoke(eventSource, matched)
+		if err == nil {
+			m.pollers.SetResult(st, poller.ResultOk)
+			break
+		}
+
+		m.pollers.SetResult(st, poller.ResultFunctionFailed)
+
+		delay := poller.Backoff(failures, rand.Float64())
+		failures++
+
+		logger.Errorf("Retrying %d records in %v (attempt %d): %v", len(matched), delay, failures, err)
+
+		if !poller.Sleep(ctx, delay) {
+			return false
+		}
+	}
+
+	commitCtx, cancel := context.WithTimeout(context.Background(), commitTimeout)
+	defer cancel()
+
+	err := reader.CommitMessages(commitCtx, messages...)
+	if err != nil {
+		logger.Errorf("Unable to commit %d records, which may be processed again: %v", len(messages), err)
+	}
+
+	return true
+}
+
+func (m *Manager) invoke(eventSource *domain.EventSource, messages []kafka.Message) error {
+	payload, err := json.Marshal(NewEvent(eventSource.BootstrapServers, messages))
+	if err != nil {
+		return fmt.Errorf("unable to marshal %d records to bytes: %v", len(messages), err)
+	}
+
+	// Event Sources bound to an Alias or published version invoke it rather than $LATEST
+	function := eventSource.InvokedName()
+	_, err = m.lambda.Invoke(&function, payload)
+	return err
+}
+
+// StopEventSource cancels consumption for the Event Source that is being disabled, if it is running.
+func (m *Manager) StopEventSource(id uuid.UUID) {
+	m.pollers.Stop(id, poller.StateDisabling)
+}
+
+// RemoveEventSource cancels consumption for the Event Source that is being deleted, if it is running.
+func (m *Manager) RemoveEventSource(id uuid.UUID) {
+	m.pollers.Stop(id, poller.StateDeleting)
+}
+
+// Describe sets the current state of the Event Source, as well as the reason for it & the result of the last poll.
+func (m *Manager) Describe(eventSource *domain.EventSource) {
+	m.pollers.Describe(eventSource)
+}
+
+// ShutdownAll stops consumption for all Event Sources, and waits for in-flight batches to finish until the context
+// is done.
+func (m *Manager) ShutdownAll(ctx context.Context) error {
+	return m.pollers.ShutdownAll(ctx)
+}
+
+// StartAllEventSources starts consumption for all enabled Event Sources for self-managed Kafka.
+func (m *Manager) StartAllEventSources(ctx context.Context) error {
+	sources, err := m.eventRepo.GetAllEventSources(ctx)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to start All Kafka Event Sources: %v", err)
+		logger.Error(msg)
+		return errors.New(msg)
+	}
+
+	for i := range sources {
+		source := &sources[i]
+		if !source.IsKafka() {
+			continue
+		}
+
+		if !source.Enabled {
+			logger.Infof("Event Source %s is disabled, so not starting it", source.UUID)
+			continue
+		}
+
+		err = m.StartEventSource(ctx, source)
+		if err != nil {
+			logger.Errorf("Unable to start Event Source %s", source.UUID)
+		}
+	}
+
+	return nil
+}
+
+// StopEventSourcesForFunction cancels consumption for all Kafka Event Sources of the named Function. If version
+// is non-empty, only Event Sources for that version of the Function are stopped.
+func (m *Manager) StopEventSourcesForFunction(ctx context.Context, name string, version string) error {
+	sources, err := m.eventRepo.GetAllEventSources(ctx)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to stop Kafka Event Sources for Function %s: %v", name, err)
+		logger.Error(msg)
+		return errors.New(msg)
+	}
+
+	for _, source := range sources {
+		if !source.IsKafka() || source.Function.FunctionName != name {
+			continue
+		}
+
+		if version != "" && source.Function.Version != version {
+			continue
+		}
+
+		m.RemoveEventSource(source.UUID)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package poller
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// first & longest delays between retries of an operation that keeps failing
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// Backoff returns the delay before retrying an operation that has failed the specified number of times in a row.
+// The delay doubles with each attempt up to maxBackoff, and random (between 0 & 1) jitters its second half so that
+// pollers which failed together don't retry in lockstep.
+func Backoff(attempt int, random float64) time.Duration {
+	delay := maxBackoff
+	if attempt < 16 {
+		delay = minBackoff << attempt
+	}
+
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	return delay/2 + time.Duration(random*float64(delay/2))
+}
+
+// Sleep waits for the duration, returning false if the context is cancelled first.
+func Sleep(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,24 @@
+package poller_test
+
+import (
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBackoffDoubles(t *testing.T) {
+	assert.Equal(t, time.Second, poller.Backoff(0, 1))
+	assert.Equal(t, 2*time.Second, poller.Backoff(1, 1))
+	assert.Equal(t, 4*time.Second, poller.Backoff(2, 1))
+}
+
+func TestBackoffJitter(t *testing.T) {
+	assert.Equal(t, 2*time.Second, poller.Backoff(2, 0))
+	assert.Equal(t, 3*time.Second, poller.Backoff(2, 0.5))
+}
+
+func TestBackoffLimited(t *testing.T) {
+	assert.Equal(t, time.Minute, poller.Backoff(6, 1))
+	assert.Equal(t, time.Minute, poller.Backoff(100, 1))
+}
@@ -0,0 +1,75 @@
+package poller
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/google/uuid"
+	"time"
+)
+
+// conditions under which an Event Source discards records & sends them to its OnFailure destination
+const (
+	ConditionRetryAttemptsExhausted = "RetryAttemptsExhausted"
+	ConditionRecordAgeExceeded      = "RecordAgeExceeded"
+)
+
+// FailureRecord is what Lambda sends to the OnFailure destination of an Event Source about a batch of records that it
+// discarded. Each service adds the details of the batch to it.
+type FailureRecord struct {
+	RequestContext  FailureRequestContext   `json:"requestContext"`
+	ResponseContext *FailureResponseContext `json:"responseContext,omitempty"`
+	Version         string                  `json:"version"`
+	Timestamp       string                  `json:"timestamp"`
+}
+
+type FailureRequestContext struct {
+	RequestId              string `json:"requestId"`
+	FunctionArn            string `json:"functionArn"`
+	Condition              string `json:"condition"`
+	ApproximateInvokeCount int    `json:"approximateInvokeCount"`
+}
+
+type FailureResponseContext struct {
+	StatusCode      int    `json:"statusCode"`
+	ExecutedVersion string `json:"executedVersion,omitempty"`
+	FunctionError   string `json:"functionError,omitempty"`
+}
+
+// NewFailureRecord creates the FailureRecord for a batch that the Function was invoked with attempts times, where
+// output is from the last invocation & nil if the Function couldn't be called.
+func NewFailureRecord(functionArn string, condition string, attempts int, output *lambda.InvokeOutput,
+	now time.Time) FailureRecord {
+
+	record := FailureRecord{
+		RequestContext: FailureRequestContext{
+			RequestId:              uuid.NewString(),
+			FunctionArn:            functionArn,
+			Condition:              condition,
+			ApproximateInvokeCount: attempts,
+		},
+		Version:   "1.0",
+		Timestamp: Timestamp(now),
+	}
+
+	if output == nil {
+		return record
+	}
+
+	if requestId, ok := awsmiddleware.GetRequestIDMetadata(output.ResultMetadata); ok {
+		record.RequestContext.RequestId = requestId
+	}
+
+	record.ResponseContext = &FailureResponseContext{
+		StatusCode:      int(output.StatusCode),
+		ExecutedVersion: aws.ToString(output.ExecutedVersion),
+		FunctionError:   aws.ToString(output.FunctionError),
+	}
+
+	return record
+}
+
+// Timestamp formats the time in UTC with millisecond precision, the same way as the records that Lambda sends.
+func Timestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
@@ -0,0 +1,118 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"strconv"
+)
+
+// Credentials for the local stand-ins of AWS services, which don't check them
+var Credentials aws.CredentialsProviderFunc = func(ctx context.Context) (aws.Credentials, error) {
+	return aws.Credentials{AccessKeyID: "ABC", SecretAccessKey: "EFG", CanExpire: false}, nil
+}
+
+// EndpointResolver sends all requests to the URL, regardless of service or region.
+func EndpointResolver(url string) aws.EndpointResolverWithOptionsFunc {
+	return func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+		return aws.Endpoint{
+			URL:               url,
+			HostnameImmutable: true,
+		}, nil
+	}
+}
+
+// InvokeError is returned by Invoke when the Function couldn't be called.
+type InvokeError struct {
+	Function string
+	Base     error
+}
+
+func (e InvokeError) Error() string {
+	return "Unable to invoke Function " + e.Function + ": " + e.Base.Error()
+}
+
+func (e InvokeError) Unwrap() error {
+	return e.Base
+}
+
+// FunctionError is returned by Invoke when the Function was called but failed, with the error it responded with.
+type FunctionError struct {
+	Function string
+	Type     string
+	Payload  []byte
+}
+
+func (e FunctionError) Error() string {
+	return fmt.Sprintf("Function %s failed with %s error: %s", e.Function, e.Type, e.Payload)
+}
+
+// Lambda invokes Functions through the API, the same way that clients do.
+type Lambda struct {
+	client *lambda.Client
+}
+
+func NewLambda(cfg *settings.Config) *Lambda {
+	lambdaCfg := aws.Config{
+		Region:                      cfg.Region,
+		Credentials:                 Credentials,
+		EndpointResolverWithOptions: EndpointResolver("http://localhost:" + strconv.Itoa(cfg.BasePort)),
+		ClientLogMode:               0,
+		DefaultsMode:                "",
+		RuntimeEnvironment:          aws.RuntimeEnvironment{},
+	}
+
+	return &Lambda{client: lambda.NewFromConfig(lambdaCfg)}
+}
+
+// Invoke calls the Function synchronously & returns its response, or an error if either the call or the Function
+// failed.
+func (l *Lambda) Invoke(function *string, payload []byte) ([]byte, error) {
+	output, err := l.InvokeOutput(function, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Payload, nil
+}
+
+// InvokeOutput is like Invoke, but returns the whole output of the call. The output is also returned along with a
+// FunctionError, since it includes the status & executed version.
+func (l *Lambda) InvokeOutput(function *string, payload []byte) (*lambda.InvokeOutput, error) {
+	input := lambda.InvokeInput{
+		FunctionName:   function,
+		ClientContext:  nil,
+		InvocationType: types.InvocationTypeRequestResponse,
+		Payload:        payload,
+		Qualifier:      nil,
+	}
+
+	// let in-flight invocations finish, even if the Event Source is being stopped
+	output, err := l.client.Invoke(context.Background(), &input)
+	if err != nil {
+		e := InvokeError{Function: *function, Base: err}
+		logger.Error(e)
+		return nil, e
+	}
+
+	if output.FunctionError != nil {
+		e := FunctionError{Function: *function, Type: *output.FunctionError, Payload: output.Payload}
+		logger.Error(e)
+		return output, e
+	}
+
+	return output, nil
+}
+
+// ReservedConcurrency returns the concurrency reserved for the Function, or nil if it is unreserved.
+func (l *Lambda) ReservedConcurrency(ctx context.Context, function *string) (*int32, error) {
+	output, err := l.client.GetFunctionConcurrency(ctx, &lambda.GetFunctionConcurrencyInput{FunctionName: function})
+	if err != nil {
+		return nil, err
+	}
+
+	return output.ReservedConcurrentExecutions, nil
+}
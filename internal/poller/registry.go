@@ -0,0 +1,148 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+// how long to wait for a stopped poller to finish its in-flight batch, before the Event Source is deleted or restarted
+const stopTimeout = 30 * time.Second
+
+// runningPoller can be cancelled, and closes done once it has exited
+type runningPoller struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Registry tracks the pollers of running Event Sources & their status, so that they can be stopped & described.
+type Registry struct {
+	// the poller of each running Event Source, guarded by lock since handlers start & stop them
+	pollers map[uuid.UUID]runningPoller
+
+	// status of each Event Source that has been started, also guarded by lock
+	statuses map[uuid.UUID]*Status
+	lock     sync.Mutex
+
+	// pollers that haven't finished yet, including ones that have been cancelled
+	running sync.WaitGroup
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		pollers:  make(map[uuid.UUID]runningPoller),
+		statuses: make(map[uuid.UUID]*Status),
+	}
+}
+
+// NewStatus registers & returns the status for a poller that is about to start, replacing any previous one.
+func (r *Registry) NewStatus(id uuid.UUID, state string) *Status {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	result := &Status{
+		state:                 state,
+		stateTransitionReason: ReasonUserInitiated,
+		lastProcessingResult:  ResultNoRecords,
+	}
+	r.statuses[id] = result
+
+	return result
+}
+
+// Run starts poll in the background for the Event Source with the status, until it is stopped or the context is
+// cancelled, replacing any poller that is already running for it once that has exited. The Event Source is marked as
+// enabled once the poller has started.
+func (r *Registry) Run(ctx context.Context, id uuid.UUID, s *Status, poll func(ctx context.Context)) {
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	r.lock.Lock()
+	previous, ok := r.pollers[id]
+	r.pollers[id] = runningPoller{cancel, done}
+	r.lock.Unlock()
+
+	if ok {
+		logger.Infof("Stopping previous poller for Event Source %s", id)
+		previous.cancel()
+		r.wait(id, previous)
+	}
+
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		defer close(done)
+		defer r.stopped(id, s)
+		r.started(id, s)
+		poll(runCtx)
+	}()
+}
+
+// Stop cancels the poller of the Event Source, if it is running, which is either disabling or deleting it. It waits
+// for the poller to exit, so that it doesn't save anything for the Event Source after it has been deleted or changed.
+func (r *Registry) Stop(id uuid.UUID, state string) {
+	r.lock.Lock()
+
+	p, ok := r.pollers[id]
+	if !ok {
+		// nothing is polling, so the transition is already complete
+		if state == StateDeleting {
+			delete(r.statuses, id)
+		} else if s, ok := r.statuses[id]; ok {
+			s.state = StateDisabled
+			s.stateTransitionReason = ReasonUserInitiated
+		}
+		r.lock.Unlock()
+		return
+	}
+
+	logger.Infof("Stopping Event Source %s", id)
+	p.cancel()
+	delete(r.pollers, id)
+
+	if s, ok := r.statuses[id]; ok {
+		s.state = state
+		s.stateTransitionReason = ReasonUserInitiated
+	}
+	r.lock.Unlock()
+
+	r.wait(id, p)
+}
+
+// wait blocks until the cancelled poller has exited, or stopTimeout has passed.
+func (r *Registry) wait(id uuid.UUID, p runningPoller) {
+	timer := time.NewTimer(stopTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-p.done:
+	case <-timer.C:
+		logger.Warnf("Poller for Event Source %s did not stop within %v", id, stopTimeout)
+	}
+}
+
+// ShutdownAll stops all pollers, and waits for in-flight batches to finish until the context is done.
+func (r *Registry) ShutdownAll(ctx context.Context) error {
+	r.lock.Lock()
+	for id, p := range r.pollers {
+		logger.Infof("Stopping Event Source %s", id)
+		p.cancel()
+		delete(r.pollers, id)
+	}
+	r.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("pollers did not finish before shutdown: %v", ctx.Err())
+	}
+}
@@ -0,0 +1,221 @@
+package poller_test
+
+import (
+	"context"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func describe(r *poller.Registry, id uuid.UUID) *domain.EventSource {
+	eventSource := &domain.EventSource{UUID: id}
+	r.Describe(eventSource)
+	return eventSource
+}
+
+// eventually waits for the state of the Event Source to become expected, since pollers start & stop in the background
+func eventually(t *testing.T, r *poller.Registry, id uuid.UUID, expected string) {
+	assert.Eventually(t, func() bool {
+		return describe(r, id).State == expected
+	}, time.Second, time.Millisecond)
+}
+
+// blockingPoll returns a poll function that signals when it starts & runs until it's cancelled
+func blockingPoll(started chan<- struct{}, exited chan<- struct{}) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		close(exited)
+	}
+}
+
+func TestRegistryDescribeBeforeRun(t *testing.T) {
+	r := poller.NewRegistry()
+	id := uuid.New()
+
+	r.NewStatus(id, poller.StateCreating)
+
+	result := describe(r, id)
+	assert.Equal(t, poller.StateCreating, result.State)
+	assert.Equal(t, poller.ReasonUserInitiated, result.StateTransitionReason)
+	assert.Equal(t, poller.ResultNoRecords, result.LastProcessingResult)
+}
+
+func TestRegistryDescribeWithoutStatus(t *testing.T) {
+	r := poller.NewRegistry()
+
+	enabled := &domain.EventSource{UUID: uuid.New(), Enabled: true}
+	r.Describe(enabled)
+	assert.Equal(t, poller.StateEnabled, enabled.State)
+
+	disabled := &domain.EventSource{UUID: uuid.New(), Enabled: false}
+	r.Describe(disabled)
+	assert.Equal(t, poller.StateDisabled, disabled.State)
+}
+
+func TestRegistryRunAndStop(t *testing.T) {
+	r := poller.NewRegistry()
+	id := uuid.New()
+	started, exited := make(chan struct{}), make(chan struct{})
+
+	st := r.NewStatus(id, poller.StateEnabling)
+	r.Run(context.Background(), id, st, blockingPoll(started, exited))
+	<-started
+
+	eventually(t, r, id, poller.StateEnabled)
+
+	r.Stop(id, poller.StateDisabling)
+	<-exited
+
+	eventually(t, r, id, poller.StateDisabled)
+}
+
+func TestRegistryStopDeleting(t *testing.T) {
+	r := poller.NewRegistry()
+	id := uuid.New()
+	started, exited := make(chan struct{}), make(chan struct{})
+
+	st := r.NewStatus(id, poller.StateCreating)
+	r.Run(context.Background(), id, st, blockingPoll(started, exited))
+	<-started
+
+	r.Stop(id, poller.StateDeleting)
+	<-exited
+
+	// the status is removed, so the Event Source is described from what is persisted
+	assert.Eventually(t, func() bool {
+		eventSource := &domain.EventSource{UUID: id, Enabled: true}
+		r.Describe(eventSource)
+		return eventSource.State == poller.StateEnabled
+	}, time.Second, time.Millisecond)
+}
+
+func TestRegistryStopWithoutPoller(t *testing.T) {
+	r := poller.NewRegistry()
+	id := uuid.New()
+
+	r.NewStatus(id, poller.StateCreating)
+	r.Stop(id, poller.StateDisabling)
+
+	assert.Equal(t, poller.StateDisabled, describe(r, id).State)
+}
+
+func TestRegistryPollerExits(t *testing.T) {
+	r := poller.NewRegistry()
+	id := uuid.New()
+
+	st := r.NewStatus(id, poller.StateCreating)
+	r.Run(context.Background(), id, st, func(ctx context.Context) {})
+
+	eventually(t, r, id, poller.StateDisabled)
+
+	// nothing is left to cancel, so stopping only completes the transition
+	r.Stop(id, poller.StateDisabling)
+	assert.Equal(t, poller.StateDisabled, describe(r, id).State)
+}
+
+func TestRegistryRunReplacesPoller(t *testing.T) {
+	r := poller.NewRegistry()
+	id := uuid.New()
+	firstStarted, firstExited := make(chan struct{}), make(chan struct{})
+	secondStarted, secondExited := make(chan struct{}), make(chan struct{})
+
+	first := r.NewStatus(id, poller.StateCreating)
+	r.Run(context.Background(), id, first, blockingPoll(firstStarted, firstExited))
+	<-firstStarted
+
+	second := r.NewStatus(id, poller.StateEnabling)
+	r.Run(context.Background(), id, second, blockingPoll(secondStarted, secondExited))
+	<-secondStarted
+
+	select {
+	case <-firstExited:
+	case <-time.After(time.Second):
+		assert.Fail(t, "previous poller was not cancelled")
+	}
+
+	// the previous poller exiting doesn't change the status of the new one
+	eventually(t, r, id, poller.StateEnabled)
+
+	err := r.ShutdownAll(context.Background())
+	assert.NoError(t, err)
+	<-secondExited
+}
+
+// slowPoll returns a poll function that keeps going for a while after it's cancelled, like one finishing its batch
+func slowPoll(started chan<- struct{}, exited *bool) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		*exited = true
+	}
+}
+
+func TestRegistryStopWaitsForPoller(t *testing.T) {
+	r := poller.NewRegistry()
+	id := uuid.New()
+	started, exited := make(chan struct{}), false
+
+	s := r.NewStatus(id, poller.StateCreating)
+	r.Run(context.Background(), id, s, slowPoll(started, &exited))
+	<-started
+
+	r.Stop(id, poller.StateDeleting)
+	assert.True(t, exited)
+}
+
+func TestRegistryRunWaitsForPreviousPoller(t *testing.T) {
+	r := poller.NewRegistry()
+	id := uuid.New()
+	firstStarted, firstExited := make(chan struct{}), false
+	secondStarted, secondExited := make(chan struct{}), make(chan struct{})
+
+	first := r.NewStatus(id, poller.StateCreating)
+	r.Run(context.Background(), id, first, slowPoll(firstStarted, &firstExited))
+	<-firstStarted
+
+	second := r.NewStatus(id, poller.StateEnabling)
+	r.Run(context.Background(), id, second, blockingPoll(secondStarted, secondExited))
+	assert.True(t, firstExited)
+	<-secondStarted
+
+	eventually(t, r, id, poller.StateEnabled)
+
+	err := r.ShutdownAll(context.Background())
+	assert.NoError(t, err)
+	<-secondExited
+}
+
+func TestRegistryShutdownAll(t *testing.T) {
+	r := poller.NewRegistry()
+	id := uuid.New()
+	started, exited := make(chan struct{}), make(chan struct{})
+
+	st := r.NewStatus(id, poller.StateCreating)
+	r.Run(context.Background(), id, st, blockingPoll(started, exited))
+	<-started
+
+	err := r.ShutdownAll(context.Background())
+	assert.NoError(t, err)
+
+	<-exited
+	assert.Equal(t, poller.StateDisabled, describe(r, id).State)
+}
+
+func TestRegistryProblem(t *testing.T) {
+	r := poller.NewRegistry()
+	id := uuid.New()
+
+	st := r.NewStatus(id, poller.StateEnabled)
+	r.SetResult(st, poller.ResultOk)
+	r.SetProblem(st, "PROBLEM: Unable to poll")
+
+	assert.Equal(t, "PROBLEM: Unable to poll", describe(r, id).LastProcessingResult)
+
+	r.SetProblem(st, "")
+	assert.Equal(t, poller.ResultOk, describe(r, id).LastProcessingResult)
+}
@@ -0,0 +1,44 @@
+package poller
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// BatchResponse is returned by Functions that report which records in a batch failed
+type BatchResponse struct {
+	BatchItemFailures []BatchItemFailure `json:"batchItemFailures"`
+}
+
+type BatchItemFailure struct {
+	ItemIdentifier *string `json:"itemIdentifier"`
+}
+
+// FailedItems returns the identifiers of the records that the Function reported as failures in its response. An
+// empty response or list of failures means that all succeeded, while an error is returned if the response is invalid,
+// in which case the whole batch is considered to have failed.
+func FailedItems(payload []byte) (map[string]bool, error) {
+	failed := make(map[string]bool)
+	if len(payload) == 0 {
+		return failed, nil
+	}
+
+	var response *BatchResponse
+	err := json.Unmarshal(payload, &response)
+	if err != nil {
+		return nil, fmt.Errorf("invalid batch response %s: %v", payload, err)
+	}
+
+	if response == nil {
+		return failed, nil
+	}
+
+	for _, failure := range response.BatchItemFailures {
+		if failure.ItemIdentifier == nil || *failure.ItemIdentifier == "" {
+			return nil, fmt.Errorf("missing itemIdentifier in batch response %s", payload)
+		}
+		failed[*failure.ItemIdentifier] = true
+	}
+
+	return failed, nil
+}
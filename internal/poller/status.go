@@ -0,0 +1,115 @@
+package poller
+
+import (
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/google/uuid"
+)
+
+const (
+	StateCreating  = "Creating"
+	StateEnabling  = "Enabling"
+	StateEnabled   = "Enabled"
+	StateDisabling = "Disabling"
+	StateDisabled  = "Disabled"
+	StateDeleting  = "Deleting"
+
+	ReasonUserInitiated = "USER_INITIATED"
+
+	ResultNoRecords      = "No records processed"
+	ResultOk             = "OK"
+	ResultFunctionFailed = "PROBLEM: Function call failed"
+)
+
+// Status of an Event Source as reported through the API, which is tracked while polling rather than persisted
+type Status struct {
+	state                 string
+	stateTransitionReason string
+	lastProcessingResult  string
+
+	// reported instead of lastProcessingResult while the pollers are unable to poll
+	problem string
+}
+
+func (r *Registry) SetState(s *Status, state string, reason string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s.state = state
+	s.stateTransitionReason = reason
+}
+
+func (r *Registry) SetResult(s *Status, result string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s.lastProcessingResult = result
+}
+
+// SetProblem reports that polling is failing, or that it has recovered when the problem is empty.
+func (r *Registry) SetProblem(s *Status, problem string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s.problem = problem
+}
+
+// started is called when a poller starts, and finishes creating or enabling its Event Source unless it has since
+// been stopped or a newer poller has been started.
+func (r *Registry) started(id uuid.UUID, s *Status) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.statuses[id] != s {
+		return
+	}
+
+	if s.state == StateCreating || s.state == StateEnabling {
+		s.state = StateEnabled
+	}
+}
+
+// stopped is called when a poller exits, and finishes disabling or deleting its Event Source unless a newer
+// poller has since been started.
+func (r *Registry) stopped(id uuid.UUID, s *Status) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.statuses[id] != s {
+		return
+	}
+
+	// the poller may have exited without being stopped, so there's nothing left to cancel
+	delete(r.pollers, id)
+
+	if s.state == StateDeleting {
+		delete(r.statuses, id)
+		return
+	}
+
+	s.state = StateDisabled
+}
+
+// Describe sets the current state of the Event Source, as well as the reason for it & the result of the last poll.
+func (r *Registry) Describe(eventSource *domain.EventSource) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s, ok := r.statuses[eventSource.UUID]
+	if !ok {
+		// no poller has been started, which is only expected for disabled Event Sources
+		eventSource.State = StateDisabled
+		if eventSource.Enabled {
+			eventSource.State = StateEnabled
+		}
+		eventSource.StateTransitionReason = ReasonUserInitiated
+		eventSource.LastProcessingResult = ResultNoRecords
+		return
+	}
+
+	eventSource.State = s.state
+	eventSource.StateTransitionReason = s.stateTransitionReason
+	eventSource.LastProcessingResult = s.lastProcessingResult
+	if s.problem != "" {
+		eventSource.LastProcessingResult = s.problem
+	}
+}
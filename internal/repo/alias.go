@@ -0,0 +1,310 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/pkg/database"
+)
+
+type AliasRepository struct {
+	db database.Database
+}
+
+func NewAliasRepository(db database.Database) *AliasRepository {
+	return &AliasRepository{db}
+}
+
+func (a AliasRepository) InsertAlias(ctx context.Context, alias *domain.Alias) error {
+	logger.Infof("Inserting Alias %s for Function %s", alias.Name, alias.FunctionName)
+
+	tx, err := a.db.BeginTx(ctx)
+	if err != nil {
+		e := Error{"unable to create transaction to insert Alias " + alias.Name, err}
+		logger.Error(e)
+		return e
+	}
+
+	id, err := tx.InsertOne(
+		ctx,
+		`INSERT INTO lambda_function_alias (function_name, name, function_version, description, revision_id)
+					VALUES (?, ?, ?, ?, ?)
+		`,
+		alias.FunctionName,
+		alias.Name,
+		alias.FunctionVersion,
+		alias.Description,
+		alias.RevisionId,
+	)
+	if err != nil {
+		msg := tx.Rollback("unable to insert Alias %s for Function %s", alias.Name, alias.FunctionName)
+		e := Error{msg, err}
+		logger.Error(e)
+		return e
+	}
+
+	alias.ID = id
+
+	err = insertAliasWeights(ctx, tx, alias)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		e := Error{"unable to commit when inserting Alias " + alias.Name, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
+func insertAliasWeights(ctx context.Context, tx database.Transaction, alias *domain.Alias) error {
+	for version, weight := range alias.AdditionalVersionWeights {
+		_, err := tx.InsertOne(
+			ctx,
+			`INSERT INTO lambda_function_alias_weight (alias_id, function_version, weight) VALUES (?, ?, ?)`,
+			alias.ID,
+			version,
+			weight,
+		)
+		if err != nil {
+			msg := tx.Rollback("unable to insert weight for version %s of Alias %s", version, alias.Name)
+			e := Error{msg, err}
+			logger.Error(e)
+			return e
+		}
+	}
+
+	return nil
+}
+
+// GetAlias returns the named Alias of the Function, or sql.ErrNoRows if it doesn't exist.
+func (a AliasRepository) GetAlias(ctx context.Context, functionName string, name string) (*domain.Alias, error) {
+	logger.Infof("Querying for Alias %s of Function %s", name, functionName)
+
+	row := a.db.QueryRowContext(
+		ctx,
+		`SELECT id, function_version, description, revision_id FROM lambda_function_alias
+					WHERE function_name = ? AND name = ?
+		`,
+		functionName,
+		name,
+	)
+
+	alias := domain.Alias{
+		FunctionName: functionName,
+		Name:         name,
+	}
+
+	var description sql.NullString
+	err := row.Scan(
+		&alias.ID,
+		&alias.FunctionVersion,
+		&description,
+		&alias.RevisionId,
+	)
+
+	switch {
+	case err == sql.ErrNoRows:
+		logger.Infof("Alias %s of Function %s not found", name, functionName)
+		return nil, err
+	case err != nil:
+		e := Error{"unable to query for Alias " + name + " of Function " + functionName, err}
+		logger.Error(e)
+		return nil, e
+	}
+
+	alias.Description = description.String
+
+	alias.AdditionalVersionWeights, err = a.getWeights(ctx, alias.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &alias, nil
+}
+
+func (a AliasRepository) GetAliasesForFunction(ctx context.Context, functionName string) ([]domain.Alias, error) {
+	logger.Infof("Querying for Aliases of Function %s", functionName)
+
+	rows, err := a.db.QueryContext(
+		ctx,
+		`SELECT id, name, function_version, description, revision_id FROM lambda_function_alias
+					WHERE function_name = ? ORDER BY name
+		`,
+		functionName,
+	)
+	if err != nil {
+		e := Error{"unable to query for Aliases of Function " + functionName, err}
+		logger.Error(e)
+		return nil, e
+	}
+	defer rows.Close()
+
+	var results []domain.Alias
+	for rows.Next() {
+		alias := domain.Alias{FunctionName: functionName}
+		var description sql.NullString
+		err = rows.Scan(
+			&alias.ID,
+			&alias.Name,
+			&alias.FunctionVersion,
+			&description,
+			&alias.RevisionId,
+		)
+
+		if err != nil {
+			e := RowError{
+				Op:   "GetAliasesForFunction",
+				Row:  len(results),
+				Base: err,
+			}
+			logger.Error(e)
+			return nil, e
+		}
+
+		alias.Description = description.String
+		results = append(results, alias)
+	}
+
+	for i := range results {
+		results[i].AdditionalVersionWeights, err = a.getWeights(ctx, results[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+func (a AliasRepository) getWeights(ctx context.Context, aliasId int64) (map[string]float64, error) {
+	rows, err := a.db.QueryContext(
+		ctx,
+		`SELECT function_version, weight FROM lambda_function_alias_weight WHERE alias_id = ?`,
+		aliasId,
+	)
+	if err != nil {
+		e := Error{"unable to query for weights of Alias", err}
+		logger.Error(e)
+		return nil, e
+	}
+	defer rows.Close()
+
+	results := make(map[string]float64)
+	for rows.Next() {
+		var version string
+		var weight float64
+		err = rows.Scan(&version, &weight)
+		if err != nil {
+			e := RowError{
+				Op:   "getWeights",
+				Row:  len(results),
+				Base: err,
+			}
+			logger.Error(e)
+			return nil, e
+		}
+
+		results[version] = weight
+	}
+
+	return results, nil
+}
+
+func (a AliasRepository) UpdateAlias(ctx context.Context, alias *domain.Alias) error {
+	logger.Infof("Updating Alias %s of Function %s", alias.Name, alias.FunctionName)
+
+	tx, err := a.db.BeginTx(ctx)
+	if err != nil {
+		e := Error{"unable to create transaction to update Alias " + alias.Name, err}
+		logger.Error(e)
+		return e
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE lambda_function_alias SET function_version = ?, description = ?, revision_id = ? WHERE id = ?`,
+		alias.FunctionVersion,
+		alias.Description,
+		alias.RevisionId,
+		alias.ID,
+	)
+	if err != nil {
+		msg := tx.Rollback("unable to update Alias %s of Function %s", alias.Name, alias.FunctionName)
+		e := Error{msg, err}
+		logger.Error(e)
+		return e
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM lambda_function_alias_weight WHERE alias_id = ?`, alias.ID)
+	if err != nil {
+		msg := tx.Rollback("unable to delete weights of Alias %s", alias.Name)
+		e := Error{msg, err}
+		logger.Error(e)
+		return e
+	}
+
+	err = insertAliasWeights(ctx, tx, alias)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		e := Error{"unable to commit when updating Alias " + alias.Name, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
+func (a AliasRepository) DeleteAlias(ctx context.Context, functionName string, name string) error {
+	logger.Infof("Deleting Alias %s of Function %s", name, functionName)
+
+	tx, err := a.db.BeginTx(ctx)
+	if err != nil {
+		e := Error{"unable to create transaction to delete Alias " + name, err}
+		logger.Error(e)
+		return e
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`DELETE FROM lambda_function_alias_weight WHERE alias_id IN
+					(SELECT id FROM lambda_function_alias WHERE function_name = ? AND name = ?)
+		`,
+		functionName,
+		name,
+	)
+	if err != nil {
+		msg := tx.Rollback("unable to delete weights of Alias %s", name)
+		e := Error{msg, err}
+		logger.Error(e)
+		return e
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`DELETE FROM lambda_function_alias WHERE function_name = ? AND name = ?`,
+		functionName,
+		name,
+	)
+	if err != nil {
+		msg := tx.Rollback("unable to delete Alias %s of Function %s", name, functionName)
+		e := Error{msg, err}
+		logger.Error(e)
+		return e
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		e := Error{"unable to commit when deleting Alias " + name, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
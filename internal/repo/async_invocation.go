@@ -0,0 +1,134 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/pkg/database"
+	"strconv"
+)
+
+type AsyncInvocationRepository struct {
+	db database.Database
+}
+
+func NewAsyncInvocationRepository(db database.Database) *AsyncInvocationRepository {
+	return &AsyncInvocationRepository{db}
+}
+
+func (a *AsyncInvocationRepository) InsertAsyncInvocation(ctx context.Context, invocation *domain.AsyncInvocation) error {
+	logger.Infof("Queueing request %s for Function %s", invocation.RequestId, invocation.Target())
+
+	id, err := a.db.InsertOne(
+		ctx,
+		`INSERT INTO lambda_async_invocation (request_id, function_name, qualifier, payload, attempts, created,
+					next_attempt, error_code, error_message)
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`,
+		invocation.RequestId,
+		invocation.FunctionName,
+		invocation.Qualifier,
+		invocation.Payload,
+		invocation.Attempts,
+		invocation.Created,
+		invocation.NextAttempt,
+		invocation.ErrorCode,
+		invocation.ErrorMessage,
+	)
+	if err != nil {
+		e := Error{"unable to queue request " + invocation.RequestId + " for Function " + invocation.Target(), err}
+		logger.Error(e)
+		return e
+	}
+
+	invocation.ID = id
+
+	return nil
+}
+
+// GetDueAsyncInvocations returns up to limit queued invocations that should be attempted at or before now, oldest
+// first.
+func (a *AsyncInvocationRepository) GetDueAsyncInvocations(ctx context.Context, now int64,
+	limit int) ([]domain.AsyncInvocation, error) {
+
+	var results []domain.AsyncInvocation
+	rows, err := a.db.QueryContext(
+		ctx,
+		`SELECT id, request_id, function_name, qualifier, payload, attempts, created, next_attempt, error_code,
+					error_message
+					FROM lambda_async_invocation WHERE next_attempt <= ? ORDER BY next_attempt, id LIMIT ?
+		`,
+		now,
+		limit,
+	)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return results, nil
+	case err != nil:
+		e := Error{"unable to query for queued invocations", err}
+		logger.Error(e)
+		return nil, e
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var invocation domain.AsyncInvocation
+		err = rows.Scan(
+			&invocation.ID,
+			&invocation.RequestId,
+			&invocation.FunctionName,
+			&invocation.Qualifier,
+			&invocation.Payload,
+			&invocation.Attempts,
+			&invocation.Created,
+			&invocation.NextAttempt,
+			&invocation.ErrorCode,
+			&invocation.ErrorMessage,
+		)
+		if err != nil {
+			e := RowError{
+				Op:   "GetDueAsyncInvocations",
+				Row:  len(results),
+				Base: err,
+			}
+			logger.Error(e)
+			return nil, e
+		}
+
+		results = append(results, invocation)
+	}
+
+	return results, nil
+}
+
+// UpdateAsyncInvocation saves the attempts, next attempt & last error of a queued invocation.
+func (a *AsyncInvocationRepository) UpdateAsyncInvocation(ctx context.Context, invocation *domain.AsyncInvocation) error {
+	_, err := a.db.ExecContext(
+		ctx,
+		`UPDATE lambda_async_invocation SET attempts=?, next_attempt=?, error_code=?, error_message=? WHERE id=?`,
+		invocation.Attempts,
+		invocation.NextAttempt,
+		invocation.ErrorCode,
+		invocation.ErrorMessage,
+		invocation.ID,
+	)
+	if err != nil {
+		e := Error{"unable to update queued request " + invocation.RequestId, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
+func (a *AsyncInvocationRepository) DeleteAsyncInvocation(ctx context.Context, id int64) error {
+	_, err := a.db.ExecContext(ctx, `DELETE FROM lambda_async_invocation WHERE id=?`, id)
+	if err != nil {
+		e := Error{"unable to delete queued invocation " + strconv.FormatInt(id, 10), err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
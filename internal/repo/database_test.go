@@ -0,0 +1,31 @@
+package repo_test
+
+import (
+	"database/sql"
+	"github.com/ATenderholt/rainbow-functions/pkg/database"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pressly/goose/v3"
+	"path/filepath"
+	"testing"
+)
+
+// newDatabase creates a database for the test with all migrations applied.
+func newDatabase(t *testing.T) database.Database {
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "db.sqlite3"))
+	if err != nil {
+		t.Fatalf("unable to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = goose.SetDialect("sqlite3")
+	if err != nil {
+		t.Fatalf("unable to set dialect: %v", err)
+	}
+
+	err = goose.Up(db, filepath.Join("..", "..", "cmd", "functions", "migrations"))
+	if err != nil {
+		t.Fatalf("unable to migrate database: %v", err)
+	}
+
+	return database.RealDatabase{Wrapped: db}
+}
@@ -0,0 +1,159 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/pkg/database"
+)
+
+type EventInvokeConfigRepository struct {
+	db database.Database
+}
+
+func NewEventInvokeConfigRepository(db database.Database) *EventInvokeConfigRepository {
+	return &EventInvokeConfigRepository{db}
+}
+
+// PutEventInvokeConfig saves the config, replacing any existing one for the Function & qualifier.
+func (e *EventInvokeConfigRepository) PutEventInvokeConfig(ctx context.Context, config *domain.EventInvokeConfig) error {
+	logger.Infof("Saving invoke config for %s of Function %s", config.Qualifier, config.FunctionName)
+
+	_, err := e.db.ExecContext(
+		ctx,
+		`INSERT INTO lambda_function_event_invoke_config (function_name, qualifier, maximum_retry_attempts,
+					maximum_event_age, on_success, on_failure, last_modified_on)
+					VALUES (?, ?, ?, ?, ?, ?, ?)
+					ON CONFLICT(function_name, qualifier) DO UPDATE SET
+						maximum_retry_attempts = excluded.maximum_retry_attempts,
+						maximum_event_age = excluded.maximum_event_age,
+						on_success = excluded.on_success,
+						on_failure = excluded.on_failure,
+						last_modified_on = excluded.last_modified_on
+		`,
+		config.FunctionName,
+		config.Qualifier,
+		config.MaximumRetryAttempts,
+		config.MaximumEventAgeInSeconds,
+		config.OnSuccess,
+		config.OnFailure,
+		config.LastModified,
+	)
+	if err != nil {
+		e := Error{"unable to save invoke config for " + config.Qualifier + " of Function " + config.FunctionName, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
+// GetEventInvokeConfig returns the config for the Function & qualifier, or sql.ErrNoRows if there isn't one.
+func (e *EventInvokeConfigRepository) GetEventInvokeConfig(ctx context.Context, name string,
+	qualifier string) (*domain.EventInvokeConfig, error) {
+
+	row := e.db.QueryRowContext(
+		ctx,
+		`SELECT maximum_retry_attempts, maximum_event_age, on_success, on_failure, last_modified_on
+					FROM lambda_function_event_invoke_config WHERE function_name = ? AND qualifier = ?
+		`,
+		name,
+		qualifier,
+	)
+
+	config := domain.EventInvokeConfig{
+		FunctionName: name,
+		Qualifier:    qualifier,
+	}
+
+	var retryAttempts, eventAge sql.NullInt32
+	err := row.Scan(&retryAttempts, &eventAge, &config.OnSuccess, &config.OnFailure, &config.LastModified)
+	switch {
+	case err == sql.ErrNoRows:
+		logger.Debugf("No invoke config for %s of Function %s", qualifier, name)
+		return nil, err
+	case err != nil:
+		e := Error{"unable to query for invoke config for " + qualifier + " of Function " + name, err}
+		logger.Error(e)
+		return nil, e
+	}
+
+	config.MaximumRetryAttempts = nullInt32(retryAttempts)
+	config.MaximumEventAgeInSeconds = nullInt32(eventAge)
+
+	return &config, nil
+}
+
+// GetEventInvokeConfigs returns the configs for all qualifiers of the Function, ordered by qualifier.
+func (e *EventInvokeConfigRepository) GetEventInvokeConfigs(ctx context.Context,
+	name string) ([]domain.EventInvokeConfig, error) {
+
+	var results []domain.EventInvokeConfig
+	rows, err := e.db.QueryContext(
+		ctx,
+		`SELECT qualifier, maximum_retry_attempts, maximum_event_age, on_success, on_failure, last_modified_on
+					FROM lambda_function_event_invoke_config WHERE function_name = ? ORDER BY qualifier
+		`,
+		name,
+	)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return results, nil
+	case err != nil:
+		e := Error{"unable to query for invoke configs of Function " + name, err}
+		logger.Error(e)
+		return nil, e
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		config := domain.EventInvokeConfig{FunctionName: name}
+
+		var retryAttempts, eventAge sql.NullInt32
+		err = rows.Scan(&config.Qualifier, &retryAttempts, &eventAge, &config.OnSuccess, &config.OnFailure,
+			&config.LastModified)
+		if err != nil {
+			e := RowError{
+				Op:   "GetEventInvokeConfigs",
+				Row:  len(results),
+				Base: err,
+			}
+			logger.Error(e)
+			return nil, e
+		}
+
+		config.MaximumRetryAttempts = nullInt32(retryAttempts)
+		config.MaximumEventAgeInSeconds = nullInt32(eventAge)
+
+		results = append(results, config)
+	}
+
+	return results, nil
+}
+
+func (e *EventInvokeConfigRepository) DeleteEventInvokeConfig(ctx context.Context, name string, qualifier string) error {
+	logger.Infof("Deleting invoke config for %s of Function %s", qualifier, name)
+
+	_, err := e.db.ExecContext(
+		ctx,
+		`DELETE FROM lambda_function_event_invoke_config WHERE function_name = ? AND qualifier = ?`,
+		name,
+		qualifier,
+	)
+	if err != nil {
+		e := Error{"unable to delete invoke config for " + qualifier + " of Function " + name, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
+func nullInt32(value sql.NullInt32) *int32 {
+	if !value.Valid {
+		return nil
+	}
+
+	return &value.Int32
+}
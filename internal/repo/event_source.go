@@ -3,10 +3,13 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"github.com/ATenderholt/rainbow-functions/internal/domain"
 	"github.com/ATenderholt/rainbow-functions/pkg/database"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
 	"github.com/google/uuid"
+	"strings"
 )
 
 type EventSourceRepository struct {
@@ -20,8 +23,12 @@ func NewEventSourceRepository(db database.Database) *EventSourceRepository {
 func (e *EventSourceRepository) InsertEventSource(ctx context.Context, eventSource domain.EventSource) error {
 	_, err := e.db.InsertOne(
 		ctx,
-		`INSERT INTO lambda_event_source (uuid, enabled, arn, function_id, batch_size, last_modified_on)
-					VALUES (?, ?, ?, ?, ?, ?)
+		`INSERT INTO lambda_event_source (uuid, enabled, arn, function_id, batch_size, last_modified_on,
+					function_response_types, maximum_batching_window, filter_criteria,
+					maximum_concurrency, starting_position, starting_position_timestamp,
+					bisect_batch_on_function_error, bootstrap_servers, topics, maximum_retry_attempts,
+					maximum_record_age, on_failure, function_alias)
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		`,
 		eventSource.UUID.String(),
 		eventSource.Enabled,
@@ -29,6 +36,19 @@ func (e *EventSourceRepository) InsertEventSource(ctx context.Context, eventSour
 		eventSource.Function.ID,
 		eventSource.BatchSize,
 		eventSource.LastModified,
+		joinResponseTypes(eventSource.FunctionResponseTypes),
+		eventSource.MaximumBatchingWindowInSeconds,
+		joinFilterPatterns(eventSource.FilterPatterns),
+		eventSource.MaximumConcurrency,
+		eventSource.StartingPosition,
+		eventSource.StartingPositionTimestamp,
+		eventSource.BisectBatchOnFunctionError,
+		strings.Join(eventSource.BootstrapServers, ","),
+		strings.Join(eventSource.Topics, ","),
+		eventSource.MaximumRetryAttempts,
+		eventSource.MaximumRecordAgeInSeconds,
+		eventSource.OnFailure,
+		eventSource.FunctionAlias,
 	)
 
 	if err != nil {
@@ -54,17 +74,35 @@ func (e *EventSourceRepository) GetEventSource(ctx context.Context, id string) (
 
 	row := e.db.QueryRowContext(
 		ctx,
-		`SELECT enabled, arn, function_id, batch_size, last_modified_on FROM lambda_event_source WHERE uuid=?`,
+		`SELECT enabled, arn, function_id, batch_size, last_modified_on, function_response_types,
+					maximum_batching_window, filter_criteria, maximum_concurrency, starting_position,
+					starting_position_timestamp, bisect_batch_on_function_error, bootstrap_servers, topics,
+					maximum_retry_attempts, maximum_record_age, on_failure, function_alias
+				FROM lambda_event_source WHERE uuid=?`,
 		id,
 	)
 
 	var functionId int64
+	var responseTypes, filterPatterns, bootstrapServers, topics string
 	err = row.Scan(
 		&eventSource.Enabled,
 		&eventSource.Arn,
 		&functionId,
 		&eventSource.BatchSize,
 		&eventSource.LastModified,
+		&responseTypes,
+		&eventSource.MaximumBatchingWindowInSeconds,
+		&filterPatterns,
+		&eventSource.MaximumConcurrency,
+		&eventSource.StartingPosition,
+		&eventSource.StartingPositionTimestamp,
+		&eventSource.BisectBatchOnFunctionError,
+		&bootstrapServers,
+		&topics,
+		&eventSource.MaximumRetryAttempts,
+		&eventSource.MaximumRecordAgeInSeconds,
+		&eventSource.OnFailure,
+		&eventSource.FunctionAlias,
 	)
 
 	switch {
@@ -79,7 +117,9 @@ func (e *EventSourceRepository) GetEventSource(ctx context.Context, id string) (
 
 	row = e.db.QueryRowContext(
 		ctx,
-		`SELECT name, version FROM lambda_function WHERE id=? ORDER BY version DESC LIMIT 1`,
+		`SELECT name, version, timeout, role,
+					version = (SELECT max(version) FROM lambda_function WHERE name = lf.name) AS latest
+				FROM lambda_function AS lf WHERE id=?`,
 		functionId,
 	)
 
@@ -87,6 +127,9 @@ func (e *EventSourceRepository) GetEventSource(ctx context.Context, id string) (
 	err = row.Scan(
 		&function.FunctionName,
 		&function.Version,
+		&function.Timeout,
+		&function.Role,
+		&function.Latest,
 	)
 
 	if err != nil {
@@ -96,7 +139,17 @@ func (e *EventSourceRepository) GetEventSource(ctx context.Context, id string) (
 		return nil, e
 	}
 
+	function.ID = functionId
 	eventSource.Function = &function
+	eventSource.FunctionResponseTypes = splitResponseTypes(responseTypes)
+	eventSource.BootstrapServers = splitList(bootstrapServers)
+	eventSource.Topics = splitList(topics)
+	eventSource.FilterPatterns, err = splitFilterPatterns(filterPatterns)
+	if err != nil {
+		e := Error{"unable to parse filter criteria for Event Source " + id, err}
+		logger.Error(e)
+		return nil, e
+	}
 
 	return &eventSource, nil
 }
@@ -107,7 +160,11 @@ func (e *EventSourceRepository) GetAllEventSources(ctx context.Context) ([]domai
 	var results []domain.EventSource
 	rows, err := e.db.QueryContext(
 		ctx,
-		`SELECT uuid, enabled, arn, function_id, batch_size, last_modified_on FROM lambda_event_source`,
+		`SELECT uuid, enabled, arn, function_id, batch_size, last_modified_on, function_response_types,
+					maximum_batching_window, filter_criteria, maximum_concurrency, starting_position,
+					starting_position_timestamp, bisect_batch_on_function_error, bootstrap_servers, topics,
+					maximum_retry_attempts, maximum_record_age, on_failure, function_alias
+				FROM lambda_event_source ORDER BY id`,
 	)
 
 	switch {
@@ -120,7 +177,12 @@ func (e *EventSourceRepository) GetAllEventSources(ctx context.Context) ([]domai
 		return nil, e
 	}
 
-	stmt, err := e.db.PrepareContext(ctx, `SELECT name, version FROM lambda_function WHERE id=? ORDER BY version DESC LIMIT 1`)
+	stmt, err := e.db.PrepareContext(
+		ctx,
+		`SELECT name, version, timeout, role,
+					version = (SELECT max(version) FROM lambda_function WHERE name = lf.name) AS latest
+				FROM lambda_function AS lf WHERE id=?`,
+	)
 	if err != nil {
 		e := Error{"Unable to prepare statement for GetAllEventSources", err}
 		logger.Error(e)
@@ -131,6 +193,7 @@ func (e *EventSourceRepository) GetAllEventSources(ctx context.Context) ([]domai
 	for rows.Next() {
 		var eventSource domain.EventSource
 		var functionId int64
+		var responseTypes, filterPatterns, bootstrapServers, topics string
 		err = rows.Scan(
 			&eventSource.UUID,
 			&eventSource.Enabled,
@@ -138,6 +201,19 @@ func (e *EventSourceRepository) GetAllEventSources(ctx context.Context) ([]domai
 			&functionId,
 			&eventSource.BatchSize,
 			&eventSource.LastModified,
+			&responseTypes,
+			&eventSource.MaximumBatchingWindowInSeconds,
+			&filterPatterns,
+			&eventSource.MaximumConcurrency,
+			&eventSource.StartingPosition,
+			&eventSource.StartingPositionTimestamp,
+			&eventSource.BisectBatchOnFunctionError,
+			&bootstrapServers,
+			&topics,
+			&eventSource.MaximumRetryAttempts,
+			&eventSource.MaximumRecordAgeInSeconds,
+			&eventSource.OnFailure,
+			&eventSource.FunctionAlias,
 		)
 
 		if err != nil {
@@ -155,6 +231,9 @@ func (e *EventSourceRepository) GetAllEventSources(ctx context.Context) ([]domai
 		err = row.Scan(
 			&function.FunctionName,
 			&function.Version,
+			&function.Timeout,
+			&function.Role,
+			&function.Latest,
 		)
 
 		if err != nil {
@@ -167,10 +246,212 @@ func (e *EventSourceRepository) GetAllEventSources(ctx context.Context) ([]domai
 			return nil, e
 		}
 
+		function.ID = functionId
 		eventSource.Function = &function
+		eventSource.FunctionResponseTypes = splitResponseTypes(responseTypes)
+		eventSource.BootstrapServers = splitList(bootstrapServers)
+		eventSource.Topics = splitList(topics)
+		eventSource.FilterPatterns, err = splitFilterPatterns(filterPatterns)
+		if err != nil {
+			e := RowError{
+				Op:   "GetAllEventSources FilterCriteria",
+				Row:  len(results),
+				Base: err,
+			}
+			logger.Error(e)
+			return nil, e
+		}
 
 		results = append(results, eventSource)
 	}
 
 	return results, nil
 }
+
+func (e *EventSourceRepository) UpdateEventSource(ctx context.Context, eventSource domain.EventSource) error {
+	logger.Infof("Updating Event Source %s", eventSource.UUID)
+
+	_, err := e.db.ExecContext(
+		ctx,
+		`UPDATE lambda_event_source SET enabled=?, function_id=?, batch_size=?, last_modified_on=?,
+					function_response_types=?, maximum_batching_window=?, filter_criteria=?,
+					maximum_concurrency=?, starting_position=?, starting_position_timestamp=?,
+					bisect_batch_on_function_error=?, maximum_retry_attempts=?, maximum_record_age=?,
+					on_failure=?, function_alias=?
+				WHERE uuid=?`,
+		eventSource.Enabled,
+		eventSource.Function.ID,
+		eventSource.BatchSize,
+		eventSource.LastModified,
+		joinResponseTypes(eventSource.FunctionResponseTypes),
+		eventSource.MaximumBatchingWindowInSeconds,
+		joinFilterPatterns(eventSource.FilterPatterns),
+		eventSource.MaximumConcurrency,
+		eventSource.StartingPosition,
+		eventSource.StartingPositionTimestamp,
+		eventSource.BisectBatchOnFunctionError,
+		eventSource.MaximumRetryAttempts,
+		eventSource.MaximumRecordAgeInSeconds,
+		eventSource.OnFailure,
+		eventSource.FunctionAlias,
+		eventSource.UUID.String(),
+	)
+
+	if err != nil {
+		e := Error{"unable to update Event Source " + eventSource.UUID.String(), err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
+// eventSourceDeletes remove an Event Source & its checkpoints, in order, given its uuid
+var eventSourceDeletes = []string{
+	`DELETE FROM lambda_event_source_checkpoint WHERE event_source_uuid=?`,
+	`DELETE FROM lambda_event_source WHERE uuid=?`,
+}
+
+func (e *EventSourceRepository) DeleteEventSource(ctx context.Context, id string) error {
+	logger.Infof("Deleting Event Source %s", id)
+
+	tx, err := e.db.BeginTx(ctx)
+	if err != nil {
+		e := Error{"unable to create transaction to delete Event Source " + id, err}
+		logger.Error(e)
+		return e
+	}
+
+	for _, query := range eventSourceDeletes {
+		_, err = tx.ExecContext(ctx, query, id)
+		if err != nil {
+			msg := tx.Rollback("unable to delete Event Source %s", id)
+			e := Error{msg, err}
+			logger.Error(e)
+			return e
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		e := Error{"unable to commit when deleting Event Source " + id, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
+// GetCheckpoints returns the checkpoint of each shard that the Event Source has processed records from, by shard id.
+func (e *EventSourceRepository) GetCheckpoints(ctx context.Context, id string) (map[string]domain.Checkpoint, error) {
+	results := make(map[string]domain.Checkpoint)
+	rows, err := e.db.QueryContext(
+		ctx,
+		`SELECT shard_id, sequence_number, closed FROM lambda_event_source_checkpoint WHERE event_source_uuid=?`,
+		id,
+	)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return results, nil
+	case err != nil:
+		e := Error{"unable to find checkpoints for Event Source " + id, err}
+		logger.Error(e)
+		return nil, e
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var checkpoint domain.Checkpoint
+		err = rows.Scan(&checkpoint.ShardId, &checkpoint.SequenceNumber, &checkpoint.Closed)
+		if err != nil {
+			e := RowError{
+				Op:   "GetCheckpoints",
+				Row:  len(results),
+				Base: err,
+			}
+			logger.Error(e)
+			return nil, e
+		}
+
+		results[checkpoint.ShardId] = checkpoint
+	}
+
+	return results, nil
+}
+
+func (e *EventSourceRepository) PutCheckpoint(ctx context.Context, id string, checkpoint domain.Checkpoint) error {
+	logger.Debugf("Checkpointing shard %s of Event Source %s at %s", checkpoint.ShardId, id,
+		checkpoint.SequenceNumber)
+
+	_, err := e.db.ExecContext(
+		ctx,
+		`INSERT INTO lambda_event_source_checkpoint (event_source_uuid, shard_id, sequence_number, closed)
+				VALUES (?, ?, ?, ?)
+				ON CONFLICT(event_source_uuid, shard_id) DO UPDATE SET sequence_number = excluded.sequence_number,
+					closed = excluded.closed
+		`,
+		id,
+		checkpoint.ShardId,
+		checkpoint.SequenceNumber,
+		checkpoint.Closed,
+	)
+	if err != nil {
+		e := Error{"unable to checkpoint shard " + checkpoint.ShardId + " of Event Source " + id, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
+func joinResponseTypes(responseTypes []types.FunctionResponseType) string {
+	values := make([]string, len(responseTypes))
+	for i, responseType := range responseTypes {
+		values[i] = string(responseType)
+	}
+
+	return strings.Join(values, ",")
+}
+
+func splitResponseTypes(value string) []types.FunctionResponseType {
+	if value == "" {
+		return nil
+	}
+
+	values := strings.Split(value, ",")
+	results := make([]types.FunctionResponseType, len(values))
+	for i, v := range values {
+		results[i] = types.FunctionResponseType(v)
+	}
+
+	return results
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
+
+// joinFilterPatterns stores the patterns as a JSON array since they are JSON themselves.
+func joinFilterPatterns(patterns []string) string {
+	if len(patterns) == 0 {
+		return ""
+	}
+
+	value, _ := json.Marshal(patterns)
+	return string(value)
+}
+
+func splitFilterPatterns(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var results []string
+	err := json.Unmarshal([]byte(value), &results)
+	return results, err
+}
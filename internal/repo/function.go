@@ -7,6 +7,7 @@ import (
 	"github.com/ATenderholt/rainbow-functions/internal/domain"
 	"github.com/ATenderholt/rainbow-functions/pkg/database"
 	aws "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"strconv"
 )
 
 type FunctionRepository struct {
@@ -22,7 +23,7 @@ func (f FunctionRepository) GetAllLatestFunctions(ctx context.Context) ([]domain
 
 	rows, err := f.db.QueryContext(
 		ctx,
-		`SELECT id, name, max(version), runtime, handler FROM lambda_function GROUP BY name`,
+		`SELECT id, name, max(version), runtime, handler, code_sha256 FROM lambda_function GROUP BY name`,
 	)
 
 	var results []domain.Function
@@ -46,6 +47,7 @@ func (f FunctionRepository) GetAllLatestFunctions(ctx context.Context) ([]domain
 			&function.Version,
 			&function.Runtime,
 			&function.Handler,
+			&function.CodeSha256,
 		)
 
 		if err != nil {
@@ -58,6 +60,7 @@ func (f FunctionRepository) GetAllLatestFunctions(ctx context.Context) ([]domain
 			return results, e
 		}
 
+		function.Latest = true
 		results = append(results, function)
 	}
 
@@ -104,6 +107,193 @@ func (f FunctionRepository) GetEnvironmentForFunction(ctx context.Context, funct
 	return &aws.Environment{Variables: variables}, nil
 }
 
+func (f FunctionRepository) GetTagsForFunction(ctx context.Context, function domain.Function) (map[string]string, error) {
+	logger.Infof("Querying tags for Function %s.", function.FunctionName)
+
+	tags := make(map[string]string)
+	rows, err := f.db.QueryContext(
+		ctx,
+		`SELECT key, value FROM lambda_function_tag WHERE function_id=?`,
+		function.ID,
+	)
+	if err != nil {
+		e := Error{"unable to get Tags for Function " + function.FunctionName, err}
+		logger.Error(e)
+		return nil, e
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var value sql.NullString
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			e := RowError{
+				"GetTagsForFunction " + function.FunctionName,
+				len(tags),
+				err,
+			}
+			logger.Error(e)
+			return nil, e
+		}
+
+		tags[key] = value.String
+	}
+
+	return tags, nil
+}
+
+// TagFunction adds or replaces the tags on every version of the named Function, since tags apply to the Function
+// as a whole.
+func (f FunctionRepository) TagFunction(ctx context.Context, name string, tags map[string]string) error {
+	logger.Infof("Tagging Function %s with %+v", name, tags)
+
+	tx, err := f.db.BeginTx(ctx)
+	if err != nil {
+		e := Error{"unable to create transaction to tag Function " + name, err}
+		logger.Error(e)
+		return e
+	}
+
+	for key, value := range tags {
+		_, err = tx.ExecContext(
+			ctx,
+			`DELETE FROM lambda_function_tag
+					WHERE key = ? AND function_id IN (SELECT id FROM lambda_function WHERE name = ?)
+			`,
+			key,
+			name,
+		)
+		if err != nil {
+			msg := tx.Rollback("unable to replace tag %s of Function %s", key, name)
+			e := Error{msg, err}
+			logger.Error(e)
+			return e
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO lambda_function_tag (function_id, key, value)
+					SELECT id, ?, ? FROM lambda_function WHERE name = ?
+			`,
+			key,
+			value,
+			name,
+		)
+		if err != nil {
+			msg := tx.Rollback("unable to add tag %s to Function %s", key, name)
+			e := Error{msg, err}
+			logger.Error(e)
+			return e
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		e := Error{"unable to commit when tagging Function " + name, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
+// UntagFunction removes the tags with the specified keys from every version of the named Function.
+func (f FunctionRepository) UntagFunction(ctx context.Context, name string, keys []string) error {
+	logger.Infof("Removing tags %v from Function %s", keys, name)
+
+	tx, err := f.db.BeginTx(ctx)
+	if err != nil {
+		e := Error{"unable to create transaction to untag Function " + name, err}
+		logger.Error(e)
+		return e
+	}
+
+	for _, key := range keys {
+		_, err = tx.ExecContext(
+			ctx,
+			`DELETE FROM lambda_function_tag
+					WHERE key = ? AND function_id IN (SELECT id FROM lambda_function WHERE name = ?)
+			`,
+			key,
+			name,
+		)
+		if err != nil {
+			msg := tx.Rollback("unable to remove tag %s from Function %s", key, name)
+			e := Error{msg, err}
+			logger.Error(e)
+			return e
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		e := Error{"unable to commit when untagging Function " + name, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
+// GetFunctionConcurrency returns the reserved concurrency of the named Function, or nil if none is reserved.
+func (f FunctionRepository) GetFunctionConcurrency(ctx context.Context, name string) (*int32, error) {
+	logger.Infof("Querying reserved concurrency for Function %s", name)
+
+	row := f.db.QueryRowContext(
+		ctx,
+		`SELECT reserved_concurrency FROM lambda_function_concurrency WHERE function_name = ?`,
+		name,
+	)
+
+	var reserved int32
+	err := row.Scan(&reserved)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		e := Error{"unable to get reserved concurrency for Function " + name, err}
+		logger.Error(e)
+		return nil, e
+	}
+
+	return &reserved, nil
+}
+
+// PutFunctionConcurrency reserves concurrency for the named Function, which applies to all of its versions.
+func (f FunctionRepository) PutFunctionConcurrency(ctx context.Context, name string, reserved int32) error {
+	logger.Infof("Reserving concurrency of %d for Function %s", reserved, name)
+
+	_, err := f.db.ExecContext(
+		ctx,
+		`INSERT INTO lambda_function_concurrency (function_name, reserved_concurrency) VALUES (?, ?)
+				ON CONFLICT(function_name) DO UPDATE SET reserved_concurrency = excluded.reserved_concurrency
+		`,
+		name,
+		reserved,
+	)
+	if err != nil {
+		e := Error{"unable to reserve concurrency for Function " + name, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
+func (f FunctionRepository) DeleteFunctionConcurrency(ctx context.Context, name string) error {
+	logger.Infof("Removing reserved concurrency for Function %s", name)
+
+	_, err := f.db.ExecContext(ctx, `DELETE FROM lambda_function_concurrency WHERE function_name = ?`, name)
+	if err != nil {
+		e := Error{"unable to remove reserved concurrency for Function " + name, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
 func (f FunctionRepository) GetLayersForFunction(ctx context.Context, function domain.Function) ([]domain.LambdaLayer, error) {
 	logger.Infof("Querying for Layers of Function %s.", function.FunctionName)
 	var layers []domain.LambdaLayer
@@ -155,7 +345,8 @@ func (f FunctionRepository) GetLatestFunctionByName(ctx context.Context, name st
 	err := f.db.QueryRowContext(
 		ctx,
 		`SELECT id, name, version, description, handler, role, dead_letter_arn, memory_size,
-					runtime, timeout, code_sha256, code_size, last_modified_on
+					runtime, timeout, code_sha256, code_size, last_modified_on, last_update_status,
+					last_update_status_reason
 				FROM lambda_function WHERE name = ? ORDER BY version DESC LIMIT 1`,
 		name,
 	).Scan(
@@ -172,6 +363,8 @@ func (f FunctionRepository) GetLatestFunctionByName(ctx context.Context, name st
 		&function.CodeSha256,
 		&function.CodeSize,
 		&function.LastModified,
+		&function.LastUpdateStatus,
+		&function.LastUpdateStatusReason,
 	)
 
 	switch {
@@ -188,9 +381,63 @@ func (f FunctionRepository) GetLatestFunctionByName(ctx context.Context, name st
 	}
 
 	logger.Infof("Found Function: %+v", function)
-	logger.Infof("Setting Function %s version to $LATEST", name)
 
-	function.Version = "$LATEST"
+	function.Latest = true
+
+	environment, err := f.GetEnvironmentForFunction(ctx, function)
+	if err != nil {
+		return nil, err
+	}
+
+	function.Environment = environment
+
+	return &function, nil
+}
+
+func (f FunctionRepository) GetFunctionVersion(ctx context.Context, name string, version int) (*domain.Function, error) {
+	logger.Infof("Querying for Version %d of Function %s.", version, name)
+
+	var function domain.Function
+	err := f.db.QueryRowContext(
+		ctx,
+		`SELECT id, name, version, description, handler, role, dead_letter_arn, memory_size,
+					runtime, timeout, code_sha256, code_size, last_modified_on, last_update_status,
+					last_update_status_reason,
+					version = (SELECT max(version) FROM lambda_function WHERE name = lf.name) AS latest
+				FROM lambda_function AS lf WHERE name = ? AND version = ?`,
+		name,
+		version,
+	).Scan(
+		&function.ID,
+		&function.FunctionName,
+		&function.Version,
+		&function.Description,
+		&function.Handler,
+		&function.Role,
+		&function.DeadLetterArn,
+		&function.MemorySize,
+		&function.Runtime,
+		&function.Timeout,
+		&function.CodeSha256,
+		&function.CodeSize,
+		&function.LastModified,
+		&function.LastUpdateStatus,
+		&function.LastUpdateStatusReason,
+		&function.Latest,
+	)
+
+	switch {
+	case err == sql.ErrNoRows:
+		logger.Infof("Version %d of Function %s not found.", version, name)
+		return nil, err
+	case err != nil:
+		e := Error{
+			fmt.Sprintf("unable to query for version %d of function %s", version, name),
+			err,
+		}
+		logger.Error(e)
+		return nil, e
+	}
 
 	environment, err := f.GetEnvironmentForFunction(ctx, function)
 	if err != nil {
@@ -238,8 +485,9 @@ func (f FunctionRepository) GetVersionsForFunctionName(ctx context.Context, name
 	rows, err := f.db.QueryContext(
 		ctx,
 		`SELECT id, name, version, description, handler, role, dead_letter_arn, memory_size,
-					runtime, timeout, code_sha256, code_size, last_modified_on
-				FROM lambda_function WHERE name = ?`,
+					runtime, timeout, code_sha256, code_size, last_modified_on, last_update_status,
+					last_update_status_reason
+				FROM lambda_function WHERE name = ? ORDER BY version`,
 		name,
 	)
 
@@ -265,6 +513,8 @@ func (f FunctionRepository) GetVersionsForFunctionName(ctx context.Context, name
 			&function.CodeSha256,
 			&function.CodeSize,
 			&function.LastModified,
+			&function.LastUpdateStatus,
+			&function.LastUpdateStatusReason,
 		)
 
 		if err != nil {
@@ -295,6 +545,108 @@ func (f FunctionRepository) GetVersionsForFunctionName(ctx context.Context, name
 		results = append(results, function)
 	}
 
+	// the highest version is $LATEST
+	if len(results) > 0 {
+		results[len(results)-1].Latest = true
+	}
+
+	return results, nil
+}
+
+// ListFunctions returns up to limit Functions ordered by name (and version if allVersions is set) that come after
+// the specified name & version. If allVersions isn't set, only the latest version of each Function is returned.
+func (f FunctionRepository) ListFunctions(ctx context.Context, afterName string, afterVersion int, limit int,
+	allVersions bool) ([]domain.Function, error) {
+
+	logger.Infof("Listing %d Functions after %s:%d (all versions = %v)", limit, afterName, afterVersion, allVersions)
+
+	var rows *sql.Rows
+	var err error
+	if allVersions {
+		rows, err = f.db.QueryContext(
+			ctx,
+			`SELECT id, name, version, description, handler, role, dead_letter_arn, memory_size,
+						runtime, timeout, code_sha256, code_size, last_modified_on, last_update_status,
+						last_update_status_reason,
+						version = (SELECT max(version) FROM lambda_function WHERE name = lf.name) AS latest
+					FROM lambda_function AS lf WHERE name > ? OR (name = ? AND version > ?)
+					ORDER BY name, version LIMIT ?`,
+			afterName,
+			afterName,
+			afterVersion,
+			limit,
+		)
+	} else {
+		rows, err = f.db.QueryContext(
+			ctx,
+			`SELECT id, name, version, description, handler, role, dead_letter_arn, memory_size,
+						runtime, timeout, code_sha256, code_size, last_modified_on, last_update_status,
+						last_update_status_reason, 1 AS latest
+					FROM lambda_function AS lf
+					WHERE version = (SELECT max(version) FROM lambda_function WHERE name = lf.name) AND name > ?
+					ORDER BY name LIMIT ?`,
+			afterName,
+			limit,
+		)
+	}
+
+	if err != nil {
+		e := Error{"unable to list Functions", err}
+		logger.Error(e)
+		return nil, e
+	}
+	defer rows.Close()
+
+	var results []domain.Function
+	for rows.Next() {
+		var function domain.Function
+		err := rows.Scan(
+			&function.ID,
+			&function.FunctionName,
+			&function.Version,
+			&function.Description,
+			&function.Handler,
+			&function.Role,
+			&function.DeadLetterArn,
+			&function.MemorySize,
+			&function.Runtime,
+			&function.Timeout,
+			&function.CodeSha256,
+			&function.CodeSize,
+			&function.LastModified,
+			&function.LastUpdateStatus,
+			&function.LastUpdateStatusReason,
+			&function.Latest,
+		)
+
+		if err != nil {
+			e := RowError{
+				Op:   "ListFunctions",
+				Row:  len(results),
+				Base: err,
+			}
+			logger.Error(e)
+			return nil, e
+		}
+
+		results = append(results, function)
+	}
+
+	// hydrate after iterating so the result set isn't held open while issuing other queries
+	for i := range results {
+		function := &results[i]
+		function.Environment, err = f.GetEnvironmentForFunction(ctx, *function)
+		if err != nil {
+			return nil, RowError{"hydrate Environment for ListFunctions", i, err}
+		}
+
+		function.Layers, err = f.GetLayersForFunction(ctx, *function)
+		if err != nil {
+			return nil, RowError{"hydrate Layers for ListFunctions", i, err}
+		}
+	}
+
+	logger.Infof("Found %d Functions.", len(results))
 	return results, nil
 }
 
@@ -360,6 +712,12 @@ func (f FunctionRepository) InsertFunction(ctx context.Context, function *domain
 		ctx,
 		`INSERT INTO lambda_function_tag (function_id, key, value) VALUES (?, ?, ?)`,
 	)
+	if err != nil {
+		msg := tx.Rollback("unable to create statement to add tags to function %s", function.FunctionName)
+		e := Error{msg, err}
+		logger.Error(e)
+		return nil, e
+	}
 	defer tagsStmt.Close()
 
 	for key, value := range function.Tags {
@@ -420,11 +778,228 @@ func (f FunctionRepository) InsertFunction(ctx context.Context, function *domain
 		StateReason:                nil,
 		StateReasonCode:            "",
 		Version:                    function.Version,
+		Latest:                     function.Latest,
 	}
 
 	return &saved, nil
 }
 
+// PublishFunction freezes the current $LATEST version of the Function by copying it (along with its Environment,
+// Layers & Tags) to a new row that becomes $LATEST. The published version gets the optional description, and Event
+// Sources follow $LATEST. Returns the new $LATEST.
+func (f FunctionRepository) PublishFunction(ctx context.Context, latest *domain.Function, description *string) (*domain.Function, error) {
+	logger.Infof("Publishing version %s of Function %s", latest.Version, latest.FunctionName)
+
+	tx, err := f.db.BeginTx(ctx)
+	if err != nil {
+		e := Error{"unable to create transaction to publish Function " + latest.FunctionName, err}
+		logger.Error(e)
+		return nil, e
+	}
+
+	nextId, err := tx.InsertOne(
+		ctx,
+		`INSERT INTO lambda_function (name, version, description, handler, role, dead_letter_arn, memory_size,
+					runtime, timeout, code_sha256, code_size, last_modified_on, last_update_status,
+					last_update_status_reason)
+				SELECT name, version + 1, description, handler, role, dead_letter_arn, memory_size,
+					runtime, timeout, code_sha256, code_size, last_modified_on, last_update_status,
+					last_update_status_reason
+				FROM lambda_function WHERE id = ?
+		`,
+		latest.ID,
+	)
+	if err != nil {
+		msg := tx.Rollback("unable to copy function %s", latest.FunctionName)
+		e := Error{msg, err}
+		logger.Error(e)
+		return nil, e
+	}
+
+	for _, table := range []string{"lambda_function_environment", "lambda_function_tag"} {
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO `+table+` (function_id, key, value) SELECT ?, key, value FROM `+table+` WHERE function_id = ?`,
+			nextId,
+			latest.ID,
+		)
+		if err != nil {
+			msg := tx.Rollback("unable to copy %s for function %s", table, latest.FunctionName)
+			e := Error{msg, err}
+			logger.Error(e)
+			return nil, e
+		}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO lambda_function_layer (function_id, layer_name, layer_version)
+				SELECT ?, layer_name, layer_version FROM lambda_function_layer WHERE function_id = ?`,
+		nextId,
+		latest.ID,
+	)
+	if err != nil {
+		msg := tx.Rollback("unable to copy layers for function %s", latest.FunctionName)
+		e := Error{msg, err}
+		logger.Error(e)
+		return nil, e
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE lambda_event_source SET function_id = ? WHERE function_id = ?`, nextId, latest.ID)
+	if err != nil {
+		msg := tx.Rollback("unable to move event sources for function %s", latest.FunctionName)
+		e := Error{msg, err}
+		logger.Error(e)
+		return nil, e
+	}
+
+	if description != nil {
+		_, err = tx.ExecContext(ctx, `UPDATE lambda_function SET description = ? WHERE id = ?`, *description, latest.ID)
+		if err != nil {
+			msg := tx.Rollback("unable to set description for published function %s", latest.FunctionName)
+			e := Error{msg, err}
+			logger.Error(e)
+			return nil, e
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		e := Error{"unable to commit when publishing function " + latest.FunctionName, err}
+		logger.Error(e)
+		return nil, e
+	}
+
+	version, err := strconv.Atoi(latest.Version)
+	if err != nil {
+		e := Error{"unable to parse version of function " + latest.FunctionName, err}
+		logger.Error(e)
+		return nil, e
+	}
+
+	next := *latest
+	next.ID = nextId
+	next.Version = strconv.Itoa(version + 1)
+	next.Latest = true
+
+	return &next, nil
+}
+
+func (f FunctionRepository) UpdateFunctionCode(ctx context.Context, function *domain.Function) error {
+	logger.Infof("Updating Code for Function %s to %s", function.FunctionName, function.CodeSha256)
+
+	_, err := f.db.ExecContext(
+		ctx,
+		`UPDATE lambda_function SET code_sha256=?, code_size=?, last_modified_on=? WHERE id=?`,
+		function.CodeSha256,
+		function.CodeSize,
+		function.LastModified,
+		function.ID,
+	)
+
+	if err != nil {
+		e := Error{"unable to update Code for Function " + function.FunctionName, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
+func (f FunctionRepository) UpdateFunctionConfiguration(ctx context.Context, function *domain.Function) error {
+	logger.Infof("Updating Configuration for Function %s", function.FunctionName)
+
+	tx, err := f.db.BeginTx(ctx)
+	if err != nil {
+		e := Error{"unable to begin transaction to update Configuration for Function " + function.FunctionName, err}
+		logger.Error(e)
+		return e
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE lambda_function SET description=?, handler=?, role=?, dead_letter_arn=?, memory_size=?, runtime=?,
+					timeout=?, last_modified_on=?, last_update_status=?, last_update_status_reason=?
+				WHERE id=?`,
+		function.Description,
+		function.Handler,
+		function.Role,
+		function.DeadLetterArn,
+		function.MemorySize,
+		function.Runtime,
+		function.Timeout,
+		function.LastModified,
+		function.LastUpdateStatus,
+		function.LastUpdateStatusReason,
+		function.ID,
+	)
+	if err != nil {
+		msg := tx.Rollback("unable to update Configuration for Function %s", function.FunctionName)
+		e := Error{msg, err}
+		logger.Error(e)
+		return e
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM lambda_function_layer WHERE function_id=?`, function.ID)
+	if err != nil {
+		msg := tx.Rollback("unable to remove previous Layers for Function %s", function.FunctionName)
+		e := Error{msg, err}
+		logger.Error(e)
+		return e
+	}
+
+	layerStmt, err := tx.PrepareContext(
+		ctx,
+		`INSERT INTO lambda_function_layer (function_id, layer_name, layer_version) VALUES (?, ?, ?)`,
+	)
+	if err != nil {
+		msg := tx.Rollback("unable to create statement to add layers to function %s", function.FunctionName)
+		e := Error{msg, err}
+		logger.Error(e)
+		return e
+	}
+	defer layerStmt.Close()
+
+	for _, layer := range function.Layers {
+		_, err := layerStmt.ExecContext(ctx, function.ID, layer.Name, layer.Version)
+		if err != nil {
+			msg := tx.Rollback("unable to add layer %s to function %s: %v", layer.Name, function.FunctionName, err)
+			e := Error{msg, err}
+			logger.Error(e)
+			return e
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		e := Error{"unable to commit Configuration changes for Function " + function.FunctionName, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
+func (f FunctionRepository) UpdateFunctionStatus(ctx context.Context, function *domain.Function) error {
+	logger.Infof("Updating status of Function %s to %s", function.FunctionName, function.LastUpdateStatus)
+
+	_, err := f.db.ExecContext(
+		ctx,
+		`UPDATE lambda_function SET last_update_status=?, last_update_status_reason=? WHERE id=?`,
+		function.LastUpdateStatus,
+		function.LastUpdateStatusReason,
+		function.ID,
+	)
+
+	if err != nil {
+		e := Error{"unable to update status for Function " + function.FunctionName, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
+
 func (f FunctionRepository) UpsertFunctionEnvironment(ctx context.Context, function *domain.Function, environment *aws.Environment) error {
 	logger.Infof("Upserting Environment for Function %s", function.FunctionName)
 
@@ -542,3 +1117,95 @@ func prepareEnvironmentUpdateStatements(ctx context.Context, tx database.Transac
 
 	return
 }
+
+// tables that reference lambda_function rows and need to be cleaned up when Functions are deleted
+var functionChildTables = []string{
+	"lambda_event_source",
+	"lambda_function_environment",
+	"lambda_function_layer",
+	"lambda_function_tag",
+}
+
+// functionNameDeletes remove all Aliases, the reserved concurrency, asynchronous invocation configs & queued
+// asynchronous invocations of a Function, in order, given its name
+var functionNameDeletes = []string{
+	`DELETE FROM lambda_function_alias_weight WHERE alias_id IN (SELECT id FROM lambda_function_alias WHERE function_name = ?)`,
+	`DELETE FROM lambda_function_alias WHERE function_name = ?`,
+	`DELETE FROM lambda_function_concurrency WHERE function_name = ?`,
+	`DELETE FROM lambda_function_event_invoke_config WHERE function_name = ?`,
+	`DELETE FROM lambda_async_invocation WHERE function_name = ?`,
+}
+
+// functionVersionDeletes remove the asynchronous invocation config & queued asynchronous invocations of a version of
+// a Function, given its name & version
+var functionVersionDeletes = []string{
+	`DELETE FROM lambda_function_event_invoke_config WHERE function_name = ? AND qualifier = ?`,
+	`DELETE FROM lambda_async_invocation WHERE function_name = ? AND qualifier = ?`,
+}
+
+func (f FunctionRepository) DeleteFunction(ctx context.Context, name string) error {
+	logger.Infof("Deleting all Versions of Function %s", name)
+
+	return f.deleteFunctionRows(ctx, name, functionNameDeletes, []interface{}{name}, `name = ?`, name)
+}
+
+func (f FunctionRepository) DeleteFunctionVersion(ctx context.Context, name string, version int) error {
+	logger.Infof("Deleting Version %d of Function %s", version, name)
+
+	return f.deleteFunctionRows(ctx, name, functionVersionDeletes, []interface{}{name, strconv.Itoa(version)},
+		`name = ? AND version = ?`, name, version)
+}
+
+// deleteFunctionRows deletes the matching Function rows & their children, after running the deletes (with their
+// arguments) for rows that refer to the Function by name.
+func (f FunctionRepository) deleteFunctionRows(ctx context.Context, name string, deletes []string,
+	deleteArgs []interface{}, where string, args ...interface{}) error {
+
+	tx, err := f.db.BeginTx(ctx)
+	if err != nil {
+		e := Error{"unable to create transaction to delete Function " + name, err}
+		logger.Error(e)
+		return e
+	}
+
+	for _, query := range deletes {
+		_, err = tx.ExecContext(ctx, query, deleteArgs...)
+		if err != nil {
+			msg := tx.Rollback("unable to delete rows referring to Function %s", name)
+			e := Error{msg, err}
+			logger.Error(e)
+			return e
+		}
+	}
+
+	for _, table := range functionChildTables {
+		_, err = tx.ExecContext(
+			ctx,
+			`DELETE FROM `+table+` WHERE function_id IN (SELECT id FROM lambda_function WHERE `+where+`)`,
+			args...,
+		)
+		if err != nil {
+			msg := tx.Rollback("unable to delete from %s for Function %s", table, name)
+			e := Error{msg, err}
+			logger.Error(e)
+			return e
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM lambda_function WHERE `+where, args...)
+	if err != nil {
+		msg := tx.Rollback("unable to delete Function %s", name)
+		e := Error{msg, err}
+		logger.Error(e)
+		return e
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		e := Error{"unable to commit when deleting Function " + name, err}
+		logger.Error(e)
+		return e
+	}
+
+	return nil
+}
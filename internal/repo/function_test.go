@@ -0,0 +1,441 @@
+package repo_test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/repo"
+	"github.com/ATenderholt/rainbow-functions/pkg/database"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// insertFunction saves version 1 of the named Function, and then publishes it the specified number of times.
+func insertFunction(t *testing.T, functionRepo *repo.FunctionRepository, name string, published int) *domain.Function {
+	ctx := context.Background()
+
+	function, err := functionRepo.InsertFunction(ctx, &domain.Function{
+		FunctionName: name,
+		Version:      "1",
+		Handler:      "index.handler",
+		Runtime:      "python3.8",
+		Environment:  &types.Environment{Variables: map[string]string{"KEY": "value"}},
+		Tags:         map[string]string{"team": "functions"},
+	})
+	if err != nil {
+		t.Fatalf("unable to insert Function %s: %v", name, err)
+	}
+
+	for i := 0; i < published; i++ {
+		function, err = functionRepo.PublishFunction(ctx, function, nil)
+		if err != nil {
+			t.Fatalf("unable to publish Function %s: %v", name, err)
+		}
+	}
+
+	return function
+}
+
+// names returns the name:version of each Function.
+func names(functions []domain.Function) []string {
+	results := make([]string, len(functions))
+	for i, function := range functions {
+		results[i] = function.FunctionName + ":" + function.Version
+	}
+
+	return results
+}
+
+func TestListFunctionsPaging(t *testing.T) {
+	functionRepo := repo.NewFunctionRepository(newDatabase(t))
+	ctx := context.Background()
+
+	insertFunction(t, functionRepo, "c-function", 1)
+	insertFunction(t, functionRepo, "a-function", 0)
+	insertFunction(t, functionRepo, "b-function", 0)
+
+	first, err := functionRepo.ListFunctions(ctx, "", 0, 2, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a-function:1", "b-function:1"}, names(first))
+
+	second, err := functionRepo.ListFunctions(ctx, "b-function", 1, 2, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c-function:2"}, names(second))
+	if assert.Len(t, second, 1) {
+		assert.True(t, second[0].Latest)
+	}
+
+	last, err := functionRepo.ListFunctions(ctx, "c-function", 2, 2, false)
+	assert.NoError(t, err)
+	assert.Empty(t, last)
+}
+
+func TestListFunctionsAllVersionsPaging(t *testing.T) {
+	functionRepo := repo.NewFunctionRepository(newDatabase(t))
+	ctx := context.Background()
+
+	insertFunction(t, functionRepo, "a-function", 2)
+	insertFunction(t, functionRepo, "b-function", 0)
+
+	first, err := functionRepo.ListFunctions(ctx, "", 0, 2, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a-function:1", "a-function:2"}, names(first))
+	if assert.Len(t, first, 2) {
+		assert.False(t, first[0].Latest)
+		assert.False(t, first[1].Latest)
+	}
+
+	// the page can end part way through the versions of a Function
+	second, err := functionRepo.ListFunctions(ctx, "a-function", 2, 2, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a-function:3", "b-function:1"}, names(second))
+	if assert.Len(t, second, 2) {
+		assert.True(t, second[0].Latest)
+		assert.True(t, second[1].Latest)
+	}
+
+	last, err := functionRepo.ListFunctions(ctx, "b-function", 1, 2, true)
+	assert.NoError(t, err)
+	assert.Empty(t, last)
+}
+
+// enqueue saves an asynchronous invocation of the Function that is due now, returning its request id.
+func enqueue(t *testing.T, invocationRepo *repo.AsyncInvocationRepository, name string, qualifier string) string {
+	invocation := domain.AsyncInvocation{
+		RequestId:    uuid.NewString(),
+		FunctionName: name,
+		Qualifier:    qualifier,
+		Payload:      []byte(`{}`),
+	}
+
+	err := invocationRepo.InsertAsyncInvocation(context.Background(), &invocation)
+	if err != nil {
+		t.Fatalf("unable to insert asynchronous invocation of %s: %v", name, err)
+	}
+
+	return invocation.RequestId
+}
+
+// queued returns the request ids of the asynchronous invocations that are due.
+func queued(t *testing.T, invocationRepo *repo.AsyncInvocationRepository) []string {
+	invocations, err := invocationRepo.GetDueAsyncInvocations(context.Background(), time.Now().UnixMilli(), 100)
+	assert.NoError(t, err)
+
+	results := make([]string, len(invocations))
+	for i, invocation := range invocations {
+		results[i] = invocation.RequestId
+	}
+
+	return results
+}
+
+func TestDeleteFunctionRemovesAsyncInvocations(t *testing.T) {
+	db := newDatabase(t)
+	functionRepo := repo.NewFunctionRepository(db)
+	invocationRepo := repo.NewAsyncInvocationRepository(db)
+
+	insertFunction(t, functionRepo, "test-function", 1)
+	insertFunction(t, functionRepo, "other-function", 0)
+
+	enqueue(t, invocationRepo, "test-function", "")
+	enqueue(t, invocationRepo, "test-function", "1")
+	other := enqueue(t, invocationRepo, "other-function", "")
+
+	err := functionRepo.DeleteFunction(context.Background(), "test-function")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{other}, queued(t, invocationRepo))
+}
+
+func TestDeleteFunctionVersionRemovesItsAsyncInvocations(t *testing.T) {
+	db := newDatabase(t)
+	functionRepo := repo.NewFunctionRepository(db)
+	invocationRepo := repo.NewAsyncInvocationRepository(db)
+
+	insertFunction(t, functionRepo, "test-function", 2)
+
+	latest := enqueue(t, invocationRepo, "test-function", "")
+	enqueue(t, invocationRepo, "test-function", "1")
+	second := enqueue(t, invocationRepo, "test-function", "2")
+
+	err := functionRepo.DeleteFunctionVersion(context.Background(), "test-function", 1)
+	assert.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{latest, second}, queued(t, invocationRepo))
+}
+
+// putConfig saves an invoke config for the qualifier of the named Function.
+func putConfig(t *testing.T, configRepo *repo.EventInvokeConfigRepository, name string, qualifier string) {
+	err := configRepo.PutEventInvokeConfig(context.Background(), &domain.EventInvokeConfig{
+		FunctionName: name,
+		Qualifier:    qualifier,
+		LastModified: time.Now().UnixMilli(),
+	})
+	if err != nil {
+		t.Fatalf("unable to save invoke config for %s of Function %s: %v", qualifier, name, err)
+	}
+}
+
+// hasConfig returns whether an invoke config is saved for the qualifier of the named Function.
+func hasConfig(t *testing.T, configRepo *repo.EventInvokeConfigRepository, name string, qualifier string) bool {
+	_, err := configRepo.GetEventInvokeConfig(context.Background(), name, qualifier)
+	if err == sql.ErrNoRows {
+		return false
+	}
+
+	assert.NoError(t, err)
+	return true
+}
+
+func TestDeleteFunctionRemovesEventInvokeConfigs(t *testing.T) {
+	db := newDatabase(t)
+	functionRepo := repo.NewFunctionRepository(db)
+	configRepo := repo.NewEventInvokeConfigRepository(db)
+
+	insertFunction(t, functionRepo, "test-function", 1)
+	insertFunction(t, functionRepo, "other-function", 0)
+
+	putConfig(t, configRepo, "test-function", domain.LatestVersion)
+	putConfig(t, configRepo, "test-function", "1")
+	putConfig(t, configRepo, "other-function", domain.LatestVersion)
+
+	err := functionRepo.DeleteFunction(context.Background(), "test-function")
+	assert.NoError(t, err)
+
+	assert.False(t, hasConfig(t, configRepo, "test-function", domain.LatestVersion))
+	assert.False(t, hasConfig(t, configRepo, "test-function", "1"))
+	assert.True(t, hasConfig(t, configRepo, "other-function", domain.LatestVersion))
+}
+
+func TestDeleteFunctionVersionRemovesItsEventInvokeConfig(t *testing.T) {
+	db := newDatabase(t)
+	functionRepo := repo.NewFunctionRepository(db)
+	configRepo := repo.NewEventInvokeConfigRepository(db)
+
+	insertFunction(t, functionRepo, "test-function", 2)
+
+	putConfig(t, configRepo, "test-function", domain.LatestVersion)
+	putConfig(t, configRepo, "test-function", "1")
+	putConfig(t, configRepo, "test-function", "2")
+
+	err := functionRepo.DeleteFunctionVersion(context.Background(), "test-function", 1)
+	assert.NoError(t, err)
+
+	assert.True(t, hasConfig(t, configRepo, "test-function", domain.LatestVersion))
+	assert.False(t, hasConfig(t, configRepo, "test-function", "1"))
+	assert.True(t, hasConfig(t, configRepo, "test-function", "2"))
+}
+
+// versionsOf returns the saved versions of the named Function.
+func versionsOf(t *testing.T, functionRepo *repo.FunctionRepository, name string) []string {
+	versions, err := functionRepo.GetVersionsForFunctionName(context.Background(), name)
+	assert.NoError(t, err)
+
+	return names(versions)
+}
+
+// insertEventSource maps a queue to the version of the Function & returns its UUID.
+func insertEventSource(t *testing.T, eventRepo *repo.EventSourceRepository, function *domain.Function,
+	arn string) uuid.UUID {
+
+	id := uuid.New()
+	err := eventRepo.InsertEventSource(context.Background(), domain.EventSource{
+		UUID:         id,
+		Arn:          arn,
+		Function:     function,
+		BatchSize:    10,
+		LastModified: time.Now().UnixMilli(),
+	})
+	if err != nil {
+		t.Fatalf("unable to insert Event Source for Function %s: %v", function.FunctionName, err)
+	}
+
+	return id
+}
+
+// eventSources returns the UUIDs of all saved Event Sources.
+func eventSources(t *testing.T, eventRepo *repo.EventSourceRepository) []uuid.UUID {
+	sources, err := eventRepo.GetAllEventSources(context.Background())
+	assert.NoError(t, err)
+
+	results := make([]uuid.UUID, len(sources))
+	for i, source := range sources {
+		results[i] = source.UUID
+	}
+
+	return results
+}
+
+// orphans counts the rows of the table that refer to a Function that no longer exists.
+func orphans(t *testing.T, db database.Database, table string) int {
+	var count int
+	err := db.QueryRowContext(
+		context.Background(),
+		`SELECT COUNT(*) FROM `+table+` WHERE function_id NOT IN (SELECT id FROM lambda_function)`,
+	).Scan(&count)
+	assert.NoError(t, err)
+
+	return count
+}
+
+func TestDeleteFunction(t *testing.T) {
+	db := newDatabase(t)
+	functionRepo := repo.NewFunctionRepository(db)
+	aliasRepo := repo.NewAliasRepository(db)
+	eventRepo := repo.NewEventSourceRepository(db)
+	ctx := context.Background()
+
+	latest := insertFunction(t, functionRepo, "test-function", 1)
+	other := insertFunction(t, functionRepo, "other-function", 0)
+
+	err := aliasRepo.InsertAlias(ctx, &domain.Alias{
+		FunctionName:             "test-function",
+		Name:                     "live",
+		FunctionVersion:          "1",
+		AdditionalVersionWeights: map[string]float64{"2": 0.5},
+	})
+	assert.NoError(t, err)
+
+	err = functionRepo.PutFunctionConcurrency(ctx, "test-function", 5)
+	assert.NoError(t, err)
+
+	insertEventSource(t, eventRepo, latest, "arn:aws:sqs:us-west-2:271828182845:test-queue")
+	kept := insertEventSource(t, eventRepo, other, "arn:aws:sqs:us-west-2:271828182845:other-queue")
+
+	err = functionRepo.DeleteFunction(ctx, "test-function")
+	assert.NoError(t, err)
+
+	assert.Empty(t, versionsOf(t, functionRepo, "test-function"))
+	assert.Equal(t, []string{"other-function:1"}, versionsOf(t, functionRepo, "other-function"))
+
+	aliases, err := aliasRepo.GetAliasesForFunction(ctx, "test-function")
+	assert.NoError(t, err)
+	assert.Empty(t, aliases)
+
+	reserved, err := functionRepo.GetFunctionConcurrency(ctx, "test-function")
+	assert.NoError(t, err)
+	assert.Nil(t, reserved)
+
+	assert.Equal(t, []uuid.UUID{kept}, eventSources(t, eventRepo))
+
+	for _, table := range []string{"lambda_function_environment", "lambda_function_layer", "lambda_function_tag"} {
+		assert.Zero(t, orphans(t, db, table), table)
+	}
+
+	tags, err := functionRepo.GetTagsForFunction(ctx, *other)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "functions"}, tags)
+
+	environment, err := functionRepo.GetEnvironmentForFunction(ctx, *other)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"KEY": "value"}, environment.Variables)
+}
+
+func TestDeleteFunctionVersion(t *testing.T) {
+	db := newDatabase(t)
+	functionRepo := repo.NewFunctionRepository(db)
+	aliasRepo := repo.NewAliasRepository(db)
+	eventRepo := repo.NewEventSourceRepository(db)
+	ctx := context.Background()
+
+	insertFunction(t, functionRepo, "test-function", 2)
+
+	first, err := functionRepo.GetFunctionVersion(ctx, "test-function", 1)
+	assert.NoError(t, err)
+	second, err := functionRepo.GetFunctionVersion(ctx, "test-function", 2)
+	assert.NoError(t, err)
+
+	err = aliasRepo.InsertAlias(ctx, &domain.Alias{FunctionName: "test-function", Name: "live", FunctionVersion: "2"})
+	assert.NoError(t, err)
+
+	err = functionRepo.PutFunctionConcurrency(ctx, "test-function", 5)
+	assert.NoError(t, err)
+
+	insertEventSource(t, eventRepo, first, "arn:aws:sqs:us-west-2:271828182845:first-queue")
+	kept := insertEventSource(t, eventRepo, second, "arn:aws:sqs:us-west-2:271828182845:second-queue")
+
+	err = functionRepo.DeleteFunctionVersion(ctx, "test-function", 1)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"test-function:2", "test-function:3"}, versionsOf(t, functionRepo, "test-function"))
+	assert.Equal(t, []uuid.UUID{kept}, eventSources(t, eventRepo))
+
+	for _, table := range []string{"lambda_function_environment", "lambda_function_layer", "lambda_function_tag"} {
+		assert.Zero(t, orphans(t, db, table), table)
+	}
+
+	// only the version is deleted, so the Aliases & reserved concurrency of the Function remain
+	alias, err := aliasRepo.GetAlias(ctx, "test-function", "live")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", alias.FunctionVersion)
+
+	reserved, err := functionRepo.GetFunctionConcurrency(ctx, "test-function")
+	assert.NoError(t, err)
+	if assert.NotNil(t, reserved) {
+		assert.Equal(t, int32(5), *reserved)
+	}
+}
+
+// tagsOf returns the tags saved for the version of the named Function.
+func tagsOf(t *testing.T, functionRepo *repo.FunctionRepository, name string, version int) map[string]string {
+	ctx := context.Background()
+
+	function, err := functionRepo.GetFunctionVersion(ctx, name, version)
+	if err != nil {
+		t.Fatalf("unable to get version %d of Function %s: %v", version, name, err)
+	}
+
+	tags, err := functionRepo.GetTagsForFunction(ctx, *function)
+	assert.NoError(t, err)
+
+	return tags
+}
+
+func TestTagFunction(t *testing.T) {
+	functionRepo := repo.NewFunctionRepository(newDatabase(t))
+	ctx := context.Background()
+
+	insertFunction(t, functionRepo, "test-function", 1)
+	insertFunction(t, functionRepo, "other-function", 0)
+
+	err := functionRepo.TagFunction(ctx, "test-function", map[string]string{"team": "platform", "stage": "dev"})
+	assert.NoError(t, err)
+
+	// tags apply to the Function as a whole, so every version has them & a duplicate key replaces the value
+	expected := map[string]string{"team": "platform", "stage": "dev"}
+	assert.Equal(t, expected, tagsOf(t, functionRepo, "test-function", 1))
+	assert.Equal(t, expected, tagsOf(t, functionRepo, "test-function", 2))
+
+	err = functionRepo.TagFunction(ctx, "test-function", map[string]string{"stage": "prod"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "platform", "stage": "prod"}, tagsOf(t, functionRepo, "test-function", 2))
+
+	assert.Equal(t, map[string]string{"team": "functions"}, tagsOf(t, functionRepo, "other-function", 1))
+}
+
+func TestUntagFunction(t *testing.T) {
+	functionRepo := repo.NewFunctionRepository(newDatabase(t))
+	ctx := context.Background()
+
+	insertFunction(t, functionRepo, "test-function", 1)
+	insertFunction(t, functionRepo, "other-function", 0)
+
+	err := functionRepo.TagFunction(ctx, "test-function", map[string]string{"stage": "dev"})
+	assert.NoError(t, err)
+
+	// missing keys are ignored
+	err = functionRepo.UntagFunction(ctx, "test-function", []string{"team", "missing"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"stage": "dev"}, tagsOf(t, functionRepo, "test-function", 1))
+	assert.Equal(t, map[string]string{"stage": "dev"}, tagsOf(t, functionRepo, "test-function", 2))
+
+	err = functionRepo.UntagFunction(ctx, "test-function", []string{"stage"})
+	assert.NoError(t, err)
+	assert.Empty(t, tagsOf(t, functionRepo, "test-function", 2))
+
+	assert.Equal(t, map[string]string{"team": "functions"}, tagsOf(t, functionRepo, "other-function", 1))
+}
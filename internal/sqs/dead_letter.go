@@ -0,0 +1,78 @@
+package sqs
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"strconv"
+	"unicode/utf8"
+)
+
+// like AWS, only the start of the error message is included with the event
+const maxErrorMessageLength = 1024
+
+// DeadLetterAttributes returns the message attributes that Lambda adds to the event of a failed asynchronous
+// invocation when sending it to a dead-letter queue.
+func DeadLetterAttributes(requestId string, errorCode int, errorMessage string) map[string]types.MessageAttributeValue {
+	if len(errorMessage) > maxErrorMessageLength {
+		n := maxErrorMessageLength
+		for n > 0 && !utf8.RuneStart(errorMessage[n]) {
+			n--
+		}
+		errorMessage = errorMessage[:n]
+	}
+
+	attributes := map[string]types.MessageAttributeValue{
+		"RequestID": {DataType: aws.String("String"), StringValue: aws.String(requestId)},
+		"ErrorCode": {DataType: aws.String("Number"), StringValue: aws.String(strconv.Itoa(errorCode))},
+	}
+
+	// SQS rejects empty attribute values
+	if errorMessage != "" {
+		attributes["ErrorMessage"] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(errorMessage),
+		}
+	}
+
+	return attributes
+}
+
+// SendDeadLetter sends the event of a failed asynchronous invocation to the queue with the ARN.
+func (m *Manager) SendDeadLetter(ctx context.Context, arn string, requestId string, event []byte, errorCode int,
+	errorMessage string) error {
+
+	err := m.SendMessage(ctx, arn, event, DeadLetterAttributes(requestId, errorCode, errorMessage))
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Sent event of request %s to dead-letter queue %s", requestId, arn)
+
+	return nil
+}
+
+// SendMessage sends the body & attributes (which may be nil) to the queue with the ARN, which is resolved through the
+// SQS endpoint for its region & account.
+func (m *Manager) SendMessage(ctx context.Context, arn string, body []byte,
+	attributes map[string]types.MessageAttributeValue) error {
+
+	q := m.newQueue(arn)
+	queueUrl, err := m.resolveQueue(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:          &queueUrl,
+		MessageBody:       aws.String(string(body)),
+		MessageAttributes: attributes,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to send message to queue %s: %v", q.name, err)
+	}
+
+	return nil
+}
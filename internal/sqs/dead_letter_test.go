@@ -0,0 +1,34 @@
+package sqs_test
+
+import (
+	"github.com/ATenderholt/rainbow-functions/internal/sqs"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDeadLetterAttributes(t *testing.T) {
+	attributes := sqs.DeadLetterAttributes("request-1", 200, "something broke")
+
+	assert.Len(t, attributes, 3)
+	assert.Equal(t, "request-1", *attributes["RequestID"].StringValue)
+	assert.Equal(t, "String", *attributes["RequestID"].DataType)
+	assert.Equal(t, "200", *attributes["ErrorCode"].StringValue)
+	assert.Equal(t, "Number", *attributes["ErrorCode"].DataType)
+	assert.Equal(t, "something broke", *attributes["ErrorMessage"].StringValue)
+}
+
+func TestDeadLetterAttributesTruncatesMessage(t *testing.T) {
+	attributes := sqs.DeadLetterAttributes("request-1", 200, "a"+strings.Repeat("é", 1024))
+
+	message := *attributes["ErrorMessage"].StringValue
+	assert.Equal(t, 1023, len(message))
+	assert.True(t, utf8.ValidString(message))
+}
+
+func TestDeadLetterAttributesWithoutMessage(t *testing.T) {
+	attributes := sqs.DeadLetterAttributes("request-1", 500, "")
+
+	assert.NotContains(t, attributes, "ErrorMessage")
+}
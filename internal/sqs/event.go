@@ -0,0 +1,277 @@
+package sqs
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/ATenderholt/rainbow-functions/pkg/filter"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"math"
+	"strings"
+	"time"
+)
+
+// Event is the payload that Lambda sends to Functions for a batch of SQS messages
+type Event struct {
+	Records []Record `json:"Records"`
+}
+
+type Record struct {
+	MessageId         string                      `json:"messageId"`
+	ReceiptHandle     string                      `json:"receiptHandle"`
+	Body              string                      `json:"body"`
+	Attributes        map[string]string           `json:"attributes"`
+	MessageAttributes map[string]MessageAttribute `json:"messageAttributes"`
+	Md5OfBody         string                      `json:"md5OfBody"`
+	EventSource       string                      `json:"eventSource"`
+	EventSourceARN    string                      `json:"eventSourceARN"`
+	AwsRegion         string                      `json:"awsRegion"`
+}
+
+type MessageAttribute struct {
+	StringValue      *string  `json:"stringValue,omitempty"`
+	BinaryValue      []byte   `json:"binaryValue,omitempty"`
+	StringListValues []string `json:"stringListValues"`
+	BinaryListValues [][]byte `json:"binaryListValues"`
+	DataType         string   `json:"dataType"`
+}
+
+// NewEvent creates the Event for messages received from the queue with the specified ARN.
+func NewEvent(arn string, messages []types.Message) Event {
+	region := ""
+	if parts := strings.Split(arn, ":"); len(parts) > 3 {
+		region = parts[3]
+	}
+
+	records := make([]Record, len(messages))
+	for i, message := range messages {
+		records[i] = newRecord(arn, region, message)
+	}
+
+	return Event{Records: records}
+}
+
+func newRecord(arn string, region string, message types.Message) Record {
+	attributes := message.Attributes
+	if attributes == nil {
+		attributes = make(map[string]string)
+	}
+
+	messageAttributes := make(map[string]MessageAttribute, len(message.MessageAttributes))
+	for name, value := range message.MessageAttributes {
+		messageAttributes[name] = MessageAttribute{
+			StringValue:      value.StringValue,
+			BinaryValue:      value.BinaryValue,
+			StringListValues: emptyIfNil(value.StringListValues),
+			BinaryListValues: emptyBytesIfNil(value.BinaryListValues),
+			DataType:         aws.ToString(value.DataType),
+		}
+	}
+
+	return Record{
+		MessageId:         aws.ToString(message.MessageId),
+		ReceiptHandle:     aws.ToString(message.ReceiptHandle),
+		Body:              aws.ToString(message.Body),
+		Attributes:        attributes,
+		MessageAttributes: messageAttributes,
+		Md5OfBody:         aws.ToString(message.MD5OfBody),
+		EventSource:       "aws:sqs",
+		EventSourceARN:    arn,
+		AwsRegion:         region,
+	}
+}
+
+func emptyIfNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
+
+func emptyBytesIfNil(values [][]byte) [][]byte {
+	if values == nil {
+		return [][]byte{}
+	}
+
+	return values
+}
+
+// FilterMessages splits the messages into those that match the criteria & those that don't. Like AWS, patterns are
+// evaluated against the record sent to the Function, with a body that is valid JSON matched as an object.
+func FilterMessages(criteria *filter.Criteria, arn string, messages []types.Message) ([]types.Message, []types.Message) {
+	if criteria == nil {
+		return messages, nil
+	}
+
+	event := NewEvent(arn, messages)
+
+	var matched, filtered []types.Message
+	for i, record := range event.Records {
+		fields, err := recordFields(record)
+		if err != nil {
+			logger.Errorf("Unable to evaluate filter criteria for message %s: %v", record.MessageId, err)
+			matched = append(matched, messages[i])
+			continue
+		}
+
+		if criteria.Matches(fields) {
+			matched = append(matched, messages[i])
+		} else {
+			filtered = append(filtered, messages[i])
+		}
+	}
+
+	return matched, filtered
+}
+
+func recordFields(record Record) (map[string]interface{}, error) {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(value, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var body interface{}
+	if json.Unmarshal([]byte(record.Body), &body) == nil {
+		fields["body"] = body
+	}
+
+	return fields, nil
+}
+
+// SuccessfulMessages returns the messages that the Function didn't report as failures in its response. An error is
+// returned if the response is invalid or refers to an unknown message, in which case the whole batch is considered to
+// have failed.
+func SuccessfulMessages(messages []types.Message, payload []byte) ([]types.Message, error) {
+	failed, err := poller.FailedItems(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(failed) == 0 {
+		return messages, nil
+	}
+
+	results := make([]types.Message, 0, len(messages))
+	for _, message := range messages {
+		id := aws.ToString(message.MessageId)
+		if failed[id] {
+			delete(failed, id)
+			continue
+		}
+		results = append(results, message)
+	}
+
+	if len(failed) > 0 {
+		return nil, fmt.Errorf("unknown itemIdentifier in batch response %s", payload)
+	}
+
+	return results, nil
+}
+
+// StopFailedGroups returns the successful messages, except those that follow a failed message in the same message
+// group. Lambda stops processing a group of a FIFO queue when a message fails, so that the rest are redelivered in
+// order after it rather than being deleted.
+func StopFailedGroups(messages []types.Message, successful []types.Message) []types.Message {
+	succeeded := make(map[string]bool, len(successful))
+	for _, message := range successful {
+		succeeded[aws.ToString(message.MessageId)] = true
+	}
+
+	failedGroups := make(map[string]bool)
+	results := make([]types.Message, 0, len(successful))
+	for _, message := range messages {
+		group := message.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)]
+		if !succeeded[aws.ToString(message.MessageId)] || failedGroups[group] {
+			failedGroups[group] = true
+			continue
+		}
+
+		results = append(results, message)
+	}
+
+	return results
+}
+
+// ProcessedMessages returns the messages that can be deleted from the queue after the Function was invoked with them:
+// none if the invocation failed, those it didn't report as failures if the Event Source reports batch item failures,
+// and otherwise all of them. For FIFO queues, messages that follow a failure in their message group are kept too.
+func ProcessedMessages(eventSource *domain.EventSource, fifo bool, messages []types.Message, payload []byte,
+	invokeErr error) []types.Message {
+
+	var successful []types.Message
+	switch {
+	case invokeErr != nil:
+		logger.Errorf("Function failed with %d messages: %v", len(messages), invokeErr)
+	case eventSource.ReportsBatchItemFailures():
+		var err error
+		successful, err = SuccessfulMessages(messages, payload)
+		if err != nil {
+			logger.Errorf("Unable to tell which of %d messages succeeded: %v", len(messages), err)
+		}
+	default:
+		successful = messages
+	}
+
+	if fifo {
+		successful = StopFailedGroups(messages, successful)
+	}
+
+	return successful
+}
+
+// BatchingDeadline is when to stop waiting for a full batch, given when its first messages were received.
+func BatchingDeadline(eventSource *domain.EventSource, received time.Time) time.Time {
+	return received.Add(time.Duration(eventSource.MaximumBatchingWindowInSeconds) * time.Second)
+}
+
+// BatchComplete returns whether a batch with count messages should be processed now. Without a batching window,
+// whatever a single receive returns is a batch, and otherwise messages are collected until there are BatchSize of them
+// or the deadline has passed. Nothing is processed when no messages have been received.
+func BatchComplete(eventSource *domain.EventSource, count int, deadline time.Time, now time.Time) bool {
+	return count == 0 || eventSource.MaximumBatchingWindowInSeconds == 0 || int32(count) >= eventSource.BatchSize ||
+		!now.Before(deadline)
+}
+
+// ReceiveLimits returns how many messages to receive for a batch that already has count of them, which SQS limits to
+// 10 per request, and how many seconds to wait for them. The first receive waits for 1 second, and the rest long poll
+// for the remainder of the batching window, which SQS limits to 20 seconds.
+func ReceiveLimits(eventSource *domain.EventSource, count int, deadline time.Time, now time.Time) (int32, int32) {
+	maxMessages := eventSource.BatchSize - int32(count)
+	if maxMessages > 10 {
+		maxMessages = 10
+	}
+
+	if count == 0 {
+		return maxMessages, 1
+	}
+
+	waitTime := int32(math.Ceil(deadline.Sub(now).Seconds()))
+	switch {
+	case waitTime > 20:
+		waitTime = 20
+	case waitTime < 0:
+		waitTime = 0
+	}
+
+	return maxMessages, waitTime
+}
+
+// VisibilityTimeout keeps received messages hidden while the rest of the batch is collected, and for as long as the
+// Function may take to process them.
+func VisibilityTimeout(eventSource *domain.EventSource) int32 {
+	timeout := eventSource.Function.Timeout
+	if timeout < 1 {
+		timeout = 30
+	}
+
+	return timeout + eventSource.MaximumBatchingWindowInSeconds
+}
@@ -0,0 +1,334 @@
+package sqs_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/sqs"
+	"github.com/ATenderholt/rainbow-functions/pkg/filter"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const queueArn = "arn:aws:sqs:us-west-2:123456789012:my-queue"
+
+func TestNewEvent(t *testing.T) {
+	messages := []types.Message{
+		{
+			Attributes: map[string]string{"ApproximateReceiveCount": "1"},
+			Body:       aws.String("hello"),
+			MD5OfBody:  aws.String("5d41402abc4b2a76b9719d911017c592"),
+			MessageAttributes: map[string]types.MessageAttributeValue{
+				"color": {DataType: aws.String("String"), StringValue: aws.String("blue")},
+			},
+			MessageId:     aws.String("id-1"),
+			ReceiptHandle: aws.String("handle-1"),
+		},
+		{
+			Body:          aws.String("world"),
+			MessageId:     aws.String("id-2"),
+			ReceiptHandle: aws.String("handle-2"),
+		},
+	}
+
+	event := sqs.NewEvent(queueArn, messages)
+
+	assert.Len(t, event.Records, 2)
+
+	record := event.Records[0]
+	assert.Equal(t, "id-1", record.MessageId)
+	assert.Equal(t, "handle-1", record.ReceiptHandle)
+	assert.Equal(t, "hello", record.Body)
+	assert.Equal(t, "1", record.Attributes["ApproximateReceiveCount"])
+	assert.Equal(t, "blue", *record.MessageAttributes["color"].StringValue)
+	assert.Equal(t, "String", record.MessageAttributes["color"].DataType)
+	assert.Equal(t, "aws:sqs", record.EventSource)
+	assert.Equal(t, queueArn, record.EventSourceARN)
+	assert.Equal(t, "us-west-2", record.AwsRegion)
+
+	assert.NotNil(t, event.Records[1].Attributes)
+	assert.NotNil(t, event.Records[1].MessageAttributes)
+}
+
+func TestEventJson(t *testing.T) {
+	event := sqs.NewEvent(queueArn, []types.Message{{Body: aws.String("hello"), MessageId: aws.String("id-1")}})
+
+	payload, err := json.Marshal(event)
+	assert.NoError(t, err)
+
+	var decoded map[string][]map[string]interface{}
+	err = json.Unmarshal(payload, &decoded)
+	assert.NoError(t, err)
+
+	record := decoded["Records"][0]
+	assert.Equal(t, "id-1", record["messageId"])
+	assert.Equal(t, "hello", record["body"])
+	assert.Equal(t, queueArn, record["eventSourceARN"])
+	assert.Equal(t, "aws:sqs", record["eventSource"])
+}
+
+func batch() []types.Message {
+	return []types.Message{
+		{MessageId: aws.String("id-1"), ReceiptHandle: aws.String("handle-1")},
+		{MessageId: aws.String("id-2"), ReceiptHandle: aws.String("handle-2")},
+		{MessageId: aws.String("id-3"), ReceiptHandle: aws.String("handle-3")},
+	}
+}
+
+func TestSuccessfulMessagesWithoutFailures(t *testing.T) {
+	for _, payload := range []string{"", "null", "{}", `{"batchItemFailures":[]}`, `{"batchItemFailures":null}`} {
+		successful, err := sqs.SuccessfulMessages(batch(), []byte(payload))
+		assert.NoError(t, err, payload)
+		assert.Len(t, successful, 3, payload)
+	}
+}
+
+func TestSuccessfulMessagesWithFailures(t *testing.T) {
+	payload := `{"batchItemFailures":[{"itemIdentifier":"id-2"}]}`
+
+	successful, err := sqs.SuccessfulMessages(batch(), []byte(payload))
+
+	assert.NoError(t, err)
+	assert.Len(t, successful, 2)
+	assert.Equal(t, "id-1", *successful[0].MessageId)
+	assert.Equal(t, "id-3", *successful[1].MessageId)
+}
+
+func TestSuccessfulMessagesWithInvalidResponse(t *testing.T) {
+	payloads := []string{
+		`not json`,
+		`{"batchItemFailures":[{"itemIdentifier":""}]}`,
+		`{"batchItemFailures":[{"itemIdentifier":null}]}`,
+		`{"batchItemFailures":[{"id":"id-1"}]}`,
+		`{"batchItemFailures":[{"itemIdentifier":"unknown"}]}`,
+	}
+
+	for _, payload := range payloads {
+		_, err := sqs.SuccessfulMessages(batch(), []byte(payload))
+		assert.Error(t, err, payload)
+	}
+}
+
+func TestFilterMessages(t *testing.T) {
+	criteria, err := filter.NewCriteria([]string{
+		`{"body": {"color": ["red"]}}`,
+		`{"messageAttributes": {"priority": {"stringValue": ["high"]}}}`,
+	})
+	assert.NoError(t, err)
+
+	messages := []types.Message{
+		{Body: aws.String(`{"color": "red"}`), MessageId: aws.String("id-1")},
+		{Body: aws.String(`{"color": "blue"}`), MessageId: aws.String("id-2")},
+		{Body: aws.String("not json"), MessageId: aws.String("id-3")},
+		{
+			Body: aws.String("not json"),
+			MessageAttributes: map[string]types.MessageAttributeValue{
+				"priority": {DataType: aws.String("String"), StringValue: aws.String("high")},
+			},
+			MessageId: aws.String("id-4"),
+		},
+	}
+
+	matched, filtered := sqs.FilterMessages(criteria, queueArn, messages)
+
+	assert.Equal(t, []types.Message{messages[0], messages[3]}, matched)
+	assert.Equal(t, []types.Message{messages[1], messages[2]}, filtered)
+}
+
+func TestFilterMessagesPlainBody(t *testing.T) {
+	criteria, err := filter.NewCriteria([]string{`{"body": [{"prefix": "order"}]}`})
+	assert.NoError(t, err)
+
+	messages := []types.Message{
+		{Body: aws.String("order-1"), MessageId: aws.String("id-1")},
+		{Body: aws.String("refund-1"), MessageId: aws.String("id-2")},
+	}
+
+	matched, filtered := sqs.FilterMessages(criteria, queueArn, messages)
+
+	assert.Equal(t, []types.Message{messages[0]}, matched)
+	assert.Equal(t, []types.Message{messages[1]}, filtered)
+}
+
+func fifoMessage(id string, group string) types.Message {
+	return types.Message{
+		Attributes: map[string]string{"MessageGroupId": group},
+		MessageId:  aws.String(id),
+	}
+}
+
+func TestStopFailedGroups(t *testing.T) {
+	messages := []types.Message{
+		fifoMessage("a-1", "a"),
+		fifoMessage("b-1", "b"),
+		fifoMessage("a-2", "a"),
+		fifoMessage("b-2", "b"),
+		fifoMessage("a-3", "a"),
+	}
+
+	// a-2 failed, so a-3 must wait for it even though the Function reported it as successful
+	successful := []types.Message{messages[0], messages[1], messages[3], messages[4]}
+
+	results := sqs.StopFailedGroups(messages, successful)
+
+	assert.Equal(t, []types.Message{messages[0], messages[1], messages[3]}, results)
+}
+
+func TestStopFailedGroupsAllSuccessful(t *testing.T) {
+	messages := []types.Message{fifoMessage("a-1", "a"), fifoMessage("a-2", "a")}
+
+	results := sqs.StopFailedGroups(messages, messages)
+
+	assert.Equal(t, messages, results)
+}
+
+func TestStopFailedGroupsFirstFailed(t *testing.T) {
+	messages := []types.Message{fifoMessage("a-1", "a"), fifoMessage("a-2", "a"), fifoMessage("b-1", "b")}
+
+	results := sqs.StopFailedGroups(messages, messages[1:])
+
+	assert.Equal(t, []types.Message{messages[2]}, results)
+}
+
+func TestProcessedMessages(t *testing.T) {
+	reporting := &domain.EventSource{
+		FunctionResponseTypes: []lambdatypes.FunctionResponseType{lambdatypes.FunctionResponseTypeReportBatchItemFailures},
+	}
+	failures := []byte(`{"batchItemFailures":[{"itemIdentifier":"id-2"}]}`)
+
+	tests := []struct {
+		name        string
+		eventSource *domain.EventSource
+		payload     []byte
+		err         error
+		expected    []string
+	}{
+		{"succeeded", &domain.EventSource{}, failures, nil, []string{"id-1", "id-2", "id-3"}},
+		{"failed", &domain.EventSource{}, nil, errors.New("function error"), nil},
+		{"failed reporting failures", reporting, failures, errors.New("function error"), nil},
+		{"reported failures", reporting, failures, nil, []string{"id-1", "id-3"}},
+		{"invalid response", reporting, []byte(`not json`), nil, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results := sqs.ProcessedMessages(test.eventSource, false, batch(), test.payload, test.err)
+			assert.Equal(t, test.expected, messageIds(results))
+		})
+	}
+}
+
+func TestProcessedMessagesFifo(t *testing.T) {
+	eventSource := &domain.EventSource{
+		FunctionResponseTypes: []lambdatypes.FunctionResponseType{lambdatypes.FunctionResponseTypeReportBatchItemFailures},
+	}
+	messages := []types.Message{fifoMessage("a-1", "a"), fifoMessage("a-2", "a"), fifoMessage("b-1", "b")}
+
+	// a-2 waits for a-1, which failed, even though the Function didn't report it as a failure
+	payload := []byte(`{"batchItemFailures":[{"itemIdentifier":"a-1"}]}`)
+	results := sqs.ProcessedMessages(eventSource, true, messages, payload, nil)
+	assert.Equal(t, []string{"b-1"}, messageIds(results))
+
+	results = sqs.ProcessedMessages(eventSource, true, messages, nil, errors.New("function error"))
+	assert.Empty(t, results)
+}
+
+// messageIds returns the ID of each message, or nil if there aren't any.
+func messageIds(messages []types.Message) []string {
+	var results []string
+	for _, message := range messages {
+		results = append(results, *message.MessageId)
+	}
+
+	return results
+}
+
+func TestBatchingDeadline(t *testing.T) {
+	received := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	assert.Equal(t, received, sqs.BatchingDeadline(&domain.EventSource{}, received))
+	assert.Equal(t, received.Add(5*time.Second),
+		sqs.BatchingDeadline(&domain.EventSource{MaximumBatchingWindowInSeconds: 5}, received))
+}
+
+func TestBatchComplete(t *testing.T) {
+	now := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	windowed := &domain.EventSource{BatchSize: 10, MaximumBatchingWindowInSeconds: 5}
+
+	tests := []struct {
+		name        string
+		eventSource *domain.EventSource
+		count       int
+		deadline    time.Time
+		expected    bool
+	}{
+		{"nothing received", windowed, 0, now.Add(-time.Second), true},
+		{"no window", &domain.EventSource{BatchSize: 10}, 1, now, true},
+		{"waiting", windowed, 9, now.Add(time.Second), false},
+		{"full", windowed, 10, now.Add(time.Second), true},
+		{"more than full", windowed, 12, now.Add(time.Second), true},
+		{"deadline", windowed, 1, now, true},
+		{"deadline passed", windowed, 1, now.Add(-time.Second), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, sqs.BatchComplete(test.eventSource, test.count, test.deadline, now))
+		})
+	}
+}
+
+func TestReceiveLimits(t *testing.T) {
+	now := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	eventSource := &domain.EventSource{BatchSize: 25, MaximumBatchingWindowInSeconds: 60}
+
+	tests := []struct {
+		name        string
+		count       int
+		deadline    time.Time
+		maxMessages int32
+		waitTime    int32
+	}{
+		{"first", 0, time.Time{}, 10, 1},
+		{"rest of window", 10, now.Add(1500 * time.Millisecond), 10, 2},
+		{"longest poll", 10, now.Add(time.Minute), 10, 20},
+		{"rest of batch", 20, now.Add(5 * time.Second), 5, 5},
+		{"deadline passed", 20, now.Add(-time.Second), 5, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			maxMessages, waitTime := sqs.ReceiveLimits(eventSource, test.count, test.deadline, now)
+			assert.Equal(t, test.maxMessages, maxMessages)
+			assert.Equal(t, test.waitTime, waitTime)
+		})
+	}
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  int32
+		window   int32
+		expected int32
+	}{
+		{"default timeout", 0, 0, 30},
+		{"function timeout", 90, 0, 90},
+		{"with window", 90, 20, 110},
+		{"default timeout with window", 0, 5, 35},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			eventSource := &domain.EventSource{
+				Function:                       &domain.Function{Timeout: test.timeout},
+				MaximumBatchingWindowInSeconds: test.window,
+			}
+			assert.Equal(t, test.expected, sqs.VisibilityTimeout(eventSource))
+		})
+	}
+}
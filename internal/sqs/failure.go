@@ -0,0 +1,166 @@
+package sqs
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"strconv"
+	"time"
+)
+
+// BatchInfo describes a batch of messages that was discarded
+type BatchInfo struct {
+	QueueArn   string   `json:"queueArn"`
+	MessageIds []string `json:"messageIds"`
+	BatchSize  int      `json:"batchSize"`
+}
+
+// FailureRecord is sent to the OnFailure destination of an Event Source for discarded messages. Unlike the records of
+// a stream, messages can't be read again once they are deleted from the queue, so the event that the Function was
+// invoked with is included too.
+type FailureRecord struct {
+	poller.FailureRecord
+	SQSBatchInfo   BatchInfo `json:"SQSBatchInfo"`
+	RequestPayload Event     `json:"requestPayload"`
+}
+
+// NewFailureRecord adds the BatchInfo & event of the messages, which were received from the queue with the ARN, to
+// the record.
+func NewFailureRecord(record poller.FailureRecord, arn string, messages []types.Message) FailureRecord {
+	ids := make([]string, len(messages))
+	for i, message := range messages {
+		ids[i] = aws.ToString(message.MessageId)
+	}
+
+	return FailureRecord{
+		FailureRecord: record,
+		SQSBatchInfo: BatchInfo{
+			QueueArn:   arn,
+			MessageIds: ids,
+			BatchSize:  len(messages),
+		},
+		RequestPayload: NewEvent(arn, messages),
+	}
+}
+
+// DiscardedMessages returns the failed messages that were sent to the queue longer ago than the Event Source's
+// MaximumRecordAgeInSeconds, and then the rest of those that have been received more than MaximumRetryAttempts
+// times since they have already been retried that many times. Neither is limited when it is -1.
+func DiscardedMessages(eventSource *domain.EventSource, failed []types.Message,
+	now time.Time) ([]types.Message, []types.Message) {
+
+	maxAge := time.Duration(eventSource.MaximumRecordAgeInSeconds) * time.Second
+	retries := int(eventSource.MaximumRetryAttempts)
+
+	var aged, exhausted []types.Message
+	for _, message := range failed {
+		sent := messageAttribute(message, types.MessageSystemAttributeNameSentTimestamp)
+		received := messageAttribute(message, types.MessageSystemAttributeNameApproximateReceiveCount)
+
+		switch {
+		case maxAge >= 0 && sent > 0 && !now.Before(time.UnixMilli(int64(sent)).Add(maxAge)):
+			aged = append(aged, message)
+		case retries >= 0 && received > retries:
+			exhausted = append(exhausted, message)
+		}
+	}
+
+	return aged, exhausted
+}
+
+// messageAttribute returns the numeric system attribute of the message, or 0 if it wasn't received with one.
+func messageAttribute(message types.Message, name types.MessageSystemAttributeName) int {
+	value, err := strconv.Atoi(message.Attributes[string(name)])
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
+
+// Unsuccessful returns the messages that aren't in successful, in order.
+func Unsuccessful(messages []types.Message, successful []types.Message) []types.Message {
+	succeeded := make(map[string]bool, len(successful))
+	for _, message := range successful {
+		succeeded[aws.ToString(message.MessageId)] = true
+	}
+
+	results := make([]types.Message, 0, len(messages)-len(successful))
+	for _, message := range messages {
+		if !succeeded[aws.ToString(message.MessageId)] {
+			results = append(results, message)
+		}
+	}
+
+	return results
+}
+
+// discardMessages deletes the failed messages that won't be retried, after sending them to the OnFailure destination
+// if there is one, and returns how many are left on the queue for redelivery. Messages that can't be sent are left
+// on the queue too.
+func (m *Manager) discardMessages(eventSource *domain.EventSource, q *queue, queueUrl string,
+	failed []types.Message, output *lambda.InvokeOutput) int {
+
+	aged, exhausted := DiscardedMessages(eventSource, failed, time.Now())
+	remaining := len(failed)
+
+	if len(aged) > 0 && m.onFailure(eventSource, aged, poller.ConditionRecordAgeExceeded, output) {
+		logger.Errorf("Discarding %d messages that are older than %d seconds", len(aged),
+			eventSource.MaximumRecordAgeInSeconds)
+		m.deleteMessages(q, queueUrl, aged)
+		remaining -= len(aged)
+	}
+
+	if len(exhausted) > 0 && m.onFailure(eventSource, exhausted, poller.ConditionRetryAttemptsExhausted, output) {
+		logger.Errorf("Discarding %d messages after %d retries", len(exhausted), eventSource.MaximumRetryAttempts)
+		m.deleteMessages(q, queueUrl, exhausted)
+		remaining -= len(exhausted)
+	}
+
+	return remaining
+}
+
+// onFailure sends a FailureRecord for the messages to the OnFailure destination, if there is one, returning whether
+// they can be deleted from the queue.
+func (m *Manager) onFailure(eventSource *domain.EventSource, messages []types.Message, condition string,
+	output *lambda.InvokeOutput) bool {
+
+	destination := eventSource.OnFailure
+	if destination == "" {
+		return true
+	}
+
+	// messages are received once per invocation, so the most received one has been invoked the most
+	attempts := 0
+	for _, message := range messages {
+		received := messageAttribute(message, types.MessageSystemAttributeNameApproximateReceiveCount)
+		if received > attempts {
+			attempts = received
+		}
+	}
+
+	functionArn := *eventSource.Function.GetArn(m.cfg)
+	record := poller.NewFailureRecord(functionArn, condition, attempts, output, time.Now())
+	payload, err := json.Marshal(NewFailureRecord(record, eventSource.Arn, messages))
+	if err != nil {
+		logger.Errorf("Unable to marshal failure record for %d messages: %v", len(messages), err)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	err = m.SendMessage(ctx, destination, payload, nil)
+	if err != nil {
+		logger.Errorf("Unable to send %d discarded messages to %s: %v", len(messages), destination, err)
+		return false
+	}
+
+	logger.Infof("Sent %s record for %d messages to %s", condition, len(messages), destination)
+
+	return true
+}
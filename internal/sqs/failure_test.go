@@ -0,0 +1,102 @@
+package sqs_test
+
+import (
+	"encoding/json"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/ATenderholt/rainbow-functions/internal/sqs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func receivedMessage(id string, sent time.Time, received int) types.Message {
+	return types.Message{
+		MessageId: aws.String(id),
+		Attributes: map[string]string{
+			"SentTimestamp":           strconv.FormatInt(sent.UnixMilli(), 10),
+			"ApproximateReceiveCount": strconv.Itoa(received),
+		},
+	}
+}
+
+func ids(messages []types.Message) []string {
+	results := make([]string, len(messages))
+	for i, message := range messages {
+		results[i] = aws.ToString(message.MessageId)
+	}
+
+	return results
+}
+
+func TestDiscardedMessages(t *testing.T) {
+	now := time.Now()
+	eventSource := domain.EventSource{MaximumRetryAttempts: 2, MaximumRecordAgeInSeconds: 60}
+	failed := []types.Message{
+		receivedMessage("new", now, 1),
+		receivedMessage("old", now.Add(-time.Minute), 1),
+		receivedMessage("retried", now, 3),
+		receivedMessage("both", now.Add(-time.Hour), 5),
+		receivedMessage("retrying", now, 2),
+	}
+
+	aged, exhausted := sqs.DiscardedMessages(&eventSource, failed, now)
+
+	assert.Equal(t, []string{"old", "both"}, ids(aged))
+	assert.Equal(t, []string{"retried"}, ids(exhausted))
+}
+
+func TestDiscardedMessagesWithoutLimits(t *testing.T) {
+	now := time.Now()
+	eventSource := domain.EventSource{MaximumRetryAttempts: -1, MaximumRecordAgeInSeconds: -1}
+	failed := []types.Message{
+		receivedMessage("old", now.Add(-24*time.Hour), 1),
+		receivedMessage("retried", now, 100),
+	}
+
+	aged, exhausted := sqs.DiscardedMessages(&eventSource, failed, now)
+
+	assert.Empty(t, aged)
+	assert.Empty(t, exhausted)
+}
+
+func TestDiscardedMessagesWithoutRetries(t *testing.T) {
+	eventSource := domain.EventSource{MaximumRetryAttempts: 0, MaximumRecordAgeInSeconds: -1}
+	failed := []types.Message{receivedMessage("1", time.Now(), 1)}
+
+	_, exhausted := sqs.DiscardedMessages(&eventSource, failed, time.Now())
+
+	assert.Equal(t, []string{"1"}, ids(exhausted))
+}
+
+func TestUnsuccessful(t *testing.T) {
+	messages := batch()
+
+	assert.Equal(t, []string{"id-2"}, ids(sqs.Unsuccessful(messages, []types.Message{messages[0], messages[2]})))
+	assert.Equal(t, ids(messages), ids(sqs.Unsuccessful(messages, nil)))
+	assert.Empty(t, sqs.Unsuccessful(messages, messages))
+}
+
+func TestFailureRecordJson(t *testing.T) {
+	record := poller.NewFailureRecord("arn:aws:lambda:us-west-2:123456789012:function:fn",
+		poller.ConditionRetryAttemptsExhausted, 3, nil, time.Now())
+	messages := []types.Message{{MessageId: aws.String("1"), Body: aws.String("hello")}}
+
+	payload, err := json.Marshal(sqs.NewFailureRecord(record, queueArn, messages))
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(payload, &decoded))
+	assert.Equal(t, "RetryAttemptsExhausted", decoded["requestContext"].(map[string]interface{})["condition"])
+	assert.Equal(t, map[string]interface{}{
+		"queueArn":   queueArn,
+		"messageIds": []interface{}{"1"},
+		"batchSize":  float64(1),
+	}, decoded["SQSBatchInfo"])
+
+	records := decoded["requestPayload"].(map[string]interface{})["Records"].([]interface{})
+	assert.Equal(t, "hello", records[0].(map[string]interface{})["body"])
+}
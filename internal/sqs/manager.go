@@ -6,134 +6,329 @@ import (
 	"errors"
 	"fmt"
 	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/ATenderholt/rainbow-functions/pkg/filter"
 	"github.com/ATenderholt/rainbow-functions/settings"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/lambda"
-	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/google/uuid"
-	"strings"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
 )
 
+// how long to spend deleting or releasing messages, which happens even if the Event Source is stopping
+const cleanupTimeout = 30 * time.Second
+
 type Manager struct {
-	eventRepo    domain.EventSourceRepository
-	eventSources map[uuid.UUID]context.CancelFunc
-	lambdaClient *lambda.Client
-	sqsClient    *sqs.Client
+	cfg       *settings.Config
+	eventRepo domain.EventSourceRepository
+	pollers   *poller.Registry
+	lambda    *poller.Lambda
+
+	// clients for each SQS endpoint & region, guarded by lock since Event Sources are started concurrently
+	sqsClients map[string]*sqs.Client
+	lock       sync.Mutex
 }
 
 func NewManager(cfg *settings.Config, eventRepo domain.EventSourceRepository) *Manager {
-	sqsCfg := aws.Config{
-		Region:                      "us-west-2",
-		Credentials:                 credentials,
-		EndpointResolverWithOptions: sqsEndpointResolver(cfg.SqsEndpoint),
-		ClientLogMode:               0,
-		DefaultsMode:                "",
-		RuntimeEnvironment:          aws.RuntimeEnvironment{},
-	}
-
-	lambdaCfg := aws.Config{
-		Region:                      "us-west-2",
-		Credentials:                 credentials,
-		EndpointResolverWithOptions: lambdaEndpointResolver(cfg.BasePort),
-		ClientLogMode:               0,
-		DefaultsMode:                "",
-		RuntimeEnvironment:          aws.RuntimeEnvironment{},
-	}
-
 	return &Manager{
-		eventRepo:    eventRepo,
-		eventSources: make(map[uuid.UUID]context.CancelFunc),
-		lambdaClient: lambda.NewFromConfig(lambdaCfg),
-		sqsClient:    sqs.NewFromConfig(sqsCfg),
+		cfg:        cfg,
+		eventRepo:  eventRepo,
+		pollers:    poller.NewRegistry(),
+		lambda:     poller.NewLambda(cfg),
+		sqsClients: make(map[string]*sqs.Client),
 	}
 }
 
+// CreateEventSource starts consumption for a newly created Event Source.
+func (m *Manager) CreateEventSource(ctx context.Context, eventSource *domain.EventSource) error {
+	return m.startEventSource(ctx, eventSource, poller.StateCreating)
+}
+
+// StartEventSource starts consumption for an existing Event Source that is being enabled.
 func (m *Manager) StartEventSource(ctx context.Context, eventSource *domain.EventSource) error {
-	parts := strings.Split(eventSource.Arn, ":")
-	queueName := parts[5]
+	return m.startEventSource(ctx, eventSource, poller.StateEnabling)
+}
+
+func (m *Manager) startEventSource(ctx context.Context, eventSource *domain.EventSource, state string) error {
+	q := m.newQueue(eventSource.Arn)
 
-	logger.Infof("Starting consumption from Queue %s ...", queueName)
+	logger.Infof("Starting consumption from Queue %s ...", q.name)
 
-	runCtx, cancel := context.WithCancel(ctx)
+	st := m.pollers.NewStatus(eventSource.UUID, state)
 
-	listQueuesOutput, err := m.sqsClient.ListQueues(ctx, &sqs.ListQueuesInput{QueueNamePrefix: &queueName})
+	criteria, err := filter.NewCriteria(eventSource.FilterPatterns)
 	if err != nil {
-		msg := fmt.Sprintf("Unable to list queues for %s: %v", queueName, err)
+		msg := fmt.Sprintf("Unable to parse filter criteria for Event Source %s: %v", eventSource.UUID, err)
 		logger.Error(msg)
-		cancel()
+		m.pollers.SetState(st, poller.StateDisabled, "PROBLEM: "+msg)
 		return errors.New(msg)
 	}
 
-	if len(listQueuesOutput.QueueUrls) != 1 {
-		msg := fmt.Sprintf("Found %d queue urls for %s: %v", len(listQueuesOutput.QueueUrls), queueName, listQueuesOutput.QueueUrls)
-		logger.Error(msg)
-		cancel()
-		return errors.New(msg)
-	}
+	// the queue is resolved by the pollers, so that they keep retrying if SQS isn't available yet
+	m.pollers.Run(ctx, eventSource.UUID, st, func(ctx context.Context) {
+		m.scale(ctx, eventSource, q, criteria, st)
+	})
+
+	return nil
+}
+
+// poll receives batches of messages from the queue & invokes the Function with each, until either context is
+// cancelled. Cancelling receiveCtx (which is derived from ctx) only stops receiving, so that the batch that has been
+// received is still processed. Errors are retried with backoff, re-resolving the queue in case it has changed.
+func (m *Manager) poll(ctx context.Context, receiveCtx context.Context, eventSource *domain.EventSource, q *queue,
+	criteria *filter.Criteria, st *poller.Status) {
+
+	failures := 0
+	for {
+		queueUrl, err := m.resolveQueue(receiveCtx, q)
+
+		var messages []sqstypes.Message
+		if err == nil {
+			messages, err = m.collect(receiveCtx, eventSource, q, queueUrl)
+		}
+
+		if ctx.Err() != nil {
+			m.releaseMessages(q, queueUrl, messages)
+			return
+		}
 
-	queueUrl := listQueuesOutput.QueueUrls[0]
-	receiveMessageInput := sqs.ReceiveMessageInput{
-		QueueUrl:                &queueUrl,
-		AttributeNames:          nil,
-		MaxNumberOfMessages:     eventSource.BatchSize,
-		MessageAttributeNames:   nil,
-		ReceiveRequestAttemptId: nil,
-		VisibilityTimeout:       0,
-		WaitTimeSeconds:         1,
-	}
-
-	go func() {
-		for {
-			select {
-			case <-runCtx.Done():
-				return
-			default:
-				receiveMessageOutput, err := m.sqsClient.ReceiveMessage(ctx, &receiveMessageInput)
-				if err != nil {
-					logger.Errorf("Error: %v", err)
-					continue
-				}
-
-				for _, message := range receiveMessageOutput.Messages {
-					logger.Infof("Received %+v", message)
-					payload, err := json.Marshal(message)
-					if err != nil {
-						logger.Errorf("Unable to marshal %v to bytes: %v", message, err)
-					}
-
-					input := lambda.InvokeInput{
-						FunctionName:   &eventSource.Function.FunctionName,
-						ClientContext:  nil,
-						InvocationType: types.InvocationTypeEvent,
-						Payload:        payload,
-						Qualifier:      nil,
-					}
-
-					_, err = m.lambdaClient.Invoke(context.Background(), &input)
-					if err != nil {
-						logger.Errorf("Unable to invoke Function %s: %v", eventSource.Function.FunctionName, err)
-						continue
-					}
-
-					_, err = m.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
-						QueueUrl:      &queueUrl,
-						ReceiptHandle: message.ReceiptHandle,
-					})
-					if err != nil {
-						logger.Errorf("Unable to delete Message %s: %v", message.ReceiptHandle, err)
-						continue
-					}
-				}
+		if len(messages) > 0 {
+			m.process(eventSource, q, queueUrl, criteria, messages, st)
+		}
+
+		if receiveCtx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			if failures > 0 {
+				logger.Infof("Polling for Event Source %s recovered after %d failures", eventSource.UUID, failures)
+				m.pollers.SetProblem(st, "")
+				failures = 0
 			}
+			continue
 		}
-	}()
 
-	m.eventSources[eventSource.UUID] = cancel
+		q.invalidate(queueUrl)
+		delay := poller.Backoff(failures, rand.Float64())
+		failures++
 
-	return nil
+		logger.Errorf("Unable to poll Queue %s for Event Source %s (attempt %d), retrying in %v: %v", q.name,
+			eventSource.UUID, failures, delay, err)
+		m.pollers.SetProblem(st, fmt.Sprintf("PROBLEM: Unable to poll Queue %s: %v", q.name, err))
+
+		if !poller.Sleep(receiveCtx, delay) {
+			return
+		}
+	}
+}
+
+// collect receives messages until there are BatchSize of them, or the batching window has passed since the first one
+// was received. Without a batching window, whatever a single receive returns is collected. Messages that were received
+// before an error are returned along with it.
+func (m *Manager) collect(ctx context.Context, eventSource *domain.EventSource, q *queue,
+	queueUrl string) ([]sqstypes.Message, error) {
+
+	var deadline time.Time
+	var messages []sqstypes.Message
+
+	for {
+		maxMessages, waitTime := ReceiveLimits(eventSource, len(messages), deadline, time.Now())
+
+		receiveMessageInput := sqs.ReceiveMessageInput{
+			QueueUrl:                &queueUrl,
+			AttributeNames:          attributeNames(q),
+			MaxNumberOfMessages:     maxMessages,
+			MessageAttributeNames:   []string{"All"},
+			ReceiveRequestAttemptId: nil,
+			VisibilityTimeout:       VisibilityTimeout(eventSource),
+			WaitTimeSeconds:         waitTime,
+		}
+
+		receiveMessageOutput, err := q.client.ReceiveMessage(ctx, &receiveMessageInput)
+		if ctx.Err() != nil {
+			return messages, nil
+		}
+
+		if err != nil {
+			return messages, fmt.Errorf("unable to receive messages: %v", err)
+		}
+
+		if len(messages) == 0 {
+			deadline = BatchingDeadline(eventSource, time.Now())
+		}
+		messages = append(messages, receiveMessageOutput.Messages...)
+
+		if BatchComplete(eventSource, len(messages), deadline, time.Now()) {
+			return messages, nil
+		}
+	}
+}
+
+// attributeNames are the attributes to receive with each message, which include the ones that order messages in FIFO
+// queues.
+func attributeNames(q *queue) []sqstypes.QueueAttributeName {
+	names := []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameAll}
+	if q.fifo {
+		names = append(names,
+			sqstypes.QueueAttributeName(sqstypes.MessageSystemAttributeNameMessageGroupId),
+			sqstypes.QueueAttributeName(sqstypes.MessageSystemAttributeNameSequenceNumber),
+			sqstypes.QueueAttributeName(sqstypes.MessageSystemAttributeNameMessageDeduplicationId),
+		)
+	}
+
+	return names
+}
+
+// process invokes the Function once with the batch of messages, and deletes them from the queue only if it succeeds
+// (or just the messages that succeeded when it reports batch item failures). Otherwise, the messages become visible
+// again once their visibility timeout expires & are redelivered, unless they are discarded because they are too old or
+// have been retried too many times. Messages that don't match the filter criteria are deleted without invoking the
+// Function. For FIFO queues, messages that follow a failure in their message group are left on the queue too, so that
+// the group is redelivered in order. Once started, processing isn't cancelled when the Event Source is stopped, so
+// that a batch isn't redelivered after the Function has already handled it.
+func (m *Manager) process(eventSource *domain.EventSource, q *queue, queueUrl string, criteria *filter.Criteria,
+	messages []sqstypes.Message, st *poller.Status) {
+
+	logger.Infof("Received %d messages for Event Source %s", len(messages), eventSource.UUID)
+
+	messages, filtered := FilterMessages(criteria, eventSource.Arn, messages)
+	if len(filtered) > 0 {
+		logger.Infof("Deleting %d messages that don't match filter criteria", len(filtered))
+		m.deleteMessages(q, queueUrl, filtered)
+	}
+
+	if len(messages) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(NewEvent(eventSource.Arn, messages))
+	if err != nil {
+		logger.Errorf("Unable to marshal %d messages to bytes: %v", len(messages), err)
+		return
+	}
+
+	// Event Sources bound to an Alias or published version invoke it rather than $LATEST
+	function := eventSource.InvokedName()
+	output, err := m.lambda.InvokeOutput(&function, payload)
+
+	var response []byte
+	if output != nil {
+		response = output.Payload
+	}
+
+	successful := ProcessedMessages(eventSource, q.fifo, messages, response, err)
+	if len(successful) < len(messages) {
+		remaining := m.discardMessages(eventSource, q, queueUrl, Unsuccessful(messages, successful), output)
+		logger.Infof("Leaving %d failed messages on queue for redelivery", remaining)
+		m.pollers.SetResult(st, poller.ResultFunctionFailed)
+	} else {
+		m.pollers.SetResult(st, poller.ResultOk)
+	}
+
+	m.deleteMessages(q, queueUrl, successful)
+}
+
+// deleteMessages deletes the messages from the queue in batches of up to 10, which is the most SQS allows. This
+// isn't cancelled along with the Event Source, since the messages have already been processed.
+func (m *Manager) deleteMessages(q *queue, queueUrl string, messages []sqstypes.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	for start := 0; start < len(messages); start += 10 {
+		end := start + 10
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		entries := make([]sqstypes.DeleteMessageBatchRequestEntry, 0, end-start)
+		for i, message := range messages[start:end] {
+			id := strconv.Itoa(i)
+			entries = append(entries, sqstypes.DeleteMessageBatchRequestEntry{
+				Id:            &id,
+				ReceiptHandle: message.ReceiptHandle,
+			})
+		}
+
+		output, err := q.client.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+			Entries:  entries,
+			QueueUrl: &queueUrl,
+		})
+		if err != nil {
+			logger.Errorf("Unable to delete %d messages: %v", len(entries), err)
+			continue
+		}
+
+		for _, failed := range output.Failed {
+			logger.Errorf("Unable to delete message #%s: %s", *failed.Id, aws.ToString(failed.Message))
+		}
+	}
+}
+
+// releaseMessages makes messages that were received, but won't be processed because the Event Source is stopping,
+// visible again right away instead of once their visibility timeout expires.
+func (m *Manager) releaseMessages(q *queue, queueUrl string, messages []sqstypes.Message) {
+	if len(messages) == 0 {
+		return
+	}
+
+	logger.Infof("Releasing %d unprocessed messages back to the queue", len(messages))
+
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	for start := 0; start < len(messages); start += 10 {
+		end := start + 10
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		entries := make([]sqstypes.ChangeMessageVisibilityBatchRequestEntry, 0, end-start)
+		for i, message := range messages[start:end] {
+			id := strconv.Itoa(i)
+			entries = append(entries, sqstypes.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                &id,
+				ReceiptHandle:     message.ReceiptHandle,
+				VisibilityTimeout: 0,
+			})
+		}
+
+		_, err := q.client.ChangeMessageVisibilityBatch(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+			Entries:  entries,
+			QueueUrl: &queueUrl,
+		})
+		if err != nil {
+			logger.Errorf("Unable to release %d messages: %v", len(entries), err)
+		}
+	}
+}
+
+// StopEventSource cancels consumption for the Event Source that is being disabled, if it is running.
+func (m *Manager) StopEventSource(id uuid.UUID) {
+	m.pollers.Stop(id, poller.StateDisabling)
+}
+
+// RemoveEventSource cancels consumption for the Event Source that is being deleted, if it is running.
+func (m *Manager) RemoveEventSource(id uuid.UUID) {
+	m.pollers.Stop(id, poller.StateDeleting)
+}
+
+// Describe sets the current state of the Event Source, as well as the reason for it & the result of the last poll.
+func (m *Manager) Describe(eventSource *domain.EventSource) {
+	m.pollers.Describe(eventSource)
 }
 
+// ShutdownAll stops consumption for all Event Sources, and waits for in-flight batches to finish until the context
+// is done.
+func (m *Manager) ShutdownAll(ctx context.Context) error {
+	return m.pollers.ShutdownAll(ctx)
+}
+
+// StartAllEventSources starts consumption for all enabled Event Sources that aren't streams.
 func (m *Manager) StartAllEventSources(ctx context.Context) error {
 	sources, err := m.eventRepo.GetAllEventSources(ctx)
 	if err != nil {
@@ -142,8 +337,18 @@ func (m *Manager) StartAllEventSources(ctx context.Context) error {
 		return errors.New(msg)
 	}
 
-	for _, source := range sources {
-		err = m.StartEventSource(ctx, &source)
+	for i := range sources {
+		source := &sources[i]
+		if !source.IsQueue() {
+			continue
+		}
+
+		if !source.Enabled {
+			logger.Infof("Event Source %s is disabled, so not starting it", source.UUID)
+			continue
+		}
+
+		err = m.StartEventSource(ctx, source)
 		if err != nil {
 			logger.Errorf("Unable to start Event Source %s", source.UUID)
 		}
@@ -151,3 +356,28 @@ func (m *Manager) StartAllEventSources(ctx context.Context) error {
 
 	return nil
 }
+
+// StopEventSourcesForFunction cancels consumption for all Event Sources of the named Function. If version
+// is non-empty, only Event Sources for that version of the Function are stopped.
+func (m *Manager) StopEventSourcesForFunction(ctx context.Context, name string, version string) error {
+	sources, err := m.eventRepo.GetAllEventSources(ctx)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to stop Event Sources for Function %s: %v", name, err)
+		logger.Error(msg)
+		return errors.New(msg)
+	}
+
+	for _, source := range sources {
+		if !source.IsQueue() || source.Function.FunctionName != name {
+			continue
+		}
+
+		if version != "" && source.Function.Version != version {
+			continue
+		}
+
+		m.RemoveEventSource(source.UUID)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package sqs
+
+import (
+	"context"
+	"fmt"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"strings"
+	"sync"
+)
+
+// queue caches the URL of an Event Source's queue, which is shared by its pollers & re-resolved after errors in case
+// the queue was re-created or SQS was restarted.
+type queue struct {
+	name    string
+	region  string
+	account string
+
+	// messages in FIFO queues are processed in order within each message group
+	fifo bool
+
+	// client for the endpoint that hosts the queue's region & account
+	client *sqs.Client
+
+	lock sync.Mutex
+	url  string
+}
+
+// newQueue returns the queue with the ARN, which is in the configured region & account if the ARN doesn't say.
+func (m *Manager) newQueue(arn string) *queue {
+	q := queue{name: arn, region: m.cfg.Region, account: m.cfg.AccountNumber}
+	if parts := strings.Split(arn, ":"); len(parts) > 5 {
+		q.name = parts[5]
+		if parts[3] != "" {
+			q.region = parts[3]
+		}
+		if parts[4] != "" {
+			q.account = parts[4]
+		}
+	}
+
+	q.fifo = strings.HasSuffix(q.name, ".fifo")
+	q.client = m.sqsClient(q.region, q.account)
+	return &q
+}
+
+// sqsClient returns the client for queues in the region & account, sharing clients between queues that use the same
+// endpoint & region.
+func (m *Manager) sqsClient(region string, account string) *sqs.Client {
+	endpoint := m.cfg.SqsEndpointFor(region, account)
+	key := region + " " + endpoint
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	client, ok := m.sqsClients[key]
+	if !ok {
+		logger.Infof("Using SQS endpoint %s for region %s", endpoint, region)
+		client = sqs.NewFromConfig(aws.Config{
+			Region:                      region,
+			Credentials:                 poller.Credentials,
+			EndpointResolverWithOptions: poller.EndpointResolver(endpoint),
+			ClientLogMode:               0,
+			DefaultsMode:                "",
+			RuntimeEnvironment:          aws.RuntimeEnvironment{},
+		})
+		m.sqsClients[key] = client
+	}
+
+	return client
+}
+
+// invalidate forgets the URL, unless it has already been re-resolved to a different one.
+func (q *queue) invalidate(url string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.url == url {
+		q.url = ""
+	}
+}
+
+// resolveQueue returns the URL of the queue, looking it up if it isn't known.
+func (m *Manager) resolveQueue(ctx context.Context, q *queue) (string, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.url != "" {
+		return q.url, nil
+	}
+
+	output, err := q.client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName:              &q.name,
+		QueueOwnerAWSAccountId: &q.account,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to get URL of queue %s in account %s: %v", q.name, q.account, err)
+	}
+
+	q.url = aws.ToString(output.QueueUrl)
+	logger.Infof("Resolved Queue %s to %s", q.name, q.url)
+
+	return q.url, nil
+}
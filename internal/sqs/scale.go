@@ -0,0 +1,136 @@
+package sqs
+
+import (
+	"context"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/ATenderholt/rainbow-functions/pkg/filter"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// how often the number of pollers is adjusted to the depth of the queue
+	scaleInterval = 10 * time.Second
+
+	// most pollers for an Event Source without a ScalingConfig, like the five that AWS starts with
+	defaultMaximumConcurrency = 5
+)
+
+// scale runs between one poller & the Event Source's limit, based on how many batches are waiting in the queue, until
+// the context is cancelled. Pollers that are no longer needed finish the batch they are working on before stopping.
+func (m *Manager) scale(ctx context.Context, eventSource *domain.EventSource, q *queue, criteria *filter.Criteria,
+	st *poller.Status) {
+
+	var wg sync.WaitGroup
+	var cancels []context.CancelFunc
+	defer wg.Wait()
+
+	ticker := time.NewTicker(scaleInterval)
+	defer ticker.Stop()
+
+	for {
+		desired := Pollers(m.queueDepth(ctx, q), eventSource.BatchSize, m.concurrencyLimit(ctx, eventSource))
+		if desired != len(cancels) {
+			logger.Infof("Scaling Event Source %s from %d to %d pollers", eventSource.UUID, len(cancels), desired)
+		}
+
+		for len(cancels) < desired {
+			receiveCtx, cancel := context.WithCancel(ctx)
+			cancels = append(cancels, cancel)
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				m.poll(ctx, receiveCtx, eventSource, q, criteria, st)
+			}()
+		}
+
+		for len(cancels) > desired {
+			last := len(cancels) - 1
+			cancels[last]()
+			cancels = cancels[:last]
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Pollers returns how many pollers are needed to receive the batches in a queue with the specified depth, which is at
+// least one (so that new messages are noticed) and at most the limit.
+func Pollers(depth int, batchSize int32, limit int) int {
+	desired := 1
+	if batchSize > 0 {
+		desired = (depth + int(batchSize) - 1) / int(batchSize)
+	}
+
+	if desired < 1 {
+		desired = 1
+	}
+
+	if desired > limit {
+		desired = limit
+	}
+
+	return desired
+}
+
+// queueDepth returns the approximate number of visible messages in the queue, or 0 if it cannot be determined (in
+// which case the pollers report the problem).
+func (m *Manager) queueDepth(ctx context.Context, q *queue) int {
+	queueUrl, err := m.resolveQueue(ctx, q)
+	if err != nil {
+		return 0
+	}
+
+	output, err := q.client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       &queueUrl,
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameApproximateNumberOfMessages},
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Errorf("Unable to get depth of Queue %s: %v", queueUrl, err)
+		}
+		return 0
+	}
+
+	depth, err := strconv.Atoi(output.Attributes[string(sqstypes.QueueAttributeNameApproximateNumberOfMessages)])
+	if err != nil {
+		logger.Errorf("Invalid depth of Queue %s: %v", queueUrl, err)
+		return 0
+	}
+
+	return depth
+}
+
+// concurrencyLimit is the MaximumConcurrency of the Event Source, further limited by the Function's reserved
+// concurrency since invocations beyond it would be throttled.
+func (m *Manager) concurrencyLimit(ctx context.Context, eventSource *domain.EventSource) int {
+	limit := int(eventSource.MaximumConcurrency)
+	if limit == 0 {
+		limit = defaultMaximumConcurrency
+	}
+
+	// reserved concurrency belongs to the Function as a whole, whichever version the Event Source invokes
+	reserved, err := m.lambda.ReservedConcurrency(ctx, &eventSource.Function.FunctionName)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Errorf("Unable to get reserved concurrency of Function %s: %v",
+				eventSource.Function.FunctionName, err)
+		}
+		return limit
+	}
+
+	if reserved != nil && int(*reserved) < limit {
+		limit = int(*reserved)
+	}
+
+	return limit
+}
@@ -0,0 +1,23 @@
+package sqs_test
+
+import (
+	"github.com/ATenderholt/rainbow-functions/internal/sqs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPollersScaleWithDepth(t *testing.T) {
+	assert.Equal(t, 1, sqs.Pollers(0, 10, 5))
+	assert.Equal(t, 1, sqs.Pollers(10, 10, 5))
+	assert.Equal(t, 2, sqs.Pollers(11, 10, 5))
+	assert.Equal(t, 4, sqs.Pollers(35, 10, 5))
+}
+
+func TestPollersLimited(t *testing.T) {
+	assert.Equal(t, 5, sqs.Pollers(1000, 10, 5))
+	assert.Equal(t, 2, sqs.Pollers(1000, 1, 2))
+}
+
+func TestPollersWithoutReservedConcurrency(t *testing.T) {
+	assert.Equal(t, 0, sqs.Pollers(1000, 10, 0))
+}
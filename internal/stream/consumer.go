@@ -0,0 +1,484 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/ATenderholt/rainbow-functions/pkg/filter"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// how often shards are listed, to find the ones created when the stream is resharded
+	shardInterval = 10 * time.Second
+
+	// how long to wait before reading a shard again when it has no new records
+	readInterval = time.Second
+
+	// how long to spend saving a checkpoint, which happens even if the Event Source is stopping
+	checkpointTimeout = 30 * time.Second
+)
+
+// consumer reads the shards of an Event Source's stream & invokes its Function with batches of records.
+type consumer struct {
+	m           *Manager
+	eventSource *domain.EventSource
+	stream      stream
+	criteria    *filter.Criteria
+	status      *poller.Status
+}
+
+// consume reads each shard of the stream in the background until the context is cancelled. Shards are listed
+// periodically, and ones created by resharding are read once their parents have been read to the end.
+func (c *consumer) consume(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	reading := make(map[string]bool)
+	finished := make(chan string)
+	failures := 0
+
+	for {
+		shards, err := c.readableShards(ctx, reading)
+
+		delay := shardInterval
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			delay = poller.Backoff(failures, rand.Float64())
+			failures++
+
+			logger.Errorf("Unable to list shards of stream %s for Event Source %s (attempt %d), retrying in %v: %v",
+				c.stream.name(), c.eventSource.UUID, failures, delay, err)
+			c.m.pollers.SetProblem(c.status, fmt.Sprintf("PROBLEM: Unable to list shards of stream %s: %v",
+				c.stream.name(), err))
+		case failures > 0:
+			logger.Infof("Listing shards for Event Source %s recovered after %d failures", c.eventSource.UUID,
+				failures)
+			c.m.pollers.SetProblem(c.status, "")
+			failures = 0
+		}
+
+		for i := range shards {
+			shard := shards[i]
+			reading[shard.shardId] = true
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.readShard(ctx, shard.shardId, shard.position)
+
+				select {
+				case finished <- shard.shardId:
+				case <-ctx.Done():
+				}
+			}()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case shardId := <-finished:
+			// children of the shard may be readable now
+			timer.Stop()
+			delete(reading, shardId)
+		case <-timer.C:
+		}
+	}
+}
+
+type readableShard struct {
+	shardId  string
+	position position
+}
+
+// readableShards returns the shards that aren't being read, haven't been read to the end & whose parents have been,
+// along with the position to start reading each from.
+func (c *consumer) readableShards(ctx context.Context, reading map[string]bool) ([]readableShard, error) {
+	shards, err := c.stream.shards(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints, err := c.m.eventRepo.GetCheckpoints(ctx, c.eventSource.UUID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		listed[shard.Id] = true
+	}
+
+	var results []readableShard
+	for _, shard := range shards {
+		checkpoint, ok := checkpoints[shard.Id]
+		if reading[shard.Id] || checkpoint.Closed {
+			continue
+		}
+
+		// parents that are no longer listed have expired, so there is nothing left to read from them
+		readParents, waiting := 0, false
+		for _, parent := range shard.Parents {
+			switch {
+			case checkpoints[parent].Closed:
+				readParents++
+			case listed[parent]:
+				waiting = true
+			}
+		}
+
+		if waiting {
+			continue
+		}
+
+		p := position{
+			after:            checkpoint.SequenceNumber,
+			startingPosition: c.eventSource.StartingPosition,
+		}
+		if c.eventSource.StartingPositionTimestamp != 0 {
+			timestamp := time.UnixMilli(c.eventSource.StartingPositionTimestamp)
+			p.timestamp = &timestamp
+		}
+
+		// children continue where their parents left off, rather than from the starting position
+		if !ok && readParents > 0 {
+			p.startingPosition = types.EventSourcePositionTrimHorizon
+		}
+
+		results = append(results, readableShard{shardId: shard.Id, position: p})
+	}
+
+	return results, nil
+}
+
+// readShard reads batches of records from the shard & invokes the Function with each, until the shard has been read
+// to the end or the context is cancelled. Errors are retried with backoff, reading again from the last checkpoint.
+func (c *consumer) readShard(ctx context.Context, shardId string, p position) {
+	logger.Infof("Reading shard %s of stream %s for Event Source %s", shardId, c.stream.name(), c.eventSource.UUID)
+
+	window := time.Duration(c.eventSource.MaximumBatchingWindowInSeconds) * time.Second
+	var deadline time.Time
+	var iterator *string
+	var batch []Record
+	failures := 0
+
+	for {
+		var err error
+		if iterator == nil {
+			iterator, err = c.stream.iterator(ctx, shardId, p)
+		}
+
+		var records []Record
+		var next *string
+		if err == nil {
+			records, next, err = c.stream.records(ctx, shardId, iterator, c.eventSource.BatchSize-int32(len(batch)))
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			// records in the unfinished batch are read again after the checkpoint
+			iterator, batch = nil, nil
+
+			if c.stream.expired(err) {
+				logger.Infof("Iterator for shard %s expired, continuing from checkpoint", shardId)
+				continue
+			}
+
+			if c.stream.trimmed(err) {
+				logger.Warnf("Records after the checkpoint of shard %s have expired, continuing from the oldest one",
+					shardId)
+				p.after, p.startingPosition = "", types.EventSourcePositionTrimHorizon
+				continue
+			}
+
+			delay := poller.Backoff(failures, rand.Float64())
+			failures++
+
+			logger.Errorf("Unable to read shard %s for Event Source %s (attempt %d), retrying in %v: %v", shardId,
+				c.eventSource.UUID, failures, delay, err)
+			c.m.pollers.SetProblem(c.status, fmt.Sprintf("PROBLEM: Unable to read stream %s: %v",
+				c.stream.name(), err))
+
+			if !poller.Sleep(ctx, delay) {
+				return
+			}
+			continue
+		}
+
+		if failures > 0 {
+			logger.Infof("Reading shard %s for Event Source %s recovered after %d failures", shardId,
+				c.eventSource.UUID, failures)
+			c.m.pollers.SetProblem(c.status, "")
+			failures = 0
+		}
+
+		if len(batch) == 0 && len(records) > 0 {
+			deadline = time.Now().Add(window)
+		}
+		batch = append(batch, records...)
+		iterator = next
+
+		if len(batch) > 0 && (iterator == nil || window == 0 || int32(len(batch)) >= c.eventSource.BatchSize ||
+			!time.Now().Before(deadline)) {
+
+			if !c.process(ctx, shardId, batch) {
+				return
+			}
+
+			p.after = batch[len(batch)-1].SequenceNumber
+			batch = nil
+		}
+
+		if iterator == nil {
+			logger.Infof("Finished reading closed shard %s for Event Source %s", shardId, c.eventSource.UUID)
+			c.checkpoint(domain.Checkpoint{ShardId: shardId, SequenceNumber: p.after, Closed: true})
+			return
+		}
+
+		if len(records) == 0 && !poller.Sleep(ctx, readInterval) {
+			return
+		}
+	}
+}
+
+// process invokes the Function with the batch of records until it succeeds, or the records are discarded because
+// they are too old or have been retried too many times, and then checkpoints the shard, returning false if the
+// context is cancelled first. When the Function reports batch item failures, the shard is checkpointed before the
+// first failure & only the records from it onwards are retried. With BisectBatchOnFunctionError, records that fail
+// are split into two batches that are retried separately, which doesn't count as a retry. Records that don't match
+// the filter criteria are skipped without invoking the Function.
+func (c *consumer) process(ctx context.Context, shardId string, records []Record) bool {
+	logger.Infof("Read %d records from shard %s for Event Source %s", len(records), shardId, c.eventSource.UUID)
+
+	last := records[len(records)-1].SequenceNumber
+
+	// batches that still need to be invoked, in order
+	var batches [][]Record
+	if records = c.filter(records); len(records) > 0 {
+		batches = append(batches, records)
+	}
+
+	// attempts is how many times the first batch has been invoked, while failures determines the backoff
+	attempts, failures := 0, 0
+	for len(batches) > 0 {
+		batch := batches[0]
+		retry, output, err := c.invoke(batch)
+		attempts++
+
+		if processed := len(batch) - len(retry); processed > 0 {
+			c.checkpoint(domain.Checkpoint{ShardId: shardId, SequenceNumber: batch[processed-1].SequenceNumber})
+		}
+
+		if len(retry) == 0 {
+			c.m.pollers.SetResult(c.status, poller.ResultOk)
+			batches, attempts = batches[1:], 0
+			continue
+		}
+
+		c.m.pollers.SetResult(c.status, poller.ResultFunctionFailed)
+
+		if c.eventSource.BisectBatchOnFunctionError && len(retry) > 1 {
+			half := len(retry) / 2
+			logger.Infof("Splitting %d failed records from shard %s into batches of %d & %d: %v", len(retry),
+				shardId, half, len(retry)-half, err)
+			batches, attempts = append([][]Record{retry[:half], retry[half:]}, batches[1:]...), 0
+			continue
+		}
+
+		if retry = c.discard(shardId, retry, attempts, output); len(retry) == 0 {
+			batches, attempts = batches[1:], 0
+			continue
+		}
+		batches[0] = retry
+
+		delay := poller.Backoff(failures, rand.Float64())
+		failures++
+
+		logger.Errorf("Retrying %d records from shard %s in %v (attempt %d): %v", len(retry), shardId, delay,
+			failures, err)
+
+		if !poller.Sleep(ctx, delay) {
+			return false
+		}
+	}
+
+	c.checkpoint(domain.Checkpoint{ShardId: shardId, SequenceNumber: last})
+	return true
+}
+
+// discard returns the records that can still be retried after the Function was invoked with them attempts times. The
+// ones that are older than the maximum record age, followed by the rest if the retry attempts are exhausted, are sent
+// to the OnFailure destination & checkpointed after, since they won't be retried.
+func (c *consumer) discard(shardId string, records []Record, attempts int, output *lambda.InvokeOutput) []Record {
+	maxAge := MaximumAge(c.eventSource, c.stream.retention())
+
+	expired := 0
+	for expired < len(records) && Expired(records[expired], maxAge, time.Now()) {
+		expired++
+	}
+
+	if expired > 0 {
+		logger.Errorf("Discarding %d records from shard %s that are older than %v", expired, shardId, maxAge)
+		c.onFailure(shardId, records[:expired], poller.ConditionRecordAgeExceeded, attempts, output)
+		records = records[expired:]
+	}
+
+	retries := c.eventSource.MaximumRetryAttempts
+	if len(records) > 0 && retries >= 0 && attempts > int(retries) {
+		logger.Errorf("Discarding %d records from shard %s after %d retries", len(records), shardId, retries)
+		c.onFailure(shardId, records, poller.ConditionRetryAttemptsExhausted, attempts, output)
+		return nil
+	}
+
+	return records
+}
+
+// onFailure sends a FailureRecord for the discarded records to the OnFailure destination, if there is one, and then
+// checkpoints the shard after them. Records that can't be sent are still discarded, so that they don't block the shard.
+func (c *consumer) onFailure(shardId string, records []Record, condition string, attempts int,
+	output *lambda.InvokeOutput) {
+
+	defer c.checkpoint(domain.Checkpoint{ShardId: shardId, SequenceNumber: records[len(records)-1].SequenceNumber})
+
+	destination := c.eventSource.OnFailure
+	if destination == "" {
+		return
+	}
+
+	functionArn := *c.eventSource.Function.GetArn(c.m.cfg)
+	record := poller.NewFailureRecord(functionArn, condition, attempts, output, time.Now())
+	payload, err := json.Marshal(NewFailureRecord(record, c.eventSource.Arn, shardId, records))
+	if err != nil {
+		logger.Errorf("Unable to marshal failure record for %d records of shard %s: %v", len(records), shardId, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkpointTimeout)
+	defer cancel()
+
+	err = c.m.sqs.SendMessage(ctx, destination, payload, nil)
+	if err != nil {
+		logger.Errorf("Unable to send %d discarded records of shard %s to %s: %v", len(records), shardId,
+			destination, err)
+		return
+	}
+
+	logger.Infof("Sent %s record for %d records of shard %s to %s", condition, len(records), shardId, destination)
+}
+
+// MaximumAge is how long records are retried for, which is the retention period of the stream unless the Event
+// Source has a lower MaximumRecordAgeInSeconds.
+func MaximumAge(eventSource *domain.EventSource, retention time.Duration) time.Duration {
+	maxAge := time.Duration(eventSource.MaximumRecordAgeInSeconds) * time.Second
+	if maxAge < 0 || maxAge > retention {
+		return retention
+	}
+
+	return maxAge
+}
+
+// Expired is true when the record was added to the stream longer than the retention period ago. Records without an
+// arrival time never expire.
+func Expired(record Record, retention time.Duration, now time.Time) bool {
+	return !record.Arrival.IsZero() && !now.Before(record.Arrival.Add(retention))
+}
+
+// invoke calls the Function with the records & returns the ones that need to be retried, along with the output of
+// the invocation, if there is one, and why they need to be retried.
+func (c *consumer) invoke(records []Record) ([]Record, *lambda.InvokeOutput, error) {
+	payload, err := json.Marshal(NewEvent(records))
+	if err != nil {
+		return records, nil, fmt.Errorf("unable to marshal %d records to bytes: %v", len(records), err)
+	}
+
+	// Event Sources bound to an Alias or published version invoke it rather than $LATEST
+	function := c.eventSource.InvokedName()
+	output, err := c.m.lambda.InvokeOutput(&function, payload)
+	if err != nil {
+		return records, output, err
+	}
+
+	if !c.eventSource.ReportsBatchItemFailures() {
+		return nil, output, nil
+	}
+
+	retry, err := RetryFrom(records, output.Payload)
+	if len(retry) > 0 && err == nil {
+		err = fmt.Errorf("function reported %s as failed", retry[0].SequenceNumber)
+	}
+
+	return retry, output, err
+}
+
+func (c *consumer) filter(records []Record) []Record {
+	if c.criteria == nil {
+		return records
+	}
+
+	results := make([]Record, 0, len(records))
+	for _, record := range records {
+		fields, err := c.stream.fields(record)
+		if err != nil {
+			logger.Errorf("Unable to evaluate filter criteria for record %s: %v", record.SequenceNumber, err)
+			results = append(results, record)
+			continue
+		}
+
+		if c.criteria.Matches(fields) {
+			results = append(results, record)
+		}
+	}
+
+	if len(results) < len(records) {
+		logger.Infof("Skipping %d records that don't match filter criteria", len(records)-len(results))
+	}
+
+	return results
+}
+
+// checkpoint saves the position in the shard, which isn't cancelled along with the Event Source since the records
+// before it have already been processed.
+func (c *consumer) checkpoint(checkpoint domain.Checkpoint) {
+	ctx, cancel := context.WithTimeout(context.Background(), checkpointTimeout)
+	defer cancel()
+
+	err := c.m.eventRepo.PutCheckpoint(ctx, c.eventSource.UUID.String(), checkpoint)
+	if err != nil {
+		logger.Errorf("Records of shard %s may be processed again: %v", checkpoint.ShardId, err)
+	}
+}
+
+// RetryFrom returns the records from the first one that the Function reported as failed in its response, since
+// records in a shard are processed in order. Nothing is returned when all succeeded, while an error is returned if
+// the response is invalid or only refers to unknown records, in which case the whole batch is retried.
+func RetryFrom(records []Record, payload []byte) ([]Record, error) {
+	failed, err := poller.FailedItems(payload)
+	if err != nil {
+		return records, err
+	}
+
+	if len(failed) == 0 {
+		return nil, nil
+	}
+
+	for i, record := range records {
+		if failed[record.SequenceNumber] {
+			return records[i:], nil
+		}
+	}
+
+	return records, fmt.Errorf("unknown itemIdentifier in batch response %s", payload)
+}
@@ -0,0 +1,62 @@
+package stream_test
+
+import (
+	"github.com/ATenderholt/rainbow-functions/internal/stream"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func records(sequenceNumbers ...string) []stream.Record {
+	results := make([]stream.Record, len(sequenceNumbers))
+	for i, sequenceNumber := range sequenceNumbers {
+		results[i] = stream.Record{SequenceNumber: sequenceNumber}
+	}
+
+	return results
+}
+
+func TestRetryFromNothingWhenAllSucceed(t *testing.T) {
+	batch := records("1", "2", "3")
+
+	for _, response := range []string{``, `null`, `{}`, `{"batchItemFailures": []}`} {
+		retry, err := stream.RetryFrom(batch, []byte(response))
+		assert.NoError(t, err, response)
+		assert.Empty(t, retry, response)
+	}
+}
+
+func TestRetryFromFirstFailure(t *testing.T) {
+	batch := records("1", "2", "3", "4")
+	response := `{"batchItemFailures": [{"itemIdentifier": "4"}, {"itemIdentifier": "2"}]}`
+
+	retry, err := stream.RetryFrom(batch, []byte(response))
+	assert.NoError(t, err)
+	assert.Equal(t, records("2", "3", "4"), retry)
+}
+
+func TestRetryFromInvalidResponse(t *testing.T) {
+	batch := records("1", "2")
+
+	responses := []string{
+		`not json`,
+		`{"batchItemFailures": [{}]}`,
+		`{"batchItemFailures": [{"itemIdentifier": "5"}]}`,
+	}
+
+	for _, response := range responses {
+		retry, err := stream.RetryFrom(batch, []byte(response))
+		assert.Error(t, err, response)
+		assert.Equal(t, batch, retry, response)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Now()
+	retention := 24 * time.Hour
+
+	assert.False(t, stream.Expired(stream.Record{Arrival: now.Add(-time.Hour)}, retention, now))
+	assert.True(t, stream.Expired(stream.Record{Arrival: now.Add(-retention)}, retention, now))
+	assert.True(t, stream.Expired(stream.Record{Arrival: now.Add(-48 * time.Hour)}, retention, now))
+	assert.False(t, stream.Expired(stream.Record{}, retention, now))
+}
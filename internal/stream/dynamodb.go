@@ -0,0 +1,275 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"strings"
+	"time"
+)
+
+// DynamoDBRecord is the record that Lambda sends to Functions for each change to a DynamoDB table
+type DynamoDBRecord struct {
+	EventID        string               `json:"eventID"`
+	EventName      string               `json:"eventName"`
+	EventVersion   string               `json:"eventVersion"`
+	EventSource    string               `json:"eventSource"`
+	AwsRegion      string               `json:"awsRegion"`
+	Dynamodb       DynamoDBStreamRecord `json:"dynamodb"`
+	UserIdentity   *DynamoDBIdentity    `json:"userIdentity,omitempty"`
+	EventSourceARN string               `json:"eventSourceARN"`
+}
+
+// DynamoDBStreamRecord has the keys & images of the changed item, whose attributes are in DynamoDB's JSON format
+type DynamoDBStreamRecord struct {
+	// seconds since the epoch
+	ApproximateCreationDateTime int64 `json:"ApproximateCreationDateTime,omitempty"`
+
+	Keys           map[string]interface{} `json:"Keys,omitempty"`
+	NewImage       map[string]interface{} `json:"NewImage,omitempty"`
+	OldImage       map[string]interface{} `json:"OldImage,omitempty"`
+	SequenceNumber string                 `json:"SequenceNumber"`
+	SizeBytes      int64                  `json:"SizeBytes"`
+	StreamViewType string                 `json:"StreamViewType"`
+}
+
+// DynamoDBIdentity is included for items that were deleted by Time To Live
+type DynamoDBIdentity struct {
+	PrincipalId string `json:"principalId"`
+	Type        string `json:"type"`
+}
+
+// NewDynamoDBRecord creates the DynamoDBRecord for a record read from the stream with the specified ARN.
+func NewDynamoDBRecord(arn string, record types.Record) DynamoDBRecord {
+	region := aws.ToString(record.AwsRegion)
+	if parts := strings.Split(arn, ":"); region == "" && len(parts) > 3 {
+		region = parts[3]
+	}
+
+	result := DynamoDBRecord{
+		EventID:        aws.ToString(record.EventID),
+		EventName:      string(record.EventName),
+		EventVersion:   aws.ToString(record.EventVersion),
+		EventSource:    "aws:dynamodb",
+		AwsRegion:      region,
+		EventSourceARN: arn,
+	}
+
+	if record.Dynamodb != nil {
+		result.Dynamodb = DynamoDBStreamRecord{
+			Keys:           attributeValues(record.Dynamodb.Keys),
+			NewImage:       attributeValues(record.Dynamodb.NewImage),
+			OldImage:       attributeValues(record.Dynamodb.OldImage),
+			SequenceNumber: aws.ToString(record.Dynamodb.SequenceNumber),
+			SizeBytes:      aws.ToInt64(record.Dynamodb.SizeBytes),
+			StreamViewType: string(record.Dynamodb.StreamViewType),
+		}
+
+		if record.Dynamodb.ApproximateCreationDateTime != nil {
+			result.Dynamodb.ApproximateCreationDateTime = record.Dynamodb.ApproximateCreationDateTime.Unix()
+		}
+	}
+
+	if record.UserIdentity != nil {
+		result.UserIdentity = &DynamoDBIdentity{
+			PrincipalId: aws.ToString(record.UserIdentity.PrincipalId),
+			Type:        aws.ToString(record.UserIdentity.Type),
+		}
+	}
+
+	return result
+}
+
+func attributeValues(values map[string]types.AttributeValue) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+
+	results := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		results[name] = attributeValue(value)
+	}
+
+	return results
+}
+
+// attributeValue converts the value to DynamoDB's JSON format, such as {"S": "value"}.
+func attributeValue(value types.AttributeValue) map[string]interface{} {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]interface{}{"S": v.Value}
+	case *types.AttributeValueMemberN:
+		return map[string]interface{}{"N": v.Value}
+	case *types.AttributeValueMemberB:
+		return map[string]interface{}{"B": v.Value}
+	case *types.AttributeValueMemberBOOL:
+		return map[string]interface{}{"BOOL": v.Value}
+	case *types.AttributeValueMemberNULL:
+		return map[string]interface{}{"NULL": v.Value}
+	case *types.AttributeValueMemberSS:
+		return map[string]interface{}{"SS": v.Value}
+	case *types.AttributeValueMemberNS:
+		return map[string]interface{}{"NS": v.Value}
+	case *types.AttributeValueMemberBS:
+		return map[string]interface{}{"BS": v.Value}
+	case *types.AttributeValueMemberL:
+		values := make([]interface{}, len(v.Value))
+		for i, item := range v.Value {
+			values[i] = attributeValue(item)
+		}
+		return map[string]interface{}{"L": values}
+	case *types.AttributeValueMemberM:
+		return map[string]interface{}{"M": attributeValues(v.Value)}
+	default:
+		logger.Warnf("Unknown attribute value type %T", value)
+		return map[string]interface{}{}
+	}
+}
+
+// dynamoDBStream reads a DynamoDB stream from the configured endpoint, which is typically DynamoDB Local.
+type dynamoDBStream struct {
+	arn    string
+	client *dynamodbstreams.Client
+}
+
+func (m *Manager) newDynamoDBStream(eventSource *domain.EventSource) *dynamoDBStream {
+	region := m.cfg.Region
+	if parts := strings.Split(eventSource.Arn, ":"); len(parts) > 3 && parts[3] != "" {
+		region = parts[3]
+	}
+
+	client := dynamodbstreams.NewFromConfig(aws.Config{
+		Region:                      region,
+		Credentials:                 poller.Credentials,
+		EndpointResolverWithOptions: poller.EndpointResolver(m.cfg.DynamoDbEndpoint),
+		ClientLogMode:               0,
+		DefaultsMode:                "",
+		RuntimeEnvironment:          aws.RuntimeEnvironment{},
+	})
+
+	return &dynamoDBStream{arn: eventSource.Arn, client: client}
+}
+
+func (d *dynamoDBStream) name() string {
+	return d.arn
+}
+
+func (d *dynamoDBStream) shards(ctx context.Context) ([]Shard, error) {
+	var results []Shard
+	var start *string
+
+	for {
+		output, err := d.client.DescribeStream(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             &d.arn,
+			ExclusiveStartShardId: start,
+			Limit:                 nil,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to describe stream %s: %v", d.arn, err)
+		}
+
+		description := output.StreamDescription
+		for _, shard := range description.Shards {
+			result := Shard{Id: aws.ToString(shard.ShardId)}
+			if shard.ParentShardId != nil {
+				result.Parents = append(result.Parents, *shard.ParentShardId)
+			}
+
+			results = append(results, result)
+		}
+
+		if description.LastEvaluatedShardId == nil {
+			return results, nil
+		}
+
+		start = description.LastEvaluatedShardId
+	}
+}
+
+func (d *dynamoDBStream) iterator(ctx context.Context, shardId string, p position) (*string, error) {
+	input := dynamodbstreams.GetShardIteratorInput{
+		ShardId:   &shardId,
+		StreamArn: &d.arn,
+	}
+
+	switch {
+	case p.after != "":
+		input.ShardIteratorType = types.ShardIteratorTypeAfterSequenceNumber
+		input.SequenceNumber = &p.after
+	case p.startingPosition == lambdatypes.EventSourcePositionTrimHorizon:
+		input.ShardIteratorType = types.ShardIteratorTypeTrimHorizon
+	default:
+		input.ShardIteratorType = types.ShardIteratorTypeLatest
+	}
+
+	output, err := d.client.GetShardIterator(ctx, &input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get iterator for shard %s: %w", shardId, err)
+	}
+
+	return output.ShardIterator, nil
+}
+
+func (d *dynamoDBStream) records(ctx context.Context, shardId string, iterator *string,
+	limit int32) ([]Record, *string, error) {
+
+	// DynamoDB returns at most 1000 records per request
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	output, err := d.client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+		ShardIterator: iterator,
+		Limit:         &limit,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get records: %w", err)
+	}
+
+	results := make([]Record, len(output.Records))
+	for i, record := range output.Records {
+		result := Record{Event: NewDynamoDBRecord(d.arn, record)}
+		if record.Dynamodb != nil {
+			result.SequenceNumber = aws.ToString(record.Dynamodb.SequenceNumber)
+			result.Arrival = aws.ToTime(record.Dynamodb.ApproximateCreationDateTime)
+		}
+
+		results[i] = result
+	}
+
+	return results, output.NextShardIterator, nil
+}
+
+// fields are those of the whole record, since filter criteria for DynamoDB match against its eventName & images.
+func (d *dynamoDBStream) fields(record Record) (map[string]interface{}, error) {
+	value, err := json.Marshal(record.Event)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(value, &fields)
+	return fields, err
+}
+
+func (d *dynamoDBStream) expired(err error) bool {
+	var expired *types.ExpiredIteratorException
+	return errors.As(err, &expired)
+}
+
+func (d *dynamoDBStream) trimmed(err error) bool {
+	var trimmed *types.TrimmedDataAccessException
+	return errors.As(err, &trimmed)
+}
+
+// retention is always 24 hours, which DynamoDB doesn't allow to be changed.
+func (d *dynamoDBStream) retention() time.Duration {
+	return defaultRetention
+}
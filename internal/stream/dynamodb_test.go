@@ -0,0 +1,106 @@
+package stream_test
+
+import (
+	"encoding/json"
+	"github.com/ATenderholt/rainbow-functions/internal/stream"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const tableStreamArn = "arn:aws:dynamodb:us-east-1:123456789012:table/orders/stream/2022-03-01T00:00:00.000"
+
+func TestNewDynamoDBRecord(t *testing.T) {
+	created := time.Unix(1479499740, 0)
+	record := types.Record{
+		AwsRegion: aws.String("us-east-1"),
+		Dynamodb: &types.StreamRecord{
+			ApproximateCreationDateTime: &created,
+			Keys: map[string]types.AttributeValue{
+				"Id": &types.AttributeValueMemberN{Value: "101"},
+			},
+			NewImage: map[string]types.AttributeValue{
+				"Id":      &types.AttributeValueMemberN{Value: "101"},
+				"Message": &types.AttributeValueMemberS{Value: "New item!"},
+				"Paid":    &types.AttributeValueMemberBOOL{Value: true},
+				"Tags":    &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+				"Lines": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+					&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+						"Sku": &types.AttributeValueMemberS{Value: "X1"},
+					}},
+					&types.AttributeValueMemberNULL{Value: true},
+				}},
+				"Data": &types.AttributeValueMemberB{Value: []byte("hi")},
+			},
+			SequenceNumber: aws.String("111"),
+			SizeBytes:      aws.Int64(26),
+			StreamViewType: types.StreamViewTypeNewAndOldImages,
+		},
+		EventID:      aws.String("1"),
+		EventName:    types.OperationTypeInsert,
+		EventSource:  aws.String("aws:dynamodb"),
+		EventVersion: aws.String("1.0"),
+	}
+
+	result := stream.NewDynamoDBRecord(tableStreamArn, record)
+
+	expected := `{
+		"eventID": "1",
+		"eventName": "INSERT",
+		"eventVersion": "1.0",
+		"eventSource": "aws:dynamodb",
+		"awsRegion": "us-east-1",
+		"dynamodb": {
+			"ApproximateCreationDateTime": 1479499740,
+			"Keys": {"Id": {"N": "101"}},
+			"NewImage": {
+				"Id": {"N": "101"},
+				"Message": {"S": "New item!"},
+				"Paid": {"BOOL": true},
+				"Tags": {"SS": ["a", "b"]},
+				"Lines": {"L": [{"M": {"Sku": {"S": "X1"}}}, {"NULL": true}]},
+				"Data": {"B": "aGk="}
+			},
+			"SequenceNumber": "111",
+			"SizeBytes": 26,
+			"StreamViewType": "NEW_AND_OLD_IMAGES"
+		},
+		"eventSourceARN": "arn:aws:dynamodb:us-east-1:123456789012:table/orders/stream/2022-03-01T00:00:00.000"
+	}`
+
+	actual, err := json.Marshal(result)
+	assert.NoError(t, err)
+	assert.JSONEq(t, expected, string(actual))
+}
+
+func TestNewDynamoDBRecordRemove(t *testing.T) {
+	record := types.Record{
+		Dynamodb: &types.StreamRecord{
+			Keys: map[string]types.AttributeValue{
+				"Id": &types.AttributeValueMemberN{Value: "101"},
+			},
+			OldImage: map[string]types.AttributeValue{
+				"Id": &types.AttributeValueMemberN{Value: "101"},
+			},
+			SequenceNumber: aws.String("222"),
+			StreamViewType: types.StreamViewTypeOldImage,
+		},
+		EventName: types.OperationTypeRemove,
+		UserIdentity: &types.Identity{
+			PrincipalId: aws.String("dynamodb.amazonaws.com"),
+			Type:        aws.String("Service"),
+		},
+	}
+
+	result := stream.NewDynamoDBRecord(tableStreamArn, record)
+
+	assert.Equal(t, "REMOVE", result.EventName)
+	assert.Equal(t, "us-east-1", result.AwsRegion)
+	assert.Equal(t, "aws:dynamodb", result.EventSource)
+	assert.Nil(t, result.Dynamodb.NewImage)
+	assert.Equal(t, map[string]interface{}{"Id": map[string]interface{}{"N": "101"}}, result.Dynamodb.OldImage)
+	assert.Equal(t, &stream.DynamoDBIdentity{PrincipalId: "dynamodb.amazonaws.com", Type: "Service"},
+		result.UserIdentity)
+}
@@ -0,0 +1,57 @@
+package stream
+
+import (
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"strings"
+)
+
+// BatchInfo describes a batch of records from a shard that was discarded, rather than including the records
+// themselves since they can be read from the stream until they expire
+type BatchInfo struct {
+	ShardId                         string `json:"shardId"`
+	StartSequenceNumber             string `json:"startSequenceNumber"`
+	EndSequenceNumber               string `json:"endSequenceNumber"`
+	ApproximateArrivalOfFirstRecord string `json:"approximateArrivalOfFirstRecord,omitempty"`
+	ApproximateArrivalOfLastRecord  string `json:"approximateArrivalOfLastRecord,omitempty"`
+	BatchSize                       int    `json:"batchSize"`
+	StreamArn                       string `json:"streamArn"`
+}
+
+// FailureRecord is sent to the OnFailure destination of an Event Source for discarded records, with the BatchInfo
+// under a field that depends on whether the stream is Kinesis or DynamoDB
+type FailureRecord struct {
+	poller.FailureRecord
+	KinesisBatchInfo   *BatchInfo `json:"KinesisBatchInfo,omitempty"`
+	DDBStreamBatchInfo *BatchInfo `json:"DDBStreamBatchInfo,omitempty"`
+}
+
+// NewFailureRecord adds the BatchInfo of the records, which were read from the shard of the stream with the ARN, to
+// the record.
+func NewFailureRecord(record poller.FailureRecord, arn string, shardId string, records []Record) FailureRecord {
+	first, last := records[0], records[len(records)-1]
+
+	info := BatchInfo{
+		ShardId:             shardId,
+		StartSequenceNumber: first.SequenceNumber,
+		EndSequenceNumber:   last.SequenceNumber,
+		BatchSize:           len(records),
+		StreamArn:           arn,
+	}
+
+	if !first.Arrival.IsZero() {
+		info.ApproximateArrivalOfFirstRecord = poller.Timestamp(first.Arrival)
+	}
+
+	if !last.Arrival.IsZero() {
+		info.ApproximateArrivalOfLastRecord = poller.Timestamp(last.Arrival)
+	}
+
+	result := FailureRecord{FailureRecord: record}
+	if strings.Contains(arn, ":dynamodb:") {
+		result.DDBStreamBatchInfo = &info
+	} else {
+		result.KinesisBatchInfo = &info
+	}
+
+	return result
+}
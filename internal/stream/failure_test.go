@@ -0,0 +1,71 @@
+package stream_test
+
+import (
+	"encoding/json"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/ATenderholt/rainbow-functions/internal/stream"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewFailureRecordKinesis(t *testing.T) {
+	arn := "arn:aws:kinesis:us-west-2:123456789012:stream/my-stream"
+	first := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	batch := []stream.Record{
+		{SequenceNumber: "1", Arrival: first},
+		{SequenceNumber: "2"},
+		{SequenceNumber: "3", Arrival: first.Add(time.Second)},
+	}
+	record := poller.NewFailureRecord("arn:aws:lambda:us-west-2:123456789012:function:fn",
+		poller.ConditionRecordAgeExceeded, 2, nil, first)
+
+	result := stream.NewFailureRecord(record, arn, "shardId-000000000000", batch)
+
+	assert.Nil(t, result.DDBStreamBatchInfo)
+	assert.Equal(t, &stream.BatchInfo{
+		ShardId:                         "shardId-000000000000",
+		StartSequenceNumber:             "1",
+		EndSequenceNumber:               "3",
+		ApproximateArrivalOfFirstRecord: "2022-03-04T05:06:07.000Z",
+		ApproximateArrivalOfLastRecord:  "2022-03-04T05:06:08.000Z",
+		BatchSize:                       3,
+		StreamArn:                       arn,
+	}, result.KinesisBatchInfo)
+
+	payload, err := json.Marshal(result)
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(payload, &decoded))
+	assert.Equal(t, "1.0", decoded["version"])
+	assert.Equal(t, "2022-03-04T05:06:07.000Z", decoded["timestamp"])
+	assert.Contains(t, decoded, "KinesisBatchInfo")
+	assert.NotContains(t, decoded, "DDBStreamBatchInfo")
+	assert.NotContains(t, decoded, "responseContext")
+}
+
+func TestNewFailureRecordDynamoDB(t *testing.T) {
+	arn := "arn:aws:dynamodb:us-west-2:123456789012:table/my-table/stream/2022-03-04T05:06:07.000"
+	record := poller.NewFailureRecord("fn", poller.ConditionRetryAttemptsExhausted, 1, nil, time.Now())
+
+	result := stream.NewFailureRecord(record, arn, "shardId-1", records("1"))
+
+	assert.Nil(t, result.KinesisBatchInfo)
+	assert.Equal(t, "1", result.DDBStreamBatchInfo.EndSequenceNumber)
+	assert.Equal(t, "", result.DDBStreamBatchInfo.ApproximateArrivalOfFirstRecord)
+}
+
+func TestMaximumAge(t *testing.T) {
+	retention := 24 * time.Hour
+
+	unlimited := domain.EventSource{MaximumRecordAgeInSeconds: -1}
+	assert.Equal(t, retention, stream.MaximumAge(&unlimited, retention))
+
+	limited := domain.EventSource{MaximumRecordAgeInSeconds: 60}
+	assert.Equal(t, time.Minute, stream.MaximumAge(&limited, retention))
+
+	longer := domain.EventSource{MaximumRecordAgeInSeconds: 604800}
+	assert.Equal(t, retention, stream.MaximumAge(&longer, retention))
+}
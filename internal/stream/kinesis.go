@@ -0,0 +1,248 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KinesisRecord is the record that Lambda sends to Functions for each record of a Kinesis stream
+type KinesisRecord struct {
+	Kinesis           KinesisData `json:"kinesis"`
+	EventSource       string      `json:"eventSource"`
+	EventVersion      string      `json:"eventVersion"`
+	EventID           string      `json:"eventID"`
+	EventName         string      `json:"eventName"`
+	InvokeIdentityArn string      `json:"invokeIdentityArn"`
+	AwsRegion         string      `json:"awsRegion"`
+	EventSourceARN    string      `json:"eventSourceARN"`
+}
+
+type KinesisData struct {
+	KinesisSchemaVersion string `json:"kinesisSchemaVersion"`
+	PartitionKey         string `json:"partitionKey"`
+	SequenceNumber       string `json:"sequenceNumber"`
+
+	// base64 encoded when marshalled
+	Data []byte `json:"data"`
+
+	// seconds since the epoch, with millisecond precision
+	ApproximateArrivalTimestamp float64 `json:"approximateArrivalTimestamp"`
+}
+
+// NewKinesisRecord creates the KinesisRecord for a record read from the shard of the stream with the specified ARN.
+func NewKinesisRecord(arn string, role string, shardId string, record types.Record) KinesisRecord {
+	region := ""
+	if parts := strings.Split(arn, ":"); len(parts) > 3 {
+		region = parts[3]
+	}
+
+	var arrival float64
+	if record.ApproximateArrivalTimestamp != nil {
+		arrival = float64(record.ApproximateArrivalTimestamp.UnixMilli()) / 1000
+	}
+
+	sequenceNumber := aws.ToString(record.SequenceNumber)
+
+	return KinesisRecord{
+		Kinesis: KinesisData{
+			KinesisSchemaVersion:        "1.0",
+			PartitionKey:                aws.ToString(record.PartitionKey),
+			SequenceNumber:              sequenceNumber,
+			Data:                        record.Data,
+			ApproximateArrivalTimestamp: arrival,
+		},
+		EventSource:       "aws:kinesis",
+		EventVersion:      "1.0",
+		EventID:           shardId + ":" + sequenceNumber,
+		EventName:         "aws:kinesis:record",
+		InvokeIdentityArn: role,
+		AwsRegion:         region,
+		EventSourceARN:    arn,
+	}
+}
+
+// kinesisStream reads a Kinesis stream from the configured endpoint, which is typically kinesalite or similar.
+type kinesisStream struct {
+	arn        string
+	streamName string
+	role       string
+	client     *kinesis.Client
+
+	// retention period of the stream when it was last described, guarded by lock since shards are read concurrently
+	retentionPeriod time.Duration
+	lock            sync.Mutex
+}
+
+func (m *Manager) newKinesisStream(eventSource *domain.EventSource) *kinesisStream {
+	s := kinesisStream{
+		arn:             eventSource.Arn,
+		streamName:      eventSource.Arn,
+		role:            eventSource.Function.Role,
+		retentionPeriod: defaultRetention,
+	}
+
+	region := m.cfg.Region
+	if parts := strings.Split(eventSource.Arn, ":"); len(parts) > 5 {
+		s.streamName = strings.TrimPrefix(parts[5], "stream/")
+		if parts[3] != "" {
+			region = parts[3]
+		}
+	}
+
+	s.client = kinesis.NewFromConfig(aws.Config{
+		Region:                      region,
+		Credentials:                 poller.Credentials,
+		EndpointResolverWithOptions: poller.EndpointResolver(m.cfg.KinesisEndpoint),
+		ClientLogMode:               0,
+		DefaultsMode:                "",
+		RuntimeEnvironment:          aws.RuntimeEnvironment{},
+	})
+
+	return &s
+}
+
+func (k *kinesisStream) name() string {
+	return k.streamName
+}
+
+// shards are described rather than listed, since not all local implementations support ListShards.
+func (k *kinesisStream) shards(ctx context.Context) ([]Shard, error) {
+	var results []Shard
+	var start *string
+
+	for {
+		output, err := k.client.DescribeStream(ctx, &kinesis.DescribeStreamInput{
+			StreamName:            &k.streamName,
+			ExclusiveStartShardId: start,
+			Limit:                 nil,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to describe stream %s: %v", k.streamName, err)
+		}
+
+		description := output.StreamDescription
+		if description.RetentionPeriodHours != nil {
+			k.lock.Lock()
+			k.retentionPeriod = time.Duration(*description.RetentionPeriodHours) * time.Hour
+			k.lock.Unlock()
+		}
+
+		for _, shard := range description.Shards {
+			result := Shard{Id: aws.ToString(shard.ShardId)}
+			if shard.ParentShardId != nil {
+				result.Parents = append(result.Parents, *shard.ParentShardId)
+			}
+			if shard.AdjacentParentShardId != nil {
+				result.Parents = append(result.Parents, *shard.AdjacentParentShardId)
+			}
+
+			results = append(results, result)
+		}
+
+		if !aws.ToBool(description.HasMoreShards) || len(description.Shards) == 0 {
+			return results, nil
+		}
+
+		start = description.Shards[len(description.Shards)-1].ShardId
+	}
+}
+
+func (k *kinesisStream) iterator(ctx context.Context, shardId string, p position) (*string, error) {
+	input := kinesis.GetShardIteratorInput{
+		ShardId:    &shardId,
+		StreamName: &k.streamName,
+	}
+
+	switch {
+	case p.after != "":
+		input.ShardIteratorType = types.ShardIteratorTypeAfterSequenceNumber
+		input.StartingSequenceNumber = &p.after
+	case p.startingPosition == lambdatypes.EventSourcePositionAtTimestamp:
+		input.ShardIteratorType = types.ShardIteratorTypeAtTimestamp
+		input.Timestamp = p.timestamp
+	case p.startingPosition == lambdatypes.EventSourcePositionTrimHorizon:
+		input.ShardIteratorType = types.ShardIteratorTypeTrimHorizon
+	default:
+		input.ShardIteratorType = types.ShardIteratorTypeLatest
+	}
+
+	output, err := k.client.GetShardIterator(ctx, &input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get iterator for shard %s: %w", shardId, err)
+	}
+
+	return output.ShardIterator, nil
+}
+
+func (k *kinesisStream) records(ctx context.Context, shardId string, iterator *string,
+	limit int32) ([]Record, *string, error) {
+	output, err := k.client.GetRecords(ctx, &kinesis.GetRecordsInput{
+		ShardIterator: iterator,
+		Limit:         &limit,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get records: %w", err)
+	}
+
+	results := make([]Record, len(output.Records))
+	for i, record := range output.Records {
+		results[i] = Record{
+			SequenceNumber: aws.ToString(record.SequenceNumber),
+			Event:          NewKinesisRecord(k.arn, k.role, shardId, record),
+			Arrival:        aws.ToTime(record.ApproximateArrivalTimestamp),
+		}
+	}
+
+	return results, output.NextShardIterator, nil
+}
+
+// fields are those of the record's kinesis object, like AWS, with its data as an object when it is valid JSON.
+func (k *kinesisStream) fields(record Record) (map[string]interface{}, error) {
+	kinesisData := record.Event.(KinesisRecord).Kinesis
+
+	value, err := json.Marshal(kinesisData)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(value, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var data interface{}
+	if json.Unmarshal(kinesisData.Data, &data) == nil {
+		fields["data"] = data
+	}
+
+	return fields, nil
+}
+
+func (k *kinesisStream) expired(err error) bool {
+	var expired *types.ExpiredIteratorException
+	return errors.As(err, &expired)
+}
+
+// trimmed is always false, since Kinesis reads from the oldest record instead of failing.
+func (k *kinesisStream) trimmed(err error) bool {
+	return false
+}
+
+func (k *kinesisStream) retention() time.Duration {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	return k.retentionPeriod
+}
@@ -0,0 +1,58 @@
+package stream_test
+
+import (
+	"encoding/json"
+	"github.com/ATenderholt/rainbow-functions/internal/stream"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const streamArn = "arn:aws:kinesis:us-east-2:123456789012:stream/my-stream"
+const role = "arn:aws:iam::123456789012:role/lambda-role"
+
+func TestNewKinesisRecord(t *testing.T) {
+	arrival := time.UnixMilli(1545084650987)
+	record := types.Record{
+		ApproximateArrivalTimestamp: &arrival,
+		Data:                        []byte("Hello, this is a test."),
+		PartitionKey:                aws.String("1"),
+		SequenceNumber:              aws.String("49590338271490256608559692538361571095921575989136588898"),
+	}
+
+	result := stream.NewKinesisRecord(streamArn, role, "shardId-000000000006", record)
+
+	expected := `{
+		"kinesis": {
+			"kinesisSchemaVersion": "1.0",
+			"partitionKey": "1",
+			"sequenceNumber": "49590338271490256608559692538361571095921575989136588898",
+			"data": "SGVsbG8sIHRoaXMgaXMgYSB0ZXN0Lg==",
+			"approximateArrivalTimestamp": 1545084650.987
+		},
+		"eventSource": "aws:kinesis",
+		"eventVersion": "1.0",
+		"eventID": "shardId-000000000006:49590338271490256608559692538361571095921575989136588898",
+		"eventName": "aws:kinesis:record",
+		"invokeIdentityArn": "arn:aws:iam::123456789012:role/lambda-role",
+		"awsRegion": "us-east-2",
+		"eventSourceARN": "arn:aws:kinesis:us-east-2:123456789012:stream/my-stream"
+	}`
+
+	actual, err := json.Marshal(result)
+	assert.NoError(t, err)
+	assert.JSONEq(t, expected, string(actual))
+}
+
+func TestNewEvent(t *testing.T) {
+	records := []stream.Record{
+		{SequenceNumber: "1", Event: map[string]string{"eventID": "a"}},
+		{SequenceNumber: "2", Event: map[string]string{"eventID": "b"}},
+	}
+
+	actual, err := json.Marshal(stream.NewEvent(records))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"Records": [{"eventID": "a"}, {"eventID": "b"}]}`, string(actual))
+}
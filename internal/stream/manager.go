@@ -0,0 +1,164 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ATenderholt/rainbow-functions/internal/domain"
+	"github.com/ATenderholt/rainbow-functions/internal/poller"
+	"github.com/ATenderholt/rainbow-functions/internal/sqs"
+	"github.com/ATenderholt/rainbow-functions/pkg/filter"
+	"github.com/ATenderholt/rainbow-functions/settings"
+	"github.com/google/uuid"
+)
+
+// Manager consumes Event Sources that are streams, which are read shard by shard & checkpointed in the database.
+type Manager struct {
+	cfg       *settings.Config
+	eventRepo domain.EventSourceRepository
+	pollers   *poller.Registry
+	lambda    *poller.Lambda
+
+	// sends discarded records to OnFailure destinations
+	sqs *sqs.Manager
+}
+
+func NewManager(cfg *settings.Config, eventRepo domain.EventSourceRepository, sqs *sqs.Manager) *Manager {
+	return &Manager{
+		cfg:       cfg,
+		eventRepo: eventRepo,
+		pollers:   poller.NewRegistry(),
+		lambda:    poller.NewLambda(cfg),
+		sqs:       sqs,
+	}
+}
+
+// CreateEventSource starts consumption for a newly created Event Source.
+func (m *Manager) CreateEventSource(ctx context.Context, eventSource *domain.EventSource) error {
+	return m.startEventSource(ctx, eventSource, poller.StateCreating)
+}
+
+// StartEventSource starts consumption for an existing Event Source that is being enabled.
+func (m *Manager) StartEventSource(ctx context.Context, eventSource *domain.EventSource) error {
+	return m.startEventSource(ctx, eventSource, poller.StateEnabling)
+}
+
+func (m *Manager) startEventSource(ctx context.Context, eventSource *domain.EventSource, state string) error {
+	st := m.pollers.NewStatus(eventSource.UUID, state)
+
+	s, err := m.newStream(eventSource)
+	if err != nil {
+		logger.Error(err)
+		m.pollers.SetState(st, poller.StateDisabled, "PROBLEM: "+err.Error())
+		return err
+	}
+
+	logger.Infof("Starting consumption from stream %s ...", s.name())
+
+	criteria, err := filter.NewCriteria(eventSource.FilterPatterns)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to parse filter criteria for Event Source %s: %v", eventSource.UUID, err)
+		logger.Error(msg)
+		m.pollers.SetState(st, poller.StateDisabled, "PROBLEM: "+msg)
+		return errors.New(msg)
+	}
+
+	c := consumer{
+		m:           m,
+		eventSource: eventSource,
+		stream:      s,
+		criteria:    criteria,
+		status:      st,
+	}
+
+	// shards are listed by the poller, so that it keeps retrying if the stream isn't available yet
+	m.pollers.Run(ctx, eventSource.UUID, st, c.consume)
+
+	return nil
+}
+
+func (m *Manager) newStream(eventSource *domain.EventSource) (stream, error) {
+	switch eventSource.Service() {
+	case "kinesis":
+		return m.newKinesisStream(eventSource), nil
+	case "dynamodb":
+		return m.newDynamoDBStream(eventSource), nil
+	default:
+		return nil, fmt.Errorf("event source %s is not a supported stream", eventSource.Arn)
+	}
+}
+
+// StopEventSource cancels consumption for the Event Source that is being disabled, if it is running.
+func (m *Manager) StopEventSource(id uuid.UUID) {
+	m.pollers.Stop(id, poller.StateDisabling)
+}
+
+// RemoveEventSource cancels consumption for the Event Source that is being deleted, if it is running.
+func (m *Manager) RemoveEventSource(id uuid.UUID) {
+	m.pollers.Stop(id, poller.StateDeleting)
+}
+
+// Describe sets the current state of the Event Source, as well as the reason for it & the result of the last poll.
+func (m *Manager) Describe(eventSource *domain.EventSource) {
+	m.pollers.Describe(eventSource)
+}
+
+// ShutdownAll stops consumption for all Event Sources, and waits for in-flight batches to finish until the context
+// is done.
+func (m *Manager) ShutdownAll(ctx context.Context) error {
+	return m.pollers.ShutdownAll(ctx)
+}
+
+// StartAllEventSources starts consumption for all enabled Event Sources that are streams.
+func (m *Manager) StartAllEventSources(ctx context.Context) error {
+	sources, err := m.eventRepo.GetAllEventSources(ctx)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to start All stream Event Sources: %v", err)
+		logger.Error(msg)
+		return errors.New(msg)
+	}
+
+	for i := range sources {
+		source := &sources[i]
+		if !source.IsStream() {
+			continue
+		}
+
+		if !source.Enabled {
+			logger.Infof("Event Source %s is disabled, so not starting it", source.UUID)
+			continue
+		}
+
+		err = m.StartEventSource(ctx, source)
+		if err != nil {
+			logger.Errorf("Unable to start Event Source %s", source.UUID)
+		}
+	}
+
+	return nil
+}
+
+// StopEventSourcesForFunction cancels consumption for all stream Event Sources of the named Function. If version
+// is non-empty, only Event Sources for that version of the Function are stopped.
+func (m *Manager) StopEventSourcesForFunction(ctx context.Context, name string, version string) error {
+	sources, err := m.eventRepo.GetAllEventSources(ctx)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to stop stream Event Sources for Function %s: %v", name, err)
+		logger.Error(msg)
+		return errors.New(msg)
+	}
+
+	for _, source := range sources {
+		if !source.IsStream() || source.Function.FunctionName != name {
+			continue
+		}
+
+		if version != "" && source.Function.Version != version {
+			continue
+		}
+
+		m.RemoveEventSource(source.UUID)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package stream
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"time"
+)
+
+// how long records are kept in streams that don't say otherwise, which is the default for both Kinesis & DynamoDB
+const defaultRetention = 24 * time.Hour
+
+// Shard of a stream, whose records are read in order
+type Shard struct {
+	Id string
+
+	// shards that were split or merged into this one, which are read to the end first so that records with the same
+	// partition key stay in order
+	Parents []string
+}
+
+// Record read from a shard, along with the record that is sent to the Function for it
+type Record struct {
+	SequenceNumber string
+	Event          interface{}
+
+	// when the record was added to the stream, which it expires from after the stream's retention period
+	Arrival time.Time
+}
+
+// Event is the payload that Lambda sends to Functions for a batch of stream records
+type Event struct {
+	Records []interface{} `json:"Records"`
+}
+
+// position in a shard to start reading from, which is after a sequence number if one is set
+type position struct {
+	after            string
+	startingPosition types.EventSourcePosition
+	timestamp        *time.Time
+}
+
+// stream is implemented for each service whose Event Sources are read shard by shard.
+type stream interface {
+	name() string
+	shards(ctx context.Context) ([]Shard, error)
+
+	// iterator for reading the shard from the position
+	iterator(ctx context.Context, shardId string, p position) (*string, error)
+
+	// records returns up to limit records from the iterator, along with the iterator for the rest of the shard, which
+	// is nil once the shard has been closed & read to the end
+	records(ctx context.Context, shardId string, iterator *string, limit int32) ([]Record, *string, error)
+
+	// fields of the record that filter criteria are evaluated against
+	fields(record Record) (map[string]interface{}, error)
+
+	// expired is true for errors caused by an iterator that can no longer be used
+	expired(err error) bool
+
+	// trimmed is true for errors caused by reading after a record that has expired from the stream
+	trimmed(err error) bool
+
+	// how long records are kept in the stream
+	retention() time.Duration
+}
+
+// NewEvent creates the Event for records read from a stream.
+func NewEvent(records []Record) Event {
+	events := make([]interface{}, len(records))
+	for i, record := range records {
+		events[i] = record.Event
+	}
+
+	return Event{Records: events}
+}
@@ -10,6 +10,7 @@ type Database interface {
 	BeginTx(ctx context.Context) (Transaction, error)
 	Close()
 	Exec(query string, args ...interface{}) (sql.Result, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 	InsertOne(ctx context.Context, query string, args ...interface{}) (int64, error)
 	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
 	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
@@ -86,6 +87,10 @@ func (db RealDatabase) Exec(query string, args ...interface{}) (sql.Result, erro
 	return db.Wrapped.Exec(query, args...)
 }
 
+func (db RealDatabase) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.Wrapped.ExecContext(ctx, query, args...)
+}
+
 func (db RealDatabase) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
 	return db.Wrapped.PrepareContext(ctx, query)
 }
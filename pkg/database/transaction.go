@@ -8,6 +8,7 @@ import (
 
 type Transaction interface {
 	Commit() error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 	InsertOne(ctx context.Context, query string, args ...interface{}) (int64, error)
 	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
 	Rollback(format string, v ...interface{}) string
@@ -21,6 +22,10 @@ func (tx RealTransaction) Commit() error {
 	return tx.wrapped.Commit()
 }
 
+func (tx RealTransaction) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.wrapped.ExecContext(ctx, query, args...)
+}
+
 func (tx RealTransaction) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
 	return tx.wrapped.PrepareContext(ctx, query)
 }
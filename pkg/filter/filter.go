@@ -0,0 +1,344 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Pattern is a compiled Lambda event filtering pattern, see
+// https://docs.aws.amazon.com/lambda/latest/dg/invocation-eventfiltering.html
+type Pattern struct {
+	fields map[string]interface{}
+}
+
+// Criteria matches events that match any of its Patterns. Empty (or nil) Criteria match every event.
+type Criteria struct {
+	patterns []Pattern
+}
+
+// NewCriteria compiles each of the JSON patterns, returning an error for the first one that is invalid. Without any
+// patterns, the Criteria is nil.
+func NewCriteria(patterns []string) (*Criteria, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	var criteria Criteria
+	for _, p := range patterns {
+		pattern, err := Parse(p)
+		if err != nil {
+			return nil, err
+		}
+		criteria.patterns = append(criteria.patterns, *pattern)
+	}
+
+	return &criteria, nil
+}
+
+func (c *Criteria) Matches(event map[string]interface{}) bool {
+	if c == nil || len(c.patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range c.patterns {
+		if pattern.Matches(event) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Parse compiles the JSON pattern, which is an object whose fields are either nested objects or arrays of values
+// and/or operators (prefix, suffix, equals-ignore-case, anything-but, numeric & exists).
+func Parse(pattern string) (*Pattern, error) {
+	var fields map[string]interface{}
+	err := json.Unmarshal([]byte(pattern), &fields)
+	if err != nil {
+		return nil, fmt.Errorf("pattern %s is not a JSON object: %v", pattern, err)
+	}
+
+	err = validateObject(fields)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %v", pattern, err)
+	}
+
+	return &Pattern{fields: fields}, nil
+}
+
+func validateObject(fields map[string]interface{}) error {
+	for key, value := range fields {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			err := validateObject(v)
+			if err != nil {
+				return err
+			}
+		case []interface{}:
+			for _, matcher := range v {
+				err := validateMatcher(matcher)
+				if err != nil {
+					return fmt.Errorf("field %s: %v", key, err)
+				}
+			}
+		default:
+			return fmt.Errorf("field %s must be an object or an array", key)
+		}
+	}
+
+	return nil
+}
+
+func validateMatcher(matcher interface{}) error {
+	operator, ok := matcher.(map[string]interface{})
+	if !ok {
+		switch matcher.(type) {
+		case []interface{}:
+			return fmt.Errorf("nested arrays are not supported")
+		default:
+			return nil
+		}
+	}
+
+	if len(operator) != 1 {
+		return fmt.Errorf("operator %v must have exactly one key", operator)
+	}
+
+	for name, value := range operator {
+		switch name {
+		case "prefix", "suffix", "equals-ignore-case":
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("%s must be a string", name)
+			}
+		case "exists":
+			if _, ok := value.(bool); !ok {
+				return fmt.Errorf("exists must be a boolean")
+			}
+		case "anything-but":
+			return validateAnythingBut(value)
+		case "numeric":
+			_, err := parseNumeric(value)
+			return err
+		default:
+			return fmt.Errorf("unknown operator %s", name)
+		}
+	}
+
+	return nil
+}
+
+func validateAnythingBut(value interface{}) error {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			switch item.(type) {
+			case string, float64:
+			default:
+				return fmt.Errorf("anything-but values must be strings or numbers")
+			}
+		}
+	case map[string]interface{}:
+		prefix, ok := v["prefix"].(string)
+		if len(v) != 1 || !ok || prefix == "" {
+			return fmt.Errorf("anything-but only supports a prefix operator")
+		}
+	case string, float64:
+	default:
+		return fmt.Errorf("anything-but must be a string, number, array or prefix")
+	}
+
+	return nil
+}
+
+type comparison struct {
+	operator string
+	value    float64
+}
+
+func parseNumeric(value interface{}) ([]comparison, error) {
+	items, ok := value.([]interface{})
+	if !ok || len(items) == 0 || len(items)%2 != 0 {
+		return nil, fmt.Errorf("numeric must be an array of operator & value pairs")
+	}
+
+	var results []comparison
+	for i := 0; i < len(items); i += 2 {
+		operator, ok := items[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("numeric operator %v must be a string", items[i])
+		}
+
+		switch operator {
+		case "=", "<", "<=", ">", ">=":
+		default:
+			return nil, fmt.Errorf("unknown numeric operator %s", operator)
+		}
+
+		number, ok := items[i+1].(float64)
+		if !ok {
+			return nil, fmt.Errorf("numeric value %v must be a number", items[i+1])
+		}
+
+		results = append(results, comparison{operator, number})
+	}
+
+	return results, nil
+}
+
+// Matches returns true when every field of the Pattern matches the event.
+func (p Pattern) Matches(event map[string]interface{}) bool {
+	return matchObject(p.fields, event)
+}
+
+func matchObject(fields map[string]interface{}, event map[string]interface{}) bool {
+	for key, pattern := range fields {
+		value, present := event[key]
+
+		switch p := pattern.(type) {
+		case map[string]interface{}:
+			// missing objects are treated as empty so that nested exists:false patterns still work
+			nested, _ := value.(map[string]interface{})
+			if !matchObject(p, nested) {
+				return false
+			}
+		case []interface{}:
+			if !matchField(p, value, present) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// matchField returns true when any of the matchers match the value, or any element when the value is an array.
+func matchField(matchers []interface{}, value interface{}, present bool) bool {
+	values := []interface{}{value}
+	if array, ok := value.([]interface{}); ok {
+		values = array
+	}
+
+	for _, matcher := range matchers {
+		if exists, ok := existsOperator(matcher); ok {
+			if exists == present {
+				return true
+			}
+			continue
+		}
+
+		if !present {
+			continue
+		}
+
+		for _, v := range values {
+			if matchValue(matcher, v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func existsOperator(matcher interface{}) (bool, bool) {
+	operator, ok := matcher.(map[string]interface{})
+	if !ok {
+		return false, false
+	}
+
+	exists, ok := operator["exists"].(bool)
+	return exists, ok
+}
+
+func matchValue(matcher interface{}, value interface{}) bool {
+	operator, ok := matcher.(map[string]interface{})
+	if !ok {
+		return equal(matcher, value)
+	}
+
+	for name, operand := range operator {
+		switch name {
+		case "prefix":
+			s, ok := value.(string)
+			return ok && strings.HasPrefix(s, operand.(string))
+		case "suffix":
+			s, ok := value.(string)
+			return ok && strings.HasSuffix(s, operand.(string))
+		case "equals-ignore-case":
+			s, ok := value.(string)
+			return ok && strings.EqualFold(s, operand.(string))
+		case "anything-but":
+			return matchAnythingBut(operand, value)
+		case "numeric":
+			return matchNumeric(operand, value)
+		}
+	}
+
+	return false
+}
+
+func equal(expected interface{}, value interface{}) bool {
+	switch e := expected.(type) {
+	case nil:
+		return value == nil
+	case string:
+		s, ok := value.(string)
+		return ok && s == e
+	case float64:
+		n, ok := value.(float64)
+		return ok && n == e
+	case bool:
+		b, ok := value.(bool)
+		return ok && b == e
+	}
+
+	return false
+}
+
+func matchAnythingBut(operand interface{}, value interface{}) bool {
+	switch o := operand.(type) {
+	case []interface{}:
+		for _, excluded := range o {
+			if equal(excluded, value) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		s, ok := value.(string)
+		return ok && !strings.HasPrefix(s, o["prefix"].(string))
+	default:
+		return !equal(o, value)
+	}
+}
+
+func matchNumeric(operand interface{}, value interface{}) bool {
+	n, ok := value.(float64)
+	if !ok {
+		return false
+	}
+
+	comparisons, _ := parseNumeric(operand)
+	for _, c := range comparisons {
+		var result bool
+		switch c.operator {
+		case "=":
+			result = n == c.value
+		case "<":
+			result = n < c.value
+		case "<=":
+			result = n <= c.value
+		case ">":
+			result = n > c.value
+		case ">=":
+			result = n >= c.value
+		}
+
+		if !result {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,114 @@
+package filter_test
+
+import (
+	"encoding/json"
+	"github.com/ATenderholt/rainbow-functions/pkg/filter"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func event(t *testing.T, value string) map[string]interface{} {
+	var result map[string]interface{}
+	err := json.Unmarshal([]byte(value), &result)
+	assert.NoError(t, err)
+	return result
+}
+
+func matches(t *testing.T, pattern string, value string) bool {
+	p, err := filter.Parse(pattern)
+	assert.NoError(t, err, pattern)
+	return p.Matches(event(t, value))
+}
+
+func TestExactValues(t *testing.T) {
+	assert.True(t, matches(t, `{"body": {"color": ["blue", "red"]}}`, `{"body": {"color": "red"}}`))
+	assert.False(t, matches(t, `{"body": {"color": ["blue", "red"]}}`, `{"body": {"color": "green"}}`))
+	assert.True(t, matches(t, `{"body": {"count": [5]}}`, `{"body": {"count": 5}}`))
+	assert.True(t, matches(t, `{"body": {"flag": [true]}}`, `{"body": {"flag": true}}`))
+	assert.True(t, matches(t, `{"body": {"value": [null]}}`, `{"body": {"value": null}}`))
+	assert.True(t, matches(t, `{"body": {"tags": ["b"]}}`, `{"body": {"tags": ["a", "b"]}}`))
+}
+
+func TestAllFieldsMustMatch(t *testing.T) {
+	pattern := `{"body": {"color": ["red"], "size": ["large"]}}`
+
+	assert.True(t, matches(t, pattern, `{"body": {"color": "red", "size": "large"}}`))
+	assert.False(t, matches(t, pattern, `{"body": {"color": "red", "size": "small"}}`))
+	assert.False(t, matches(t, pattern, `{"body": {"color": "red"}}`))
+}
+
+func TestPrefixSuffixAndIgnoreCase(t *testing.T) {
+	assert.True(t, matches(t, `{"body": {"id": [{"prefix": "order-"}]}}`, `{"body": {"id": "order-123"}}`))
+	assert.False(t, matches(t, `{"body": {"id": [{"prefix": "order-"}]}}`, `{"body": {"id": "refund-123"}}`))
+	assert.True(t, matches(t, `{"body": {"file": [{"suffix": ".png"}]}}`, `{"body": {"file": "cat.png"}}`))
+	assert.True(t, matches(t, `{"body": {"name": [{"equals-ignore-case": "BOB"}]}}`, `{"body": {"name": "bob"}}`))
+}
+
+func TestAnythingBut(t *testing.T) {
+	assert.True(t, matches(t, `{"body": {"state": [{"anything-but": "done"}]}}`, `{"body": {"state": "new"}}`))
+	assert.False(t, matches(t, `{"body": {"state": [{"anything-but": "done"}]}}`, `{"body": {"state": "done"}}`))
+	assert.False(t, matches(t, `{"body": {"state": [{"anything-but": ["done", "failed"]}]}}`, `{"body": {"state": "failed"}}`))
+	assert.True(t, matches(t, `{"body": {"id": [{"anything-but": {"prefix": "test-"}}]}}`, `{"body": {"id": "prod-1"}}`))
+	assert.False(t, matches(t, `{"body": {"id": [{"anything-but": {"prefix": "test-"}}]}}`, `{"body": {"id": "test-1"}}`))
+	assert.False(t, matches(t, `{"body": {"state": [{"anything-but": "done"}]}}`, `{"body": {}}`))
+}
+
+func TestNumeric(t *testing.T) {
+	pattern := `{"body": {"price": [{"numeric": [">", 0, "<=", 100]}]}}`
+
+	assert.True(t, matches(t, pattern, `{"body": {"price": 100}}`))
+	assert.False(t, matches(t, pattern, `{"body": {"price": 0}}`))
+	assert.False(t, matches(t, pattern, `{"body": {"price": 101}}`))
+	assert.False(t, matches(t, pattern, `{"body": {"price": "50"}}`))
+	assert.True(t, matches(t, `{"body": {"count": [{"numeric": ["=", 3]}]}}`, `{"body": {"count": 3}}`))
+}
+
+func TestExists(t *testing.T) {
+	assert.True(t, matches(t, `{"body": {"error": [{"exists": true}]}}`, `{"body": {"error": "boom"}}`))
+	assert.False(t, matches(t, `{"body": {"error": [{"exists": true}]}}`, `{"body": {}}`))
+	assert.True(t, matches(t, `{"body": {"error": [{"exists": false}]}}`, `{"body": {}}`))
+	assert.False(t, matches(t, `{"body": {"error": [{"exists": false}]}}`, `{"body": {"error": "boom"}}`))
+	assert.True(t, matches(t, `{"body": {"detail": {"error": [{"exists": false}]}}}`, `{"body": {}}`))
+}
+
+func TestNestedObjects(t *testing.T) {
+	pattern := `{"body": {"order": {"customer": {"tier": ["gold"]}}}}`
+
+	assert.True(t, matches(t, pattern, `{"body": {"order": {"customer": {"tier": "gold"}}}}`))
+	assert.False(t, matches(t, pattern, `{"body": {"order": {"customer": {"tier": "silver"}}}}`))
+	assert.False(t, matches(t, pattern, `{"body": {"order": "gold"}}`))
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	patterns := []string{
+		`not json`,
+		`["body"]`,
+		`{"body": "red"}`,
+		`{"body": [{"unknown": "x"}]}`,
+		`{"body": [{"prefix": 1}]}`,
+		`{"body": [{"numeric": [">"]}]}`,
+		`{"body": [{"numeric": ["!=", 1]}]}`,
+		`{"body": [{"exists": "yes"}]}`,
+		`{"body": [{"anything-but": {"suffix": "x"}}]}`,
+		`{"body": [{"prefix": "a", "suffix": "b"}]}`,
+	}
+
+	for _, pattern := range patterns {
+		_, err := filter.Parse(pattern)
+		assert.Error(t, err, pattern)
+	}
+}
+
+func TestCriteriaMatchesAnyPattern(t *testing.T) {
+	criteria, err := filter.NewCriteria([]string{
+		`{"body": {"color": ["red"]}}`,
+		`{"body": {"color": ["blue"]}}`,
+	})
+	assert.NoError(t, err)
+
+	assert.True(t, criteria.Matches(event(t, `{"body": {"color": "blue"}}`)))
+	assert.False(t, criteria.Matches(event(t, `{"body": {"color": "green"}}`)))
+
+	var empty *filter.Criteria
+	assert.True(t, empty.Matches(event(t, `{"body": {"color": "green"}}`)))
+}
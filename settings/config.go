@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"database/sql"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -17,9 +18,12 @@ const (
 	DefaultBasePort = 9050
 	DefaultDataPath = "data"
 
-	DefaultDevConfigFile = "functions.yml"
-	DefaultSqsEndpoint   = "http://localhost:9324"
-	DefaultNetworks      = "rainbow"
+	DefaultDevConfigFile    = "functions.yml"
+	DefaultSqsEndpoint      = "http://localhost:9324"
+	DefaultKinesisEndpoint  = "http://localhost:4567"
+	DefaultDynamoDbEndpoint = "http://localhost:8000"
+	DefaultEventsEndpoint   = "http://localhost:4566"
+	DefaultNetworks         = "rainbow"
 )
 
 type Config struct {
@@ -36,12 +40,35 @@ type Config struct {
 	DevConfigFile string
 	Networks      []string
 	SqsEndpoint   string
+
+	// SQS endpoints for queues in other regions and/or accounts, keyed by region:account or region
+	SqsEndpoints map[string]string
+
+	KinesisEndpoint  string
+	DynamoDbEndpoint string
+
+	// EventBridge endpoint for event buses that are destinations of asynchronous invocations
+	EventsEndpoint string
 }
 
 func (config *Config) ArnFragment() string {
 	return config.Region + ":" + config.AccountNumber
 }
 
+// SqsEndpointFor returns the endpoint for SQS queues in the region & account, which is the most specific entry in
+// SqsEndpoints or SqsEndpoint if there isn't one.
+func (config *Config) SqsEndpointFor(region string, account string) string {
+	if endpoint, ok := config.SqsEndpoints[region+":"+account]; ok {
+		return endpoint
+	}
+
+	if endpoint, ok := config.SqsEndpoints[region]; ok {
+		return endpoint
+	}
+
+	return config.SqsEndpoint
+}
+
 func (config *Config) CreateDatabase() *sql.DB {
 	connStr := config.DbConnectionString()
 	db, err := sql.Open("sqlite3", connStr)
@@ -83,16 +110,19 @@ func DefaultConfig() *Config {
 	}
 
 	return &Config{
-		AccountNumber: DefaultAccountNumber,
-		IsDebug:       false,
-		IsLocal:       true,
-		Region:        DefaultRegion,
-		Database:      DefaultDatabase(),
-		BasePort:      DefaultBasePort,
-		dataPath:      DefaultDataPath,
-		DevConfigFile: DefaultDevConfigFile,
-		SqsEndpoint:   DefaultSqsEndpoint,
-		Networks:      []string{DefaultNetworks},
+		AccountNumber:    DefaultAccountNumber,
+		IsDebug:          false,
+		IsLocal:          true,
+		Region:           DefaultRegion,
+		Database:         DefaultDatabase(),
+		BasePort:         DefaultBasePort,
+		dataPath:         DefaultDataPath,
+		DevConfigFile:    DefaultDevConfigFile,
+		SqsEndpoint:      DefaultSqsEndpoint,
+		KinesisEndpoint:  DefaultKinesisEndpoint,
+		DynamoDbEndpoint: DefaultDynamoDbEndpoint,
+		EventsEndpoint:   DefaultEventsEndpoint,
+		Networks:         []string{DefaultNetworks},
 	}
 }
 
@@ -113,6 +143,34 @@ func (v *NetworkValue) String() string {
 	return ""
 }
 
+// EndpointsValue parses a comma-separated list of key=endpoint pairs
+type EndpointsValue struct {
+	endpoints map[string]string
+}
+
+func (v *EndpointsValue) Set(s string) error {
+	endpoints := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid endpoint %s, expected region[:account]=url", pair)
+		}
+		endpoints[parts[0]] = parts[1]
+	}
+
+	v.endpoints = endpoints
+	return nil
+}
+
+func (v *EndpointsValue) String() string {
+	pairs := make([]string, 0, len(v.endpoints))
+	for key, endpoint := range v.endpoints {
+		pairs = append(pairs, key+"="+endpoint)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
 func FromFlags(name string, args []string) (*Config, string, error) {
 	flags := flag.NewFlagSet(name, flag.ContinueOnError)
 
@@ -122,6 +180,7 @@ func FromFlags(name string, args []string) (*Config, string, error) {
 	var cfg Config
 	var dbFileName string
 	networks := NetworkValue{[]string{DefaultNetworks}}
+	var sqsEndpoints EndpointsValue
 	flags.StringVar(&cfg.AccountNumber, "account-number", DefaultAccountNumber, "Account number returned in ARNs")
 	flags.BoolVar(&cfg.IsDebug, "debug", false, "Enable debug logging")
 	flags.BoolVar(&cfg.IsLocal, "local", true, "Application should use localhost when routing lambda")
@@ -130,6 +189,10 @@ func FromFlags(name string, args []string) (*Config, string, error) {
 	flags.StringVar(&cfg.dataPath, "data-path", DefaultDataPath, "Path to persist data and lambdas")
 	flags.StringVar(&cfg.DevConfigFile, "config", DefaultDevConfigFile, "Config file for starting lambdas in Development mode")
 	flags.StringVar(&cfg.SqsEndpoint, "sqs-endpoint", DefaultSqsEndpoint, "Endpoint for SQS services (i.e. lambda triggers)")
+	flags.Var(&sqsEndpoints, "sqs-endpoints", "Comma-separated list of region[:account]=url Endpoints for SQS queues in other regions or accounts")
+	flags.StringVar(&cfg.KinesisEndpoint, "kinesis-endpoint", DefaultKinesisEndpoint, "Endpoint for Kinesis streams (i.e. lambda triggers)")
+	flags.StringVar(&cfg.DynamoDbEndpoint, "dynamodb-endpoint", DefaultDynamoDbEndpoint, "Endpoint for DynamoDB streams (i.e. lambda triggers)")
+	flags.StringVar(&cfg.EventsEndpoint, "events-endpoint", DefaultEventsEndpoint, "Endpoint for EventBridge event buses (i.e. lambda destinations)")
 	flags.Var(&networks, "networks", "Comma-separated list of Networks for lambda containers")
 	flags.StringVar(&dbFileName, "db", DefaultDbFilename, "Database file for persisting lambda configuration")
 
@@ -141,6 +204,7 @@ func FromFlags(name string, args []string) (*Config, string, error) {
 	cfg.Database = DefaultDatabase()
 	cfg.Database.Filename = dbFileName
 	cfg.Networks = networks.networks
+	cfg.SqsEndpoints = sqsEndpoints.endpoints
 
 	return &cfg, buf.String(), err
 }
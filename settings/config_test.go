@@ -79,3 +79,90 @@ func TestSetNetworks(t *testing.T) {
 	expected.Networks = []string{"sqs", "s3", "lambda"}
 	assert.Equal(t, cfg, expected)
 }
+
+func TestSetSqsEndpoints(t *testing.T) {
+	cfg, output, err := settings.FromFlags("lambda-router", []string{
+		"-sqs-endpoints", "us-east-1=http://sqs-east,eu-west-1:123456789012=http://sqs-eu",
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assert.Empty(t, output)
+
+	expected := settings.DefaultConfig()
+	expected.SqsEndpoints = map[string]string{
+		"us-east-1":              "http://sqs-east",
+		"eu-west-1:123456789012": "http://sqs-eu",
+	}
+	assert.Equal(t, cfg, expected)
+}
+
+func TestSetInvalidSqsEndpoints(t *testing.T) {
+	_, _, err := settings.FromFlags("lambda-router", []string{
+		"-sqs-endpoints", "us-east-1",
+	})
+
+	assert.Error(t, err)
+}
+
+func TestSqsEndpointFor(t *testing.T) {
+	cfg := settings.DefaultConfig()
+	cfg.SqsEndpoints = map[string]string{
+		"us-east-1":              "http://sqs-east",
+		"us-east-1:123456789012": "http://sqs-east-other",
+	}
+
+	assert.Equal(t, "http://sqs-east-other", cfg.SqsEndpointFor("us-east-1", "123456789012"))
+	assert.Equal(t, "http://sqs-east", cfg.SqsEndpointFor("us-east-1", settings.DefaultAccountNumber))
+	assert.Equal(t, settings.DefaultSqsEndpoint, cfg.SqsEndpointFor("us-west-2", settings.DefaultAccountNumber))
+}
+
+func TestSetKinesisEndpoint(t *testing.T) {
+	cfg, output, err := settings.FromFlags("lambda-router", []string{
+		"-kinesis-endpoint", "http://kinesis",
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assert.Empty(t, output)
+
+	expected := settings.DefaultConfig()
+	expected.KinesisEndpoint = "http://kinesis"
+	assert.Equal(t, cfg, expected)
+}
+
+func TestSetDynamoDbEndpoint(t *testing.T) {
+	cfg, output, err := settings.FromFlags("lambda-router", []string{
+		"-dynamodb-endpoint", "http://dynamodb",
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assert.Empty(t, output)
+
+	expected := settings.DefaultConfig()
+	expected.DynamoDbEndpoint = "http://dynamodb"
+	assert.Equal(t, cfg, expected)
+}
+
+func TestSetEventsEndpoint(t *testing.T) {
+	cfg, output, err := settings.FromFlags("lambda-router", []string{
+		"-events-endpoint", "http://events",
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assert.Empty(t, output)
+
+	expected := settings.DefaultConfig()
+	expected.EventsEndpoint = "http://events"
+	assert.Equal(t, cfg, expected)
+}